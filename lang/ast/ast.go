@@ -48,6 +48,8 @@ func (p *Program) String() string {
 type LetStatement struct {
 	Value Expression
 	Name  *Identifier
+	// Type is the annotated type of the binding, nil if there is none.
+	Type  *Type
 	Token token.Token
 }
 
@@ -59,6 +61,9 @@ func (ls *LetStatement) String() string {
 
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -103,6 +108,17 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type ThrowStatement struct {
+	Value Expression
+	Token token.Token
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
 type ExpressionStatement struct {
 	Expression Expression
 	Token      token.Token
@@ -204,9 +220,42 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression has at least one of Catch and Finally; CatchParameter is set
+// together with Catch.
+type TryExpression struct {
+	Block          *BlockStatement
+	CatchParameter *Identifier
+	Catch          *BlockStatement
+	Finally        *BlockStatement
+	Token          token.Token
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch (" + te.CatchParameter.String() + ") ")
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	// RBrace is the closing brace, the zero Token if the block is unclosed.
+	RBrace token.Token
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -224,7 +273,13 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Body       *BlockStatement
 	Token      token.Token
+	Name       string
 	Parameters []*Identifier
+	// ParameterTypes holds the annotated type of each parameter, nil for
+	// those without one. It is nil if no parameter is annotated.
+	ParameterTypes []*Type
+	// ReturnType is the annotated result type, nil if there is none.
+	ReturnType *Type
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -233,14 +288,21 @@ func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		if i < len(fl.ParameterTypes) && fl.ParameterTypes[i] != nil {
+			params = append(params, p.String()+": "+fl.ParameterTypes[i].String())
+		} else {
+			params = append(params, p.String())
+		}
 	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	if fl.ReturnType != nil {
+		out.WriteString("-> " + fl.ReturnType.String() + " ")
+	}
 	out.WriteString(fl.Body.String())
 
 	return out.String()
@@ -321,6 +383,19 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// PropagateExpression is the postfix `?` operator: it yields Value unless
+// Value is an error value, which is returned from the enclosing function.
+type PropagateExpression struct {
+	Value Expression
+	Token token.Token
+}
+
+func (pe *PropagateExpression) expressionNode()      {}
+func (pe *PropagateExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PropagateExpression) String() string {
+	return "(" + pe.Value.String() + "?)"
+}
+
 type HashLiteral struct {
 	Pairs map[Expression]Expression
 	Token token.Token
@@ -361,3 +436,41 @@ func (ml *MacroLiteral) String() string {
 		ml.TokenLiteral(), strings.Join(params, ", "), ml.Body.String(),
 	)
 }
+
+// Type is a type annotation. Its Token is the name of a named type such as
+// int, or the opening [ of an array type, { of a hash type or fn of a
+// function type.
+type Type struct {
+	Token token.Token
+	// Element is the element type of an array type.
+	Element *Type
+	// Key and Value are the types of a hash type.
+	Key, Value *Type
+	// Parameters and Result are the types of a function type; Result is nil
+	// if it is not given.
+	Parameters []*Type
+	Result     *Type
+}
+
+func (t *Type) TokenLiteral() string { return t.Token.Literal }
+func (t *Type) String() string {
+	switch t.Token.Type {
+	case token.LBracket:
+		return "[" + t.Element.String() + "]"
+	case token.LBrace:
+		return "{" + t.Key.String() + ": " + t.Value.String() + "}"
+	case token.Function:
+		params := []string{}
+		for _, p := range t.Parameters {
+			params = append(params, p.String())
+		}
+
+		out := "fn(" + strings.Join(params, ", ") + ")"
+		if t.Result != nil {
+			out += " -> " + t.Result.String()
+		}
+		return out
+	}
+
+	return t.Token.Literal
+}
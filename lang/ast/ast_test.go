@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strings"
 	"testing"
 
 	"llc/lang/token"
@@ -27,3 +28,50 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestPos(t *testing.T) {
+	plus := token.Token{Type: token.Plus, Literal: "+", Line: 2, Column: 7}
+	node := &InfixExpression{Token: plus, Operator: "+"}
+
+	if pos := Pos(node); pos.String() != "2:7" {
+		t.Errorf("wrong position. got=%s", pos)
+	}
+
+	if pos := Pos(&Program{}); pos != (token.Position{}) {
+		t.Errorf("program has a position. got=%s", pos)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	ident := func(name string, column int) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.Ident, Literal: name, Line: 1, Column: column}, Value: name}
+	}
+
+	// let f = fn(a) { a + b };
+	program := &Program{Statements: []Statement{
+		&LetStatement{
+			Name: ident("f", 5),
+			Value: &FunctionLiteral{
+				Parameters: []*Identifier{ident("a", 12)},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &InfixExpression{Left: ident("a", 17), Right: ident("b", 21)}},
+				}},
+			},
+		},
+		// A statement the parser gave up on.
+		(*LetStatement)(nil),
+	}}
+
+	var visited []string
+	Walk(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			visited = append(visited, ident.Value+"@"+Pos(ident).String())
+		}
+		_, isInfix := node.(*InfixExpression)
+		return !isInfix
+	})
+
+	if got := strings.Join(visited, " "); got != "f@1:5 a@1:12" {
+		t.Errorf("wrong identifiers visited. got=%q", got)
+	}
+}
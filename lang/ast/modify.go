@@ -18,6 +18,8 @@ func Modify(node Node, modifier ModifierFunc) Node { //nolint:gocognit,cyclop
 	case *IndexExpression:
 		node.Left, _ = Modify(node.Left, modifier).(Expression)
 		node.Index, _ = Modify(node.Index, modifier).(Expression)
+	case *PropagateExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
 	case *IfExpression:
 		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
 		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
@@ -30,6 +32,16 @@ func Modify(node Node, modifier ModifierFunc) Node { //nolint:gocognit,cyclop
 		}
 	case *ReturnStatement:
 		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+	case *ThrowStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *TryExpression:
+		node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+		if node.Catch != nil {
+			node.Catch, _ = Modify(node.Catch, modifier).(*BlockStatement)
+		}
+		if node.Finally != nil {
+			node.Finally, _ = Modify(node.Finally, modifier).(*BlockStatement)
+		}
 	case *LetStatement:
 		node.Value, _ = Modify(node.Value, modifier).(Expression)
 	case *FunctionLiteral:
@@ -0,0 +1,55 @@
+package ast
+
+import "llc/lang/token"
+
+// Pos is the source position of node's token, such as the operator of an
+// infix expression or the opening parenthesis of a call. Programs and nodes
+// built without a token have the zero Position.
+func Pos(node Node) token.Position { //nolint:cyclop
+	var tok token.Token
+
+	switch node := node.(type) {
+	case *LetStatement:
+		tok = node.Token
+	case *Identifier:
+		tok = node.Token
+	case *ReturnStatement:
+		tok = node.Token
+	case *ThrowStatement:
+		tok = node.Token
+	case *ExpressionStatement:
+		tok = node.Token
+	case *IntegerLiteral:
+		tok = node.Token
+	case *PrefixExpression:
+		tok = node.Token
+	case *InfixExpression:
+		tok = node.Token
+	case *Boolean:
+		tok = node.Token
+	case *IfExpression:
+		tok = node.Token
+	case *TryExpression:
+		tok = node.Token
+	case *BlockStatement:
+		tok = node.Token
+	case *FunctionLiteral:
+		tok = node.Token
+	case *CallExpression:
+		tok = node.Token
+	case *StringLiteral:
+		tok = node.Token
+	case *ArrayLiteral:
+		tok = node.Token
+	case *IndexExpression:
+		tok = node.Token
+	case *PropagateExpression:
+		tok = node.Token
+	case *HashLiteral:
+		tok = node.Token
+	case *MacroLiteral:
+		tok = node.Token
+	}
+
+	return tok.Position()
+}
@@ -0,0 +1,84 @@
+package ast
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Walk calls visit for node and, while visit returns true, for each of its
+// children in source order. Nodes the parser left nil after a syntax error
+// are skipped.
+func Walk(node Node, visit func(Node) bool) { //nolint:cyclop
+	if node == nil || reflect.ValueOf(node).IsNil() || !visit(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, statement := range node.Statements {
+			Walk(statement, visit)
+		}
+	case *LetStatement:
+		Walk(node.Name, visit)
+		Walk(node.Value, visit)
+	case *ReturnStatement:
+		Walk(node.ReturnValue, visit)
+	case *ThrowStatement:
+		Walk(node.Value, visit)
+	case *ExpressionStatement:
+		Walk(node.Expression, visit)
+	case *PrefixExpression:
+		Walk(node.Right, visit)
+	case *InfixExpression:
+		Walk(node.Left, visit)
+		Walk(node.Right, visit)
+	case *IfExpression:
+		Walk(node.Condition, visit)
+		Walk(node.Consequence, visit)
+		Walk(node.Alternative, visit)
+	case *TryExpression:
+		Walk(node.Block, visit)
+		Walk(node.CatchParameter, visit)
+		Walk(node.Catch, visit)
+		Walk(node.Finally, visit)
+	case *BlockStatement:
+		for _, statement := range node.Statements {
+			Walk(statement, visit)
+		}
+	case *FunctionLiteral:
+		for _, parameter := range node.Parameters {
+			Walk(parameter, visit)
+		}
+		Walk(node.Body, visit)
+	case *MacroLiteral:
+		for _, parameter := range node.Parameters {
+			Walk(parameter, visit)
+		}
+		Walk(node.Body, visit)
+	case *CallExpression:
+		Walk(node.Function, visit)
+		for _, argument := range node.Arguments {
+			Walk(argument, visit)
+		}
+	case *ArrayLiteral:
+		for _, element := range node.Elements {
+			Walk(element, visit)
+		}
+	case *IndexExpression:
+		Walk(node.Left, visit)
+		Walk(node.Index, visit)
+	case *PropagateExpression:
+		Walk(node.Value, visit)
+	case *HashLiteral:
+		keys := make([]Expression, 0, len(node.Pairs))
+		for key := range node.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return Pos(keys[i]).Before(Pos(keys[j])) })
+
+		for _, key := range keys {
+			Walk(key, visit)
+			Walk(node.Pairs[key], visit)
+		}
+	}
+}
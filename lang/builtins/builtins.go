@@ -0,0 +1,214 @@
+package builtins
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"llc/lang/object"
+)
+
+type Definition struct {
+	Builtin *object.Builtin
+	Name    string
+}
+
+// Definitions is ordered: the compiler refers to builtins by their index here.
+var Definitions = []Definition{
+	{Name: "len", Builtin: &object.Builtin{
+		Function: func(_ *object.Host, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			switch arg := args[0].(type) {
+			case *object.String:
+				return &object.Integer{Value: int64(len(arg.Value))}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{Name: "first", Builtin: &object.Builtin{
+		Function: func(_ *object.Host, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				if len(arg.Elements) > 0 {
+					return arg.Elements[0]
+				}
+
+				return object.NULL
+			default:
+				return newError("argument to `first` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{Name: "last", Builtin: &object.Builtin{
+		Function: func(_ *object.Host, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				if len(arg.Elements) > 0 {
+					return arg.Elements[len(arg.Elements)-1]
+				}
+
+				return object.NULL
+			default:
+				return newError("argument to `first` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{Name: "rest", Builtin: &object.Builtin{
+		Function: func(_ *object.Host, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				if len(arg.Elements) > 0 {
+					return &object.Array{Elements: arg.Elements[1:len(arg.Elements)]}
+				}
+
+				return object.NULL
+			default:
+				return newError("argument to `first` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{Name: "push", Builtin: &object.Builtin{
+		Function: func(_ *object.Host, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			if args[0].Type() != object.ArrayObj {
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+			arr, _ := args[0].(*object.Array)
+			length := len(arr.Elements)
+			newElements := make([]object.Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+			return &object.Array{Elements: newElements}
+		},
+	}},
+	{Name: "print", Builtin: &object.Builtin{
+		Function: func(host *object.Host, args ...object.Object) object.Object {
+			for _, a := range args {
+				_, _ = fmt.Fprintln(host.Output(), a.Inspect())
+			}
+
+			return object.NULL
+		},
+	}},
+	{Name: "eprint", Builtin: &object.Builtin{
+		Function: func(host *object.Host, args ...object.Object) object.Object {
+			for _, a := range args {
+				_, _ = fmt.Fprintln(host.ErrorOutput(), a.Inspect())
+			}
+
+			return object.NULL
+		},
+	}},
+	{Name: "input", Builtin: &object.Builtin{
+		Function: func(host *object.Host, args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+
+			if len(args) == 1 {
+				_, _ = io.WriteString(host.Output(), args[0].Inspect())
+			}
+
+			line, err := host.ReadLine()
+			if errors.Is(err, io.EOF) {
+				return object.NULL
+			}
+			if err != nil {
+				return newError("input: %s", err)
+			}
+
+			return &object.String{Value: line}
+		},
+	}},
+	{Name: "json_parse", Builtin: &object.Builtin{
+		Function: jsonParse,
+	}},
+	{Name: "json_stringify", Builtin: &object.Builtin{
+		Function: jsonStringify,
+	}},
+	{Name: "read_file", Builtin: &object.Builtin{
+		Function: readFile,
+	}},
+	{Name: "write_file", Builtin: &object.Builtin{
+		Function: writeFile,
+	}},
+	{Name: "list_dir", Builtin: &object.Builtin{
+		Function: listDir,
+	}},
+	{Name: "getenv", Builtin: &object.Builtin{
+		Function: getenv,
+	}},
+	{Name: "args", Builtin: &object.Builtin{
+		Function: scriptArgs,
+	}},
+	{Name: "exit", Builtin: &object.Builtin{
+		Function: exit,
+	}},
+	{Name: "error", Builtin: &object.Builtin{
+		Function: func(_ *object.Host, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+
+			message, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `error` must be STRING, got %s", args[0].Type())
+			}
+
+			errorValue := &object.ErrorValue{Kind: "Error", Message: message.Value}
+			if len(args) == 2 {
+				errorValue.Data = args[1]
+			}
+
+			return errorValue
+		},
+	}},
+	{Name: "is_error", Builtin: &object.Builtin{
+		Function: func(_ *object.Host, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			if args[0].Type() == object.ErrorValueObj {
+				return object.TRUE
+			}
+
+			return object.FALSE
+		},
+	}},
+}
+
+func Lookup(name string) (*object.Builtin, bool) {
+	for _, def := range Definitions {
+		if def.Name == name {
+			return def.Builtin, true
+		}
+	}
+
+	return nil, false
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
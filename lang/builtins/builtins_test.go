@@ -0,0 +1,117 @@
+package builtins
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"llc/lang/object"
+)
+
+func TestPrintWritesToHostOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	host := &object.Host{Stdout: &stdout, Stderr: &stderr}
+
+	call(t, host, "print", &object.Integer{Value: 1}, &object.String{Value: "two"})
+	call(t, host, "eprint", &object.String{Value: "oops"})
+
+	if stdout.String() != "1\ntwo\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+
+	if stderr.String() != "oops\n" {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+}
+
+func TestInputReadsLinesFromHost(t *testing.T) {
+	var stdout bytes.Buffer
+	host := &object.Host{Stdin: strings.NewReader("alice\r\nbob\nlast"), Stdout: &stdout}
+
+	tests := []struct {
+		args     []object.Object
+		expected object.Object
+	}{
+		{[]object.Object{&object.String{Value: "name? "}}, &object.String{Value: "alice"}},
+		{nil, &object.String{Value: "bob"}},
+		{nil, &object.String{Value: "last"}},
+		{nil, object.NULL},
+	}
+
+	for _, tt := range tests {
+		result := call(t, host, "input", tt.args...)
+		if result.Type() != tt.expected.Type() || result.Inspect() != tt.expected.Inspect() {
+			t.Errorf("wrong input result. got=%s, want=%s", result.Inspect(), tt.expected.Inspect())
+		}
+	}
+
+	if stdout.String() != "name? " {
+		t.Errorf("prompt not written to output. got=%q", stdout.String())
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for i, def := range Definitions {
+		builtin, ok := Lookup(def.Name)
+		if !ok || builtin != Definitions[i].Builtin {
+			t.Errorf("builtin %s not found by name", def.Name)
+		}
+	}
+
+	if _, ok := Lookup("missing"); ok {
+		t.Errorf("unknown builtin found")
+	}
+}
+
+func call(t *testing.T, host *object.Host, name string, args ...object.Object) object.Object {
+	t.Helper()
+
+	builtin, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("builtin %s not defined", name)
+	}
+
+	return builtin.Function(host, args...)
+}
+
+func TestEveryBuiltinIsDocumented(t *testing.T) {
+	for _, def := range Definitions {
+		doc, ok := Docs[def.Name]
+		if !ok {
+			t.Errorf("%s has no Doc", def.Name)
+			continue
+		}
+		if !strings.HasPrefix(doc.Signature, def.Name+"(") || doc.Summary == "" {
+			t.Errorf("%s has a malformed Doc: %+v", def.Name, doc)
+		}
+	}
+
+	if len(Docs) != len(Definitions) {
+		t.Errorf("Docs has %d entries for %d builtins", len(Docs), len(Definitions))
+	}
+}
+
+func TestArity(t *testing.T) {
+	host := &object.Host{Capabilities: object.CapFS | object.CapEnv}
+	wrongArity := func(result object.Object) bool {
+		err, ok := result.(*object.Error)
+		return ok && strings.HasPrefix(err.Message, "wrong number of arguments")
+	}
+	nulls := func(n int) []object.Object {
+		args := make([]object.Object, n)
+		for i := range args {
+			args[i] = &object.Null{}
+		}
+		return args
+	}
+
+	for _, def := range Definitions {
+		minArgs, maxArgs := Docs[def.Name].Arity()
+		if minArgs > 0 && !wrongArity(call(t, host, def.Name, nulls(minArgs-1)...)) {
+			t.Errorf("%s accepts %d arguments, fewer than its arity %d", def.Name, minArgs-1, minArgs)
+		}
+		if maxArgs >= 0 && !wrongArity(call(t, host, def.Name, nulls(maxArgs+1)...)) {
+			t.Errorf("%s accepts %d arguments, more than its arity %d", def.Name, maxArgs+1, maxArgs)
+		}
+	}
+}
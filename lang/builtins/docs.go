@@ -0,0 +1,52 @@
+package builtins
+
+import "strings"
+
+// Doc describes a core builtin to editors.
+type Doc struct {
+	Signature string
+	Summary   string
+}
+
+// Docs holds a Doc for every core builtin, by name.
+var Docs = map[string]Doc{
+	"len":            {"len(value)", "Returns the length of a string or an array."},
+	"first":          {"first(array)", "Returns the first element of an array, or null if it is empty."},
+	"last":           {"last(array)", "Returns the last element of an array, or null if it is empty."},
+	"rest":           {"rest(array)", "Returns a new array without the first element, or null if it is empty."},
+	"push":           {"push(array, value)", "Returns a new array with value appended."},
+	"print":          {"print(values...)", "Writes each value on its own line to standard output."},
+	"eprint":         {"eprint(values...)", "Writes each value on its own line to standard error."},
+	"input":          {"input(prompt?)", "Writes prompt, then reads a line of input; null at the end of input."},
+	"json_parse":     {"json_parse(text)", "Parses a JSON document into hashes, arrays, strings, integers and booleans."},
+	"json_stringify": {"json_stringify(value, indent?)", "Encodes value as JSON, indented by spaces or a string."},
+	"read_file":      {"read_file(path)", "Returns the contents of a file. Needs --allow-fs."},
+	"write_file":     {"write_file(path, content)", "Writes content to a file. Needs --allow-fs."},
+	"list_dir":       {"list_dir(path)", "Returns the names of the entries of a directory. Needs --allow-fs."},
+	"getenv":         {"getenv(name)", "Returns an environment variable, or null if it is not set. Needs --allow-env."},
+	"args":           {"args()", "Returns the arguments given after the script name."},
+	"exit":           {"exit(code?)", "Ends the script with an exit code, 0 by default. Needs --allow-exit."},
+	"error":          {"error(message, data?)", "Returns an error value, which unlike a thrown error does not propagate."},
+	"is_error":       {"is_error(value)", "Reports whether value is an error value."},
+}
+
+// Arity returns the least number of arguments the builtin takes and the
+// most, which is -1 if it takes any number. They are read from the
+// signature, where optional parameters end with ? and variadic ones with ....
+func (d Doc) Arity() (minArgs, maxArgs int) {
+	params := d.Signature[strings.Index(d.Signature, "(")+1 : len(d.Signature)-1]
+	if params == "" {
+		return 0, 0
+	}
+
+	for _, param := range strings.Split(params, ", ") {
+		switch {
+		case strings.HasSuffix(param, "..."):
+			return minArgs, -1
+		case !strings.HasSuffix(param, "?"):
+			minArgs++
+		}
+		maxArgs++
+	}
+	return minArgs, maxArgs
+}
@@ -0,0 +1,159 @@
+package builtins
+
+import (
+	"os"
+
+	"llc/lang/object"
+)
+
+func readFile(host *object.Host, args ...object.Object) object.Object {
+	if err := requireCapability(host, object.CapFS, "read_file"); err != nil {
+		return err
+	}
+
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+	}
+
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `read_file` must be STRING, got %s", args[0].Type())
+	}
+
+	content, err := os.ReadFile(path.Value)
+	if err != nil {
+		return newError("read_file: %s", err)
+	}
+
+	return &object.String{Value: string(content)}
+}
+
+func writeFile(host *object.Host, args ...object.Object) object.Object {
+	if err := requireCapability(host, object.CapFS, "write_file"); err != nil {
+		return err
+	}
+
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), 2)
+	}
+
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `write_file` must be STRING, got %s", args[0].Type())
+	}
+
+	content, ok := args[1].(*object.String)
+	if !ok {
+		return newError("content for `write_file` must be STRING, got %s", args[1].Type())
+	}
+
+	if err := os.WriteFile(path.Value, []byte(content.Value), 0o600); err != nil {
+		return newError("write_file: %s", err)
+	}
+
+	return object.NULL
+}
+
+func listDir(host *object.Host, args ...object.Object) object.Object {
+	if err := requireCapability(host, object.CapFS, "list_dir"); err != nil {
+		return err
+	}
+
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+	}
+
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `list_dir` must be STRING, got %s", args[0].Type())
+	}
+
+	entries, err := os.ReadDir(path.Value)
+	if err != nil {
+		return newError("list_dir: %s", err)
+	}
+
+	names := make([]object.Object, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, &object.String{Value: entry.Name()})
+	}
+
+	return &object.Array{Elements: names}
+}
+
+func getenv(host *object.Host, args ...object.Object) object.Object {
+	if err := requireCapability(host, object.CapEnv, "getenv"); err != nil {
+		return err
+	}
+
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+	}
+
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `getenv` must be STRING, got %s", args[0].Type())
+	}
+
+	value, ok := os.LookupEnv(name.Value)
+	if !ok {
+		return object.NULL
+	}
+
+	return &object.String{Value: value}
+}
+
+func scriptArgs(host *object.Host, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), 0)
+	}
+
+	elements := []object.Object{}
+	if host != nil {
+		for _, arg := range host.Args {
+			elements = append(elements, &object.String{Value: arg})
+		}
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func exit(host *object.Host, args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+
+	if err := requireCapability(host, object.CapExit, "exit"); err != nil {
+		return err
+	}
+
+	if host.Exit == nil {
+		return newError("exit: not supported by host")
+	}
+
+	code := int64(0)
+	if len(args) == 1 {
+		integer, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+		}
+		code = integer.Value
+	}
+
+	host.Exit(int(code))
+	return object.NULL
+}
+
+var capabilityNames = map[object.Capability]string{
+	object.CapFS:   "file system",
+	object.CapEnv:  "environment",
+	object.CapExit: "process",
+}
+
+func requireCapability(host *object.Host, c object.Capability, builtin string) *object.Error {
+	if host.Allows(c) {
+		return nil
+	}
+
+	return newError("%s: %s access is not allowed", builtin, capabilityNames[c])
+}
@@ -0,0 +1,172 @@
+package builtins
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"llc/lang/object"
+)
+
+var errCyclicStructure = errors.New("cyclic structure")
+
+func jsonParse(_ *object.Host, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), 1)
+	}
+
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `json_parse` must be STRING, got %s", args[0].Type())
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(str.Value))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return newError("json_parse: %s", err)
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return newError("json_parse: unexpected data after top-level value")
+	}
+
+	return jsonToObject(value)
+}
+
+func jsonToObject(value interface{}) object.Object {
+	switch value := value.(type) {
+	case nil:
+		return object.NULL
+	case bool:
+		if value {
+			return object.TRUE
+		}
+		return object.FALSE
+	case string:
+		return &object.String{Value: value}
+	case json.Number:
+		integer, err := value.Int64()
+		if err != nil {
+			return newError("json_parse: number %s is not an integer", value)
+		}
+		return &object.Integer{Value: integer}
+	case []interface{}:
+		elements := make([]object.Object, 0, len(value))
+		for _, v := range value {
+			element := jsonToObject(v)
+			if element.Type() == object.ErrorObj {
+				return element
+			}
+			elements = append(elements, element)
+		}
+		return &object.Array{Elements: elements}
+	case map[string]interface{}:
+		pairs := make(map[object.HashKey]object.HashPair, len(value))
+		for k, v := range value {
+			key := &object.String{Value: k}
+			val := jsonToObject(v)
+			if val.Type() == object.ErrorObj {
+				return val
+			}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}
+	default:
+		return newError("json_parse: unsupported value %T", value)
+	}
+}
+
+func jsonStringify(_ *object.Host, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *object.Integer:
+			if arg.Value < 0 {
+				return newError("json_stringify: indent must not be negative, got %d", arg.Value)
+			}
+			indent = strings.Repeat(" ", int(arg.Value))
+		case *object.String:
+			indent = arg.Value
+		default:
+			return newError("argument to `json_stringify` indent must be INTEGER or STRING, got %s", args[1].Type())
+		}
+	}
+
+	value, err := objectToJSON(args[0], map[object.Object]bool{})
+	if err != nil {
+		return newError("json_stringify: %s", err)
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(value); err != nil {
+		return newError("json_stringify: %s", err)
+	}
+
+	return &object.String{Value: strings.TrimSuffix(out.String(), "\n")}
+}
+
+// objectToJSON converts obj into a value encoding/json can marshal. Hash keys
+// end up in a Go map, so the encoder emits them in sorted order.
+func objectToJSON(obj object.Object, visiting map[object.Object]bool) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil //nolint:nilnil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		if visiting[obj] {
+			return nil, errCyclicStructure
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		elements := make([]interface{}, 0, len(obj.Elements))
+		for _, e := range obj.Elements {
+			element, err := objectToJSON(e, visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return elements, nil
+	case *object.Hash:
+		if visiting[obj] {
+			return nil, errCyclicStructure
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		pairs := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil, fmt.Errorf("unsupported hash key %s, keys must be STRING", pair.Key.Type())
+			}
+
+			value, err := objectToJSON(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key.Value] = value
+		}
+		return pairs, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %s", obj.Type())
+	}
+}
@@ -0,0 +1,34 @@
+package builtins
+
+import (
+	"testing"
+
+	"llc/lang/object"
+)
+
+func TestJSONStringifyCyclicStructure(t *testing.T) {
+	array := &object.Array{}
+	array.Elements = []object.Object{&object.Integer{Value: 1}, array}
+
+	key := &object.String{Value: "self"}
+	hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: hash}
+
+	for _, value := range []object.Object{array, hash} {
+		result := jsonStringify(nil, value)
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned. got=%T (%+v)", result, result)
+		}
+
+		if errObj.Message != "json_stringify: cyclic structure" {
+			t.Errorf("wrong error message. got=%q", errObj.Message)
+		}
+	}
+
+	shared := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	result := jsonStringify(nil, &object.Array{Elements: []object.Object{shared, shared}})
+	if result.Inspect() != "[[1],[1]]" {
+		t.Errorf("shared values must not be reported as cycles. got=%q", result.Inspect())
+	}
+}
@@ -0,0 +1,84 @@
+package builtins
+
+import (
+	"fmt"
+	"strings"
+
+	"llc/lang/lexer"
+	"llc/lang/object"
+)
+
+// Registry holds the builtins available to one runtime: the core ones
+// followed by whatever the host registers. Indices are stable, so compiled
+// code can refer to builtins by position.
+type Registry struct {
+	indices     map[string]int
+	definitions []Definition
+}
+
+func NewRegistry() *Registry {
+	r := &Registry{indices: make(map[string]int, len(Definitions))}
+	for _, def := range Definitions {
+		r.indices[def.Name] = len(r.definitions)
+		r.definitions = append(r.definitions, def)
+	}
+
+	return r
+}
+
+func (r *Registry) Register(name string, fn object.BuiltinFunction) error {
+	if !isValidName(name) {
+		return fmt.Errorf("invalid builtin name %q", name)
+	}
+
+	if _, ok := r.indices[name]; ok {
+		return fmt.Errorf("builtin %s already defined", name)
+	}
+
+	r.indices[name] = len(r.definitions)
+	r.definitions = append(r.definitions, Definition{Name: name, Builtin: &object.Builtin{Function: fn}})
+
+	return nil
+}
+
+// Namespace returns a view of the registry that prefixes every registered
+// name with "<name>.", so scripts call them as `name.fn(...)`.
+func (r *Registry) Namespace(name string) *Namespace {
+	return &Namespace{registry: r, prefix: name}
+}
+
+func (r *Registry) Lookup(name string) (*object.Builtin, bool) {
+	idx, ok := r.indices[name]
+	if !ok {
+		return nil, false
+	}
+
+	return r.definitions[idx].Builtin, true
+}
+
+func (r *Registry) Definitions() []Definition {
+	return r.definitions
+}
+
+type Namespace struct {
+	registry *Registry
+	prefix   string
+}
+
+func (n *Namespace) Register(name string, fn object.BuiltinFunction) error {
+	if !isValidName(n.prefix) {
+		return fmt.Errorf("invalid namespace %q", n.prefix)
+	}
+
+	return n.registry.Register(n.prefix+"."+name, fn)
+}
+
+func isValidName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !lexer.IsIdentifier(part) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,77 @@
+package builtins
+
+import (
+	"testing"
+
+	"llc/lang/object"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	fn := func(_ *object.Host, _ ...object.Object) object.Object { return object.NULL }
+
+	if err := r.Register("double", fn); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := r.Namespace("math").Register("abs", fn); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := r.Register("_debug", fn); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	definitions := r.Definitions()
+	if len(definitions) != len(Definitions)+3 {
+		t.Fatalf("wrong number of definitions. got=%d", len(definitions))
+	}
+
+	for i, def := range Definitions {
+		if definitions[i].Name != def.Name {
+			t.Errorf("core builtin %s moved to index %d", def.Name, i)
+		}
+	}
+
+	if definitions[len(Definitions)+1].Name != "math.abs" {
+		t.Errorf("wrong namespaced name. got=%s", definitions[len(Definitions)+1].Name)
+	}
+
+	for _, name := range []string{"len", "double", "math.abs", "_debug"} {
+		if _, ok := r.Lookup(name); !ok {
+			t.Errorf("builtin %s not found", name)
+		}
+	}
+
+	if _, ok := NewRegistry().Lookup("double"); ok {
+		t.Errorf("registries must not share host builtins")
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	r := NewRegistry()
+	fn := func(_ *object.Host, _ ...object.Object) object.Object { return object.NULL }
+
+	tests := []struct {
+		register func() error
+		expected string
+	}{
+		{func() error { return r.Register("len", fn) }, "builtin len already defined"},
+		{func() error { return r.Register("", fn) }, `invalid builtin name ""`},
+		{func() error { return r.Register("1x", fn) }, `invalid builtin name "1x"`},
+		{func() error { return r.Register("a-b", fn) }, `invalid builtin name "a-b"`},
+		{func() error { return r.Namespace("my ns").Register("f", fn) }, `invalid namespace "my ns"`},
+		{func() error { return r.Namespace("ns").Register("f.", fn) }, `invalid builtin name "ns.f."`},
+	}
+
+	for _, tt := range tests {
+		err := tt.register()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. got=%v, want=%q", err, tt.expected)
+		}
+	}
+
+	if err := r.Namespace("strings").Register("len", fn); err != nil {
+		t.Errorf("namespaced builtins must not collide with core ones: %s", err)
+	}
+}
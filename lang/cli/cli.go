@@ -1,17 +1,80 @@
 package cli
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"llc/lang/compiler"
+	"llc/lang/dap"
+	"llc/lang/debugger"
+	"llc/lang/disasm"
 	"llc/lang/files"
+	"llc/lang/formatter"
+	"llc/lang/llcb"
+	"llc/lang/lsp"
 	"llc/lang/object"
+	"llc/lang/optimizer"
 	"llc/lang/repl"
+	"llc/lang/typecheck"
+	"llc/lang/vet"
+)
+
+var (
+	allowFS     bool
+	allowEnv    bool
+	allowExit   bool
+	runCheck    bool
+	buildOutput string
+	optimize    int
+	debugOnVM   bool
+	breakpoints []int
+	fmtWrite    bool
+	fmtCheck    bool
+	vetJSON     bool
+	vetEnable   []string
+	vetDisable  []string
 )
 
 func init() {
+	RootCmd.PersistentFlags().IntVarP(&optimize, "optimize", "O", int(optimizer.Default),
+		"optimization level: 0 runs code as written, 1 folds constants and removes dead branches")
+	RunCmd.Flags().BoolVar(&allowFS, "allow-fs", false, "allow scripts to read and write files")
+	RunCmd.Flags().BoolVar(&allowEnv, "allow-env", false, "allow scripts to read environment variables")
+	RunCmd.Flags().BoolVar(&allowExit, "allow-exit", false, "allow scripts to end the process with exit")
+	RunCmd.Flags().BoolVar(&runCheck, "check", false, "type check the module before running it")
+	RunCmd.Flags().SetInterspersed(false)
 	RootCmd.AddCommand(RunCmd)
+	RootCmd.AddCommand(DisasmCmd)
+	BuildCmd.Flags().StringVarP(&buildOutput, "output", "o", "", "output file (default: the module with "+
+		llcb.Extension+" extension)")
+	RootCmd.AddCommand(BuildCmd)
+	DebugCmd.Flags().BoolVar(&debugOnVM, "vm", false, "run the module on the VM instead of the evaluator")
+	DebugCmd.Flags().IntSliceVarP(&breakpoints, "break", "b", nil, "set a breakpoint on a line")
+	DebugCmd.Flags().BoolVar(&allowFS, "allow-fs", false, "allow scripts to read and write files")
+	DebugCmd.Flags().BoolVar(&allowEnv, "allow-env", false, "allow scripts to read environment variables")
+	DebugCmd.Flags().BoolVar(&allowExit, "allow-exit", false, "allow scripts to end the process with exit")
+	DebugCmd.Flags().SetInterspersed(false)
+	RootCmd.AddCommand(DebugCmd)
+	RootCmd.AddCommand(DapCmd)
+	RootCmd.AddCommand(LspCmd)
+	FmtCmd.Flags().BoolVarP(&fmtWrite, "write", "w", false, "write the result to the module instead of printing it")
+	FmtCmd.Flags().BoolVar(&fmtCheck, "check", false, "list the modules that are not formatted and fail if any")
+	FmtCmd.MarkFlagsMutuallyExclusive("write", "check")
+	RootCmd.AddCommand(FmtCmd)
+	VetCmd.Flags().BoolVar(&vetJSON, "json", false, "print the diagnostics as a JSON array")
+	VetCmd.Flags().StringSliceVar(&vetEnable, "enable", nil, "run only these rules")
+	VetCmd.Flags().StringSliceVar(&vetDisable, "disable", nil, "skip these rules")
+	for _, rule := range vet.Rules {
+		VetCmd.Long += fmt.Sprintf("\n  %-12s %s", rule.Name(), rule.Doc())
+	}
+	RootCmd.AddCommand(VetCmd)
+	RootCmd.AddCommand(CheckCmd)
 }
 
 var RootCmd = &cobra.Command{
@@ -21,21 +84,293 @@ var RootCmd = &cobra.Command{
 }
 
 var RunCmd = &cobra.Command{
-	Use:   "run [module]",
+	Use:   "run [module] [args...]",
 	Short: "run a Learning Language Compiler",
 	Long:  "run a Learning Language Compiler",
-	Args:  cobra.MaximumNArgs(1),
+	Args:  cobra.ArbitraryArgs,
 	Run:   runCommand,
 }
 
+var DisasmCmd = &cobra.Command{
+	Use:   "disasm [module]",
+	Short: "print the bytecode compiled from a module",
+	Long:  "print the constants and the instructions of every compiled function of a module",
+	Args:  cobra.ExactArgs(1),
+	Run:   disasmCommand,
+}
+
+func disasmCommand(command *cobra.Command, args []string) {
+	var program *llcb.Program
+	if filepath.Ext(args[0]) == llcb.Extension {
+		loaded, err := files.LoadBytecodeFile(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		program = loaded
+	} else {
+		comp, err := files.CompileFile(args[0], optimizer.Level(optimize))
+		if err != nil {
+			log.Fatal(err)
+		}
+		program = &llcb.Program{Bytecode: comp.Bytecode(), Globals: comp.SymbolTable().Names(compiler.GlobalScope)}
+	}
+
+	_, _ = fmt.Fprint(command.OutOrStdout(), disasm.Disassemble(program.Bytecode, program.Globals))
+}
+
+var BuildCmd = &cobra.Command{
+	Use:   "build [module]",
+	Short: "compile a module to bytecode",
+	Long:  "compile a module to a " + llcb.Extension + " file that llc run executes without recompiling",
+	Args:  cobra.ExactArgs(1),
+	Run:   buildCommand,
+}
+
+func buildCommand(_ *cobra.Command, args []string) {
+	out := buildOutput
+	if out == "" {
+		out = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + llcb.Extension
+	}
+
+	err := files.BuildFile(args[0], out, optimizer.Level(optimize))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func runCommand(command *cobra.Command, args []string) {
 	if len(args) == 0 {
-		repl.Start(os.Stdin, os.Stdout)
+		repl.StartWithHost(newHost(nil), optimizer.Level(optimize))
+	} else if filepath.Ext(args[0]) == llcb.Extension {
+		err := files.RunBytecodeFile(args[0], newHost(args[1:]))
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else {
-		env := object.NewEnvironment()
-		_, err := files.ReadFile(args[0], env)
+		if runCheck && typeErrors(command.ErrOrStderr(), args[:1]) {
+			os.Exit(1)
+		}
+		env := object.NewEnvironmentWithHost(newHost(args[1:]))
+		_, err := files.ReadFile(args[0], env, optimizer.Level(optimize))
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 }
+
+var DebugCmd = &cobra.Command{
+	Use:   "debug [module] [args...]",
+	Short: "run a module under the debugger",
+	Long: "run a module under an interactive debugger that stops before the first line, " +
+		"at breakpoints and after steps; type help at its prompt for the commands",
+	Args: cobra.MinimumNArgs(1),
+	Run:  debugCommand,
+}
+
+func debugCommand(command *cobra.Command, args []string) {
+	source, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	session := debugger.New(string(source), command.InOrStdin(), command.OutOrStdout())
+	for _, line := range breakpoints {
+		session.Break(line)
+	}
+
+	// Optimizations move and drop code, so unless asked for they are off
+	// while debugging.
+	level := optimizer.O0
+	if command.Flags().Changed("optimize") {
+		level = optimizer.Level(optimize)
+	}
+
+	host := newHost(args[1:])
+	host.Debugger = session
+	if err := files.DebugFile(args[0], host, debugOnVM, level); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var DapCmd = &cobra.Command{
+	Use:   "dap",
+	Short: "serve the Debug Adapter Protocol on stdin and stdout",
+	Long:  "serve the Debug Adapter Protocol on stdin and stdout, so that editors can debug modules with the interpreter",
+	Args:  cobra.NoArgs,
+	Run:   dapCommand,
+}
+
+func dapCommand(command *cobra.Command, _ []string) {
+	err := dap.New(command.InOrStdin(), command.OutOrStdout()).Serve()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+var LspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "serve the Language Server Protocol on stdin and stdout",
+	Long:  "serve the Language Server Protocol on stdin and stdout, giving editors diagnostics, navigation and completion",
+	Args:  cobra.NoArgs,
+	Run:   lspCommand,
+}
+
+func lspCommand(command *cobra.Command, _ []string) {
+	err := lsp.New(command.InOrStdin(), command.OutOrStdout()).Serve()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+var FmtCmd = &cobra.Command{
+	Use:   "fmt [modules...]",
+	Short: "format modules",
+	Long:  "print modules in the canonical layout, keeping their comments",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   fmtCommand,
+}
+
+func fmtCommand(command *cobra.Command, args []string) {
+	unformatted := false
+	for _, path := range args {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		formatted, err := formatter.Format(string(source))
+		if err != nil {
+			log.Fatalf("%s:%s", path, err)
+		}
+
+		switch {
+		case fmtCheck:
+			if formatted != string(source) {
+				unformatted = true
+				_, _ = fmt.Fprintln(command.OutOrStdout(), path)
+			}
+		case fmtWrite:
+			if formatted != string(source) {
+				if err := os.WriteFile(path, []byte(formatted), 0o644); err != nil { //nolint:gosec
+					log.Fatal(err)
+				}
+			}
+		default:
+			_, _ = fmt.Fprint(command.OutOrStdout(), formatted)
+		}
+	}
+
+	if unformatted {
+		os.Exit(1)
+	}
+}
+
+var VetCmd = &cobra.Command{
+	Use:   "vet [modules...]",
+	Short: "report likely mistakes in modules",
+	Long:  "report likely mistakes in modules, failing if there are any. Rules:",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   vetCommand,
+}
+
+// vetDiagnostic is a diagnostic as printed by llc vet --json.
+type vetDiagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func vetCommand(command *cobra.Command, args []string) {
+	rules, err := vet.Select(vetEnable, vetDisable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	found := []vetDiagnostic{}
+	for _, path := range args {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		diagnostics, err := vet.Vet(string(source), rules)
+		if err != nil {
+			log.Fatalf("%s:%s", path, err)
+		}
+		for _, d := range diagnostics {
+			found = append(found, vetDiagnostic{
+				File: path, Line: d.Position.Line, Column: d.Position.Column, Rule: d.Rule, Message: d.Message,
+			})
+		}
+	}
+
+	if vetJSON {
+		out, err := json.MarshalIndent(found, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, _ = fmt.Fprintln(command.OutOrStdout(), string(out))
+	} else {
+		for _, d := range found {
+			_, _ = fmt.Fprintf(command.OutOrStdout(), "%s:%d:%d: %s (%s)\n", d.File, d.Line, d.Column, d.Message, d.Rule)
+		}
+	}
+
+	if len(found) != 0 {
+		os.Exit(1)
+	}
+}
+
+var CheckCmd = &cobra.Command{
+	Use:   "check [modules...]",
+	Short: "type check modules",
+	Long:  "check the type annotations of modules, inferring types where there are none, and fail if there are errors",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   checkCommand,
+}
+
+func checkCommand(command *cobra.Command, args []string) {
+	if typeErrors(command.OutOrStdout(), args) {
+		os.Exit(1)
+	}
+}
+
+// typeErrors prints the type errors of the modules at paths to out and
+// reports whether there are any.
+func typeErrors(out io.Writer, paths []string) bool {
+	found := false
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		errs, err := typecheck.Check(string(source))
+		if err != nil {
+			log.Fatalf("%s:%s", path, err)
+		}
+		for _, e := range errs {
+			found = true
+			_, _ = fmt.Fprintf(out, "%s:%s\n", path, e)
+		}
+	}
+	return found
+}
+
+func newHost(args []string) *object.Host {
+	host := &object.Host{Args: args}
+	if allowFS {
+		host.Capabilities |= object.CapFS
+	}
+	if allowEnv {
+		host.Capabilities |= object.CapEnv
+	}
+	if allowExit {
+		host.Capabilities |= object.CapExit
+		host.Exit = os.Exit
+	}
+
+	return host
+}
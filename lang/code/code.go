@@ -25,6 +25,36 @@ const (
 	OpGreaterThan
 	OpMinus
 	OpBang
+	OpGetBuiltin
+	OpCall
+	OpJumpNotTruthy
+	OpJump
+	OpNull
+	OpGetGlobal
+	OpSetGlobal
+	OpArray
+	OpHash
+	OpIndex
+	OpReturnValue
+	OpReturn
+	OpGetLocal
+	OpSetLocal
+	OpClosure
+	OpGetFree
+	OpCurrentClosure
+	OpThrow
+	// OpJumpNotError jumps unless the top of the stack is an error value,
+	// leaving the stack untouched either way.
+	OpJumpNotError
+	// Superinstructions emitted by the peephole pass. OpAddConst and
+	// OpSubConst take their right operand from the constant pool and
+	// OpGetLocalAdd from a local slot.
+	OpAddConst
+	OpSubConst
+	OpGetLocalAdd
+	// OpWide makes every operand of the instruction after it 4 bytes wide.
+	// Make emits it for operands too large for their usual width.
+	OpWide
 )
 
 type Definition struct {
@@ -32,7 +62,8 @@ type Definition struct {
 	OperandWidths []int
 }
 
-var definitions = map[Opcode]*Definition{
+// definitions is indexed by opcode; undefined opcodes are nil.
+var definitions = [256]*Definition{
 	OpConstant:    {"OpConstant", []int{2}},
 	OpAdd:         {"OpAdd", []int{}},
 	OpSub:         {"OpSub", []int{}},
@@ -46,6 +77,61 @@ var definitions = map[Opcode]*Definition{
 	OpGreaterThan: {"OpGreaterThan", []int{}},
 	OpMinus:       {"OpMinus", []int{}},
 	OpBang:        {"OpBang", []int{}},
+	OpGetBuiltin:  {"OpGetBuiltin", []int{1}},
+	OpCall:        {"OpCall", []int{1}},
+
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpJump:           {"OpJump", []int{2}},
+	OpNull:           {"OpNull", []int{}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpArray:          {"OpArray", []int{2}},
+	OpHash:           {"OpHash", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpThrow:          {"OpThrow", []int{}},
+	OpJumpNotError:   {"OpJumpNotError", []int{2}},
+	OpAddConst:       {"OpAddConst", []int{2}},
+	OpSubConst:       {"OpSubConst", []int{2}},
+	OpGetLocalAdd:    {"OpGetLocalAdd", []int{1}},
+	OpWide:           {"OpWide", []int{}},
+}
+
+// Handler is an entry of an exception-handler table. An error raised while
+// executing an instruction in [Start, End) is caught by resetting the operand
+// stack to Depth values, pushing the error and jumping to Target.
+type Handler struct {
+	Start  int
+	End    int
+	Target int
+	Depth  int
+}
+
+// StackEffect is how many values executing op with operands leaves on the
+// operand stack, relative to before.
+func StackEffect(op Opcode, operands ...int) int { //nolint:cyclop
+	switch op {
+	case OpConstant, OpTrue, OpFalse, OpNull, OpGetGlobal, OpGetLocal, OpGetBuiltin, OpGetFree, OpCurrentClosure:
+		return 1
+	case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpNotEqual, OpGreaterThan, OpIndex:
+		return -1
+	case OpPop, OpJumpNotTruthy, OpSetGlobal, OpSetLocal, OpReturnValue, OpThrow:
+		return -1
+	case OpCall:
+		return -operands[0]
+	case OpArray, OpHash:
+		return 1 - operands[0]
+	case OpClosure:
+		return 1 - operands[1]
+	default:
+		return 0
+	}
 }
 
 func (ins Instructions) String() string {
@@ -53,25 +139,102 @@ func (ins Instructions) String() string {
 
 	i := 0
 	for i < len(ins) {
-		def, err := Lookup(ins[i])
+		def, operands, width, err := ins.Decode(i)
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
-			continue
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+		} else {
+			prefix := ""
+			if Opcode(ins[i]) == OpWide {
+				prefix = "OpWide "
+			}
+			fmt.Fprintf(&out, "%04d %s%s\n", i, prefix, FormatInstruction(def, operands))
 		}
-
-		operands, read := ReadOperands(def, ins[i+1:])
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
-		i += 1 + read
+		i += width
 	}
 
 	return out.String()
 }
 
-func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+// Decode reads the instruction at offset and returns its definition,
+// operands and total width in bytes. For an instruction behind an OpWide
+// prefix it returns the definition of the instruction itself and counts the
+// prefix in the width. On an unknown opcode or operands cut off by the end
+// of ins it returns an error along with the number of bytes to skip, so
+// callers walking malformed bytecode always make progress.
+func (ins Instructions) Decode(offset int) (*Definition, []int, int, error) {
+	if Opcode(ins[offset]) == OpWide {
+		return ins.decodeWide(offset)
+	}
+
+	def, err := Lookup(ins[offset])
+	if err != nil {
+		return nil, nil, 1, err
+	}
+
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+
+	if offset+width > len(ins) {
+		return def, nil, len(ins) - offset, fmt.Errorf("%s truncated: want %d bytes, got %d",
+			def.Name, width, len(ins)-offset)
+	}
+
+	operands, _ := ReadOperands(def, ins[offset+1:])
+
+	return def, operands, width, nil
+}
+
+func (ins Instructions) decodeWide(offset int) (*Definition, []int, int, error) {
+	if offset+1 >= len(ins) {
+		return nil, nil, 1, fmt.Errorf("OpWide truncated: no instruction follows")
+	}
+
+	def, err := Lookup(ins[offset+1])
+	if err != nil {
+		return nil, nil, 2, err
+	}
+
+	if len(def.OperandWidths) == 0 {
+		return nil, nil, 2, fmt.Errorf("OpWide: %s has no operands", def.Name)
+	}
+
+	width := 2 + 4*len(def.OperandWidths)
+	if offset+width > len(ins) {
+		return def, nil, len(ins) - offset, fmt.Errorf("OpWide %s truncated: want %d bytes, got %d",
+			def.Name, width, len(ins)-offset)
+	}
+
+	operands, _ := ReadOperands(Widen(def), ins[offset+2:])
+
+	return def, operands, width, nil
+}
+
+// Opcode is the opcode of the instruction at offset, looking through an
+// OpWide prefix.
+func (ins Instructions) Opcode(offset int) Opcode {
+	if Opcode(ins[offset]) == OpWide && offset+1 < len(ins) {
+		return Opcode(ins[offset+1])
+	}
+	return Opcode(ins[offset])
+}
+
+// Widen returns def with every operand 4 bytes wide, as after OpWide.
+func Widen(def *Definition) *Definition {
+	widths := make([]int, len(def.OperandWidths))
+	for i := range widths {
+		widths[i] = 4
+	}
+	return &Definition{Name: def.Name, OperandWidths: widths}
+}
+
+// FormatInstruction renders an opcode and its operands the way String does.
+func FormatInstruction(def *Definition, operands []int) string {
 	operandCount := len(def.OperandWidths)
 
 	if len(operands) != operandCount {
-		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d", len(operands), operandCount)
 	}
 
 	switch operandCount {
@@ -79,26 +242,47 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
 	}
 
-	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s", def.Name)
 }
 
 func Lookup(op byte) (*Definition, error) {
-	def, ok := definitions[Opcode(op)]
-	if !ok {
+	def := definitions[op]
+	if def == nil {
 		return nil, fmt.Errorf("opcode %d undefined", op)
 	}
 
 	return def, nil
 }
 
+// Make encodes an instruction. When an operand does not fit its width, the
+// instruction is prefixed with OpWide and all its operands take 4 bytes.
 func Make(op Opcode, operands ...int) []byte {
-	def, ok := definitions[op]
-	if !ok {
+	def := definitions[op]
+	if def == nil {
 		return []byte{}
 	}
 
+	if !fits(def, operands) {
+		return append([]byte{byte(OpWide)}, encode(op, Widen(def), operands)...)
+	}
+
+	return encode(op, def, operands)
+}
+
+func fits(def *Definition, operands []int) bool {
+	for i, o := range operands {
+		if i < len(def.OperandWidths) && (o < 0 || o >= 1<<(8*def.OperandWidths[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func encode(op Opcode, def *Definition, operands []int) []byte {
 	instructionLen := 1
 	for _, w := range def.OperandWidths {
 		instructionLen += w
@@ -109,10 +293,18 @@ func Make(op Opcode, operands ...int) []byte {
 
 	offset := 1
 	for i, o := range operands {
+		if i >= len(def.OperandWidths) {
+			break
+		}
+
 		width := def.OperandWidths[i]
-		switch width { //nolint: gocritic
+		switch width {
+		case 1:
+			instruction[offset] = byte(o)
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o)) //nolint:gosec
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o)) //nolint:gosec
 		}
 		offset += width
 	}
@@ -125,9 +317,13 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	offset := 0
 
 	for i, width := range def.OperandWidths {
-		switch width { //nolint: gocritic
+		switch width {
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		}
 
 		offset += width
@@ -136,6 +332,14 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+func ReadUint8(ins Instructions) uint8 {
+	return ins[0]
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
@@ -3,6 +3,8 @@ package code
 import (
 	"fmt"
 	"testing"
+
+	"llc/lang/token"
 )
 
 func TestMake(t *testing.T) {
@@ -21,6 +23,26 @@ func TestMake(t *testing.T) {
 			operands: []int{},
 			expected: []byte{byte(OpAdd)},
 		},
+		{
+			op:       OpGetLocal,
+			operands: []int{255},
+			expected: []byte{byte(OpGetLocal), 255},
+		},
+		{
+			op:       OpClosure,
+			operands: []int{65534, 255},
+			expected: []byte{byte(OpClosure), 255, 254, 255},
+		},
+		{
+			op:       OpConstant,
+			operands: []int{65536},
+			expected: []byte{byte(OpWide), byte(OpConstant), 0, 1, 0, 0},
+		},
+		{
+			op:       OpClosure,
+			operands: []int{1, 256},
+			expected: []byte{byte(OpWide), byte(OpClosure), 0, 0, 0, 1, 0, 0, 1, 0},
+		},
 	}
 
 	for i, tt := range tests {
@@ -45,11 +67,17 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpAdd),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 70000),
+		Make(OpClosure, 65535, 255),
 	}
 
 	expected := `0000 OpAdd
 0001 OpConstant 2
 0004 OpConstant 65535
+0007 OpGetLocal 1
+0009 OpWide OpConstant 70000
+0015 OpClosure 65535 255
 `
 
 	concatted := Instructions{}
@@ -73,6 +101,16 @@ func TestReadOperands(t *testing.T) {
 			operands:  []int{65535},
 			bytesRead: 2,
 		},
+		{
+			op:        OpGetLocal,
+			operands:  []int{255},
+			bytesRead: 1,
+		},
+		{
+			op:        OpClosure,
+			operands:  []int{65535, 255},
+			bytesRead: 3,
+		},
 	}
 
 	for i, tt := range tests {
@@ -98,3 +136,81 @@ func TestReadOperands(t *testing.T) {
 		})
 	}
 }
+
+func TestInstructionsStringMalformed(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{Instructions{255, byte(OpAdd)}, "0000 ERROR: opcode 255 undefined\n0001 OpAdd\n"},
+		{Instructions{byte(OpPop), byte(OpConstant), 1}, "0000 OpPop\n0001 ERROR: OpConstant truncated: want 3 bytes, got 2\n"},
+		{Instructions{byte(OpClosure), 0, 1}, "0000 ERROR: OpClosure truncated: want 4 bytes, got 3\n"},
+		{Instructions{byte(OpWide)}, "0000 ERROR: OpWide truncated: no instruction follows\n"},
+		{Instructions{byte(OpWide), byte(OpAdd), byte(OpPop)}, "0000 ERROR: OpWide: OpAdd has no operands\n0002 OpPop\n"},
+		{Instructions{byte(OpWide), byte(OpGetLocal), 0, 0}, "0000 ERROR: OpWide OpGetLocal truncated: want 6 bytes, got 4\n"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			if tt.ins.String() != tt.expected {
+				t.Errorf("wrong disassembly.\nwant=%q\ngot=%q", tt.expected, tt.ins.String())
+			}
+		})
+	}
+}
+
+func TestDecodeWide(t *testing.T) {
+	ins := Instructions(Make(OpClosure, 70000, 300))
+
+	def, operands, width, err := ins.Decode(0)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if def.Name != "OpClosure" || fmt.Sprint(operands) != "[70000 300]" || width != 10 {
+		t.Errorf("wrong decoding. got=%s %v width %d", def.Name, operands, width)
+	}
+
+	if ins.Opcode(0) != OpClosure {
+		t.Errorf("wrong opcode. got=%d", ins.Opcode(0))
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	var lines LineTable
+	lines = lines.Add(0, token.Position{Line: 1, Column: 1})
+	lines = lines.Add(3, token.Position{Line: 1, Column: 1})
+	lines = lines.Add(4, token.Position{Line: 2, Column: 5})
+	lines = lines.Add(7, token.Position{Line: 3, Column: 1})
+	// Instructions from 7 on were taken back and re-emitted.
+	lines = lines.Add(7, token.Position{Line: 2, Column: 5})
+
+	if len(lines) != 2 {
+		t.Fatalf("wrong number of entries. want=2, got=%d (%v)", len(lines), lines)
+	}
+
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "1:1"},
+		{3, "1:1"},
+		{4, "2:5"},
+		{100, "2:5"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			pos, ok := lines.Lookup(tt.offset)
+			if !ok || pos.String() != tt.expected {
+				t.Errorf("wrong position. want=%s, got=%s (%t)", tt.expected, pos, ok)
+			}
+		})
+	}
+
+	if _, ok := LineTable(nil).Lookup(0); ok {
+		t.Errorf("empty table has a position")
+	}
+}
@@ -0,0 +1,47 @@
+package code
+
+import (
+	"sort"
+
+	"llc/lang/token"
+)
+
+// LineTable maps instruction offsets to the source positions they were
+// compiled from. An entry covers the instructions from its Offset up to the
+// next entry's, so a run of instructions from one expression takes a single
+// entry. Entries are sorted by Offset.
+type LineTable []Line
+
+type Line struct {
+	Offset   int
+	Position token.Position
+}
+
+// Add records that the instructions from offset on come from pos, dropping
+// entries at or past offset, as left behind by instructions the compiler
+// has taken back.
+func (t LineTable) Add(offset int, pos token.Position) LineTable {
+	t = t.Truncate(offset)
+	if len(t) > 0 && t[len(t)-1].Position == pos {
+		return t
+	}
+	return append(t, Line{Offset: offset, Position: pos})
+}
+
+// Truncate drops the entries at or past offset.
+func (t LineTable) Truncate(offset int) LineTable {
+	for len(t) > 0 && t[len(t)-1].Offset >= offset {
+		t = t[:len(t)-1]
+	}
+	return t
+}
+
+// Lookup returns the position of the instruction at offset. It reports
+// false when the table has no position for it.
+func (t LineTable) Lookup(offset int) (token.Position, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 || t[i-1].Position.Line == 0 {
+		return token.Position{}, false
+	}
+	return t[i-1].Position, true
+}
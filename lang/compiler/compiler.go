@@ -2,30 +2,118 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 
 	"llc/lang/ast"
+	"llc/lang/builtins"
 	"llc/lang/code"
 	"llc/lang/object"
+	"llc/lang/token"
 )
 
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	lines               code.LineTable
+
+	// depth is the height of the operand stack after the last instruction.
+	depth    int
+	handlers []code.Handler
+	tries    []*tryRegion
+	// farJumps maps the offsets of jumps whose target did not fit their
+	// operand to that target. They are widened when the scope is finished.
+	farJumps map[int]int
+}
+
+// tryRegion is the code protected by one handler of a try expression. Code
+// inlined for a return leaves the region, so it can span several segments.
+type tryRegion struct {
+	depth    int
+	start    int
+	segments [][2]int
+	finally  *ast.BlockStatement
+}
+
 type Compiler struct {
-	instructions code.Instructions
-	constants    []object.Object
+	symbolTable *SymbolTable
+	constants   []object.Object
+	builtins    []builtins.Definition
+	// constantIndex finds integer and string constants already in the pool,
+	// so that equal literals share one slot.
+	constantIndex map[constantKey]int
+	// optimize enables the peephole pass over every finished function.
+	optimize bool
+
+	scopes     []CompilationScope
+	scopeIndex int
+	// position is that of the innermost node being compiled, which the
+	// line table records for every instruction emitted.
+	position token.Position
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Builtins     []builtins.Definition
+	// Lines maps Instructions to the source positions they were compiled
+	// from, for error messages, stack traces and tools.
+	Lines    code.LineTable
+	Handlers []code.Handler
 }
 
 func New() *Compiler {
+	return NewWithBuiltins(builtins.NewRegistry())
+}
+
+func NewWithBuiltins(registry *builtins.Registry) *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, def := range registry.Definitions() {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+
 	return &Compiler{
-		instructions: code.Instructions{},
-		constants:    []object.Object{},
+		symbolTable:   symbolTable,
+		constants:     []object.Object{},
+		builtins:      registry.Definitions(),
+		constantIndex: make(map[constantKey]int),
+		scopes:        []CompilationScope{newCompilationScope()},
+	}
+}
+
+// NewWithState continues compilation on top of a previous compiler's symbol
+// table and constants, which is what the REPL needs to keep globals alive.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	for i, constant := range constants {
+		if key, ok := keyOf(constant); ok {
+			compiler.constantIndex[key] = i
+		}
 	}
+	return compiler
 }
 
-func (c *Compiler) Compile(node ast.Node) error { //nolint:gocognit,cyclop,funlen
+// SetPeephole turns the bytecode peephole pass on or off. It is off by
+// default so that the emitted code mirrors the source.
+func (c *Compiler) SetPeephole(enabled bool) {
+	c.optimize = enabled
+}
+
+func (c *Compiler) Compile(node ast.Node) error { //nolint:gocognit,cyclop,funlen,gocyclo
+	if pos := ast.Pos(node); pos.Line != 0 {
+		outer := c.position
+		c.position = pos
+		defer func() { c.position = outer }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -40,50 +128,48 @@ func (c *Compiler) Compile(node ast.Node) error { //nolint:gocognit,cyclop,funle
 			return err
 		}
 		c.emit(code.OpPop)
-	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-
-			err = c.Compile(node.Left)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
-
-			c.emit(code.OpGreaterThan)
-			return nil
+		}
+	case *ast.LetStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
 		}
 
-		err := c.Compile(node.Left)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
 
-		err = c.Compile(node.Right)
+		err = c.compilePendingFinally()
 		if err != nil {
 			return err
 		}
 
-		switch node.Operator {
-		case "+":
-			c.emit(code.OpAdd)
-		case "-":
-			c.emit(code.OpSub)
-		case "*":
-			c.emit(code.OpMul)
-		case "/":
-			c.emit(code.OpDiv)
-		case ">":
-			c.emit(code.OpGreaterThan)
-		case "==":
-			c.emit(code.OpEqual)
-		case "!=":
-			c.emit(code.OpNotEqual)
-		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
 		}
+
+		c.emit(code.OpThrow)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
 		if err != nil {
@@ -98,6 +184,8 @@ func (c *Compiler) Compile(node ast.Node) error { //nolint:gocognit,cyclop,funle
 		default:
 			return fmt.Errorf("unknown operator: %s", node.Operator)
 		}
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
@@ -107,30 +195,560 @@ func (c *Compiler) Compile(node ast.Node) error { //nolint:gocognit,cyclop,funle
 		} else {
 			c.emit(code.OpFalse)
 		}
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+
+		// Map iteration order is random; sorting keeps the output stable.
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			err := c.Compile(k)
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(node.Pairs[k])
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+	case *ast.PropagateExpression:
+		return c.compilePropagateExpression(node)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+
+		c.loadSymbol(symbol)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	if node.Operator == "<" {
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpGreaterThan)
+		return nil
+	}
+
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	switch node.Operator {
+	case "+":
+		c.emit(code.OpAdd)
+	case "-":
+		c.emit(code.OpSub)
+	case "*":
+		c.emit(code.OpMul)
+	case "/":
+		c.emit(code.OpDiv)
+	case ">":
+		c.emit(code.OpGreaterThan)
+	case "==":
+		c.emit(code.OpEqual)
+	case "!=":
+		c.emit(code.OpNotEqual)
+	default:
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+
+	// Bogus offset, patched once the consequence is compiled.
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	depth := c.scopes[c.scopeIndex].depth
+
+	err = c.compileBlockValue(node.Consequence)
+	if err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.scopes[c.scopeIndex].depth = depth
+
+	afterConsequencePos := len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else {
+		err := c.compileBlockValue(node.Alternative)
+		if err != nil {
+			return err
+		}
+	}
+
+	afterAlternativePos := len(c.currentInstructions())
+	c.changeOperand(jumpPos, afterAlternativePos)
+
+	return nil
+}
+
+// compileTryExpression protects the block with up to two handlers: the catch
+// handler covers the block, the finally handler covers the block and the
+// catch clause and runs the finally clause before rethrowing. On the normal
+// path the finally clause is compiled once more after the value is computed.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error { //nolint:funlen
+	var finallyRegion, catchRegion *tryRegion
+	if node.Finally != nil {
+		finallyRegion = c.beginTryRegion(node.Finally)
+	}
+	if node.Catch != nil {
+		catchRegion = c.beginTryRegion(nil)
+	}
+
+	err := c.compileBlockValue(node.Block)
+	if err != nil {
+		return err
+	}
+
+	if catchRegion != nil {
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.endTryRegion(catchRegion)
+
+		// The handler starts with the error pushed, at the same height the
+		// block's value would be. Like the evaluator's, the catch clause has
+		// a scope of its own.
+		saved := c.symbolTable.BeginBlock()
+		symbol := c.symbolTable.Define(node.CatchParameter.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+		err := c.compileBlockValue(node.Catch)
+		if err != nil {
+			return err
+		}
+		c.symbolTable.EndBlock(saved)
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+
+	if finallyRegion != nil {
+		c.closeSegment(finallyRegion)
+		c.scopes[c.scopeIndex].tries = c.scopes[c.scopeIndex].tries[:len(c.scopes[c.scopeIndex].tries)-1]
+
+		err := c.Compile(node.Finally)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.endTryRegion(finallyRegion)
+
+		err = c.Compile(node.Finally)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpThrow)
+		c.scopes[c.scopeIndex].depth++
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+// compileBlockValue compiles block leaving its value on the stack, null when
+// it does not end with an expression.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	start := len(c.currentInstructions())
+
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) beginTryRegion(finally *ast.BlockStatement) *tryRegion {
+	scope := &c.scopes[c.scopeIndex]
+	region := &tryRegion{depth: scope.depth, start: len(scope.instructions), finally: finally}
+	scope.tries = append(scope.tries, region)
+	return region
+}
+
+func (c *Compiler) closeSegment(region *tryRegion) {
+	end := len(c.currentInstructions())
+	if region.start >= 0 && end > region.start {
+		region.segments = append(region.segments, [2]int{region.start, end})
+	}
+	region.start = -1
+}
+
+// endTryRegion emits the region's handlers, targeting the code that follows.
+// Inner regions end first, so the first matching handler is the innermost.
+func (c *Compiler) endTryRegion(region *tryRegion) {
+	c.closeSegment(region)
+
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.tries); n > 0 && scope.tries[n-1] == region {
+		scope.tries = scope.tries[:n-1]
+	}
+
+	target := len(scope.instructions)
+	for _, segment := range region.segments {
+		scope.handlers = append(scope.handlers, code.Handler{
+			Start:  segment[0],
+			End:    segment[1],
+			Target: target,
+			Depth:  region.depth,
+		})
+	}
+
+	// Execution enters the handler with the error pushed.
+	scope.depth = region.depth + 1
+}
+
+// compilePendingFinally inlines the finally clauses a return leaves, innermost
+// first. Each one runs outside its own try, so its region is closed first.
+func (c *Compiler) compilePendingFinally() error {
+	tries := c.scopes[c.scopeIndex].tries
+
+	for k := len(tries) - 1; k >= 0; k-- {
+		c.closeSegment(tries[k])
+
+		if tries[k].finally == nil {
+			continue
+		}
+
+		c.scopes[c.scopeIndex].tries = append([]*tryRegion(nil), tries[:k]...)
+		err := c.Compile(tries[k].finally)
+		c.scopes[c.scopeIndex].tries = tries
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, region := range tries {
+		region.start = len(c.currentInstructions())
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.Names(LocalScope)
+	freeNames := c.symbolTable.Names(FreeScope)
+	scope := c.reencode(c.scopes[c.scopeIndex])
+	c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  scope.instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+		Lines:         scope.lines,
+		Handlers:      scope.handlers,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
 	}
 
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
 	return nil
 }
 
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
 func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.reencode(c.scopes[c.scopeIndex])
+
 	return &Bytecode{
-		Instructions: c.instructions,
+		Instructions: scope.instructions,
 		Constants:    c.constants,
+		Builtins:     c.builtins,
+		Lines:        scope.lines,
+		Handlers:     scope.handlers,
 	}
 }
 
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
+	key, ok := keyOf(obj)
+	if ok {
+		if index, found := c.constantIndex[key]; found {
+			return index
+		}
+	}
+
 	c.constants = append(c.constants, obj)
+	if ok {
+		c.constantIndex[key] = len(c.constants) - 1
+	}
 	return len(c.constants) - 1
 }
 
-func (c *Compiler) emit(op code.Opcode, operands ...int) {
+type constantKey struct {
+	typ   object.TypeObject
+	value string
+}
+
+func keyOf(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{typ: obj.Type(), value: strconv.FormatInt(obj.Value, 10)}, true
+	case *object.String:
+		return constantKey{typ: obj.Type(), value: obj.Value}, true
+	default:
+		return constantKey{}, false
+	}
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
-	c.addInstruction(ins)
+	pos := c.addInstruction(ins)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.lines = scope.lines.Add(pos, c.position)
+
+	c.setLastInstruction(op, pos)
+	c.scopes[c.scopeIndex].depth += code.StackEffect(op, operands...)
+
+	return pos
 }
 
 func (c *Compiler) addInstruction(ins []byte) int {
-	posNewInstruction := len(c.instructions)
-	c.instructions = append(c.instructions, ins...)
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
 	return posNewInstruction
 }
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Truncate(last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.scopes[c.scopeIndex].depth++
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := range newInstruction {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// compilePropagateExpression returns error values from the current function,
+// running any pending finally blocks on the way out.
+func (c *Compiler) compilePropagateExpression(node *ast.PropagateExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJumpNotError, 9999)
+
+	err = c.compilePendingFinally()
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpReturnValue)
+	c.scopes[c.scopeIndex].depth++
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// changeOperand patches the jump at opPos. A target too far for the jump's
+// operand is kept aside, since widening the jump here would move code that
+// is already referenced by offset.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	if code.Opcode(newInstruction[0]) == code.OpWide {
+		scope := &c.scopes[c.scopeIndex]
+		if scope.farJumps == nil {
+			scope.farJumps = make(map[int]int)
+		}
+		scope.farJumps[opPos] = operand
+		return
+	}
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func newCompilationScope() CompilationScope {
+	return CompilationScope{
+		instructions: code.Instructions{},
+	}
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, newCompilationScope())
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
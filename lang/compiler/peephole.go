@@ -0,0 +1,288 @@
+package compiler
+
+import (
+	"maps"
+	"slices"
+
+	"llc/lang/code"
+	"llc/lang/object"
+)
+
+// instruction is one decoded instruction of the peephole pass. origins are
+// the offsets in the original code that now resolve to this instruction:
+// its own, plus those of removed instructions right before it.
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	origins  []int
+}
+
+// peepholeRule rewrites a run of instructions matching pattern. rewrite may
+// decline by returning false. Instructions after the first of a match are
+// never jump targets or handler boundaries, so a rewrite only has to
+// preserve what the run does, not where control may enter it.
+type peepholeRule struct {
+	pattern []code.Opcode
+	rewrite func(c *Compiler, run []instruction) ([]instruction, bool)
+}
+
+var peepholeRules = []peepholeRule{
+	{[]code.Opcode{code.OpConstant, code.OpMinus}, negateConstant},
+	{[]code.Opcode{code.OpTrue, code.OpBang}, replaceWith(code.OpFalse)},
+	{[]code.Opcode{code.OpFalse, code.OpBang}, replaceWith(code.OpTrue)},
+	{[]code.Opcode{code.OpTrue, code.OpJumpNotTruthy}, replaceWith()},
+	{[]code.Opcode{code.OpFalse, code.OpJumpNotTruthy}, alwaysJump},
+	{[]code.Opcode{code.OpConstant, code.OpAdd}, fuseOperand(code.OpAddConst)},
+	{[]code.Opcode{code.OpConstant, code.OpSub}, fuseOperand(code.OpSubConst)},
+	{[]code.Opcode{code.OpGetLocal, code.OpAdd}, fuseOperand(code.OpGetLocalAdd)},
+}
+
+func replaceWith(ops ...code.Opcode) func(*Compiler, []instruction) ([]instruction, bool) {
+	return func(*Compiler, []instruction) ([]instruction, bool) {
+		out := make([]instruction, len(ops))
+		for i, op := range ops {
+			out[i] = instruction{op: op}
+		}
+		return out, true
+	}
+}
+
+func fuseOperand(op code.Opcode) func(*Compiler, []instruction) ([]instruction, bool) {
+	return func(_ *Compiler, run []instruction) ([]instruction, bool) {
+		return []instruction{{op: op, operands: run[0].operands}}, true
+	}
+}
+
+func negateConstant(c *Compiler, run []instruction) ([]instruction, bool) {
+	integer, ok := c.constants[run[0].operands[0]].(*object.Integer)
+	if !ok {
+		return nil, false
+	}
+
+	index := c.addConstant(&object.Integer{Value: -integer.Value})
+	return []instruction{{op: code.OpConstant, operands: []int{index}}}, true
+}
+
+func alwaysJump(_ *Compiler, run []instruction) ([]instruction, bool) {
+	return []instruction{{op: code.OpJump, operands: run[1].operands}}, true
+}
+
+// reencode decodes a finished scope's instructions, applies peepholeRules
+// until none matches if the peephole pass is on, and encodes the result,
+// moving jump targets, line table entries and handlers along.
+// Jumps in farJumps get their real targets, encoded as wide as they need.
+// The scope is returned with its code replaced.
+func (c *Compiler) reencode(scope CompilationScope) CompilationScope {
+	if !c.optimize && len(scope.farJumps) == 0 {
+		return scope
+	}
+
+	list, labels, ok := decodeInstructions(scope.instructions, scope.handlers, scope.farJumps)
+	if !ok {
+		return scope
+	}
+
+	for changed := c.optimize; changed; {
+		list, changed = c.applyRules(list, labels)
+	}
+
+	offsets := layout(list, len(scope.instructions))
+
+	scope.instructions = encodeInstructions(list, offsets)
+	scope.lines = moveLines(scope.lines, offsets)
+	scope.handlers = moveHandlers(scope.handlers, offsets)
+	scope.farJumps = nil
+
+	return scope
+}
+
+// applyRules makes one pass over list, rewriting every run that matches a
+// rule, and reports whether any did.
+func (c *Compiler) applyRules(list []instruction, labels map[int]bool) ([]instruction, bool) {
+	out := make([]instruction, 0, len(list))
+	changed := false
+	// carried are the origins of a removed run, which now falls through to
+	// the instruction after it.
+	var carried []int
+
+	for i := 0; i < len(list); {
+		replacement, n := c.rewrite(list, i, labels)
+		if n == 0 {
+			in := list[i]
+			if carried != nil {
+				in.origins = append(carried, in.origins...)
+				carried = nil
+			}
+			out = append(out, in)
+			i++
+			continue
+		}
+
+		origins := carried
+		carried = nil
+		for _, in := range list[i : i+n] {
+			origins = append(origins, in.origins...)
+		}
+
+		if len(replacement) == 0 {
+			carried = origins
+		} else {
+			replacement[0].origins = origins
+			out = append(out, replacement...)
+		}
+
+		changed = true
+		i += n
+	}
+
+	return out, changed
+}
+
+// rewrite applies the first rule matching at i and returns its replacement
+// and the length of the run it replaces, which is 0 if none applies.
+func (c *Compiler) rewrite(list []instruction, i int, labels map[int]bool) ([]instruction, int) {
+	for _, rule := range peepholeRules {
+		run, ok := match(list, i, rule.pattern, labels)
+		if !ok {
+			continue
+		}
+
+		replacement, ok := rule.rewrite(c, run)
+		if !ok {
+			continue
+		}
+
+		// A removed run needs an instruction after it to fall through to.
+		if len(replacement) == 0 && i+len(run) == len(list) {
+			continue
+		}
+
+		return replacement, len(run)
+	}
+
+	return nil, 0
+}
+
+func match(list []instruction, i int, pattern []code.Opcode, labels map[int]bool) ([]instruction, bool) {
+	if i+len(pattern) > len(list) {
+		return nil, false
+	}
+
+	run := list[i : i+len(pattern)]
+	for j, op := range pattern {
+		if run[j].op != op {
+			return nil, false
+		}
+
+		if j > 0 && slices.ContainsFunc(run[j].origins, func(o int) bool { return labels[o] }) {
+			return nil, false
+		}
+	}
+
+	return run, true
+}
+
+// decodeInstructions splits ins into instructions and collects the offsets
+// control can reach other than by falling through.
+func decodeInstructions(
+	ins code.Instructions, handlers []code.Handler, farJumps map[int]int,
+) ([]instruction, map[int]bool, bool) {
+	var list []instruction
+	labels := make(map[int]bool)
+
+	for i := 0; i < len(ins); {
+		_, operands, width, err := ins.Decode(i)
+		if err != nil {
+			return nil, nil, false
+		}
+
+		op := ins.Opcode(i)
+		if isJump(op) {
+			if target, ok := farJumps[i]; ok {
+				operands[0] = target
+			}
+			labels[operands[0]] = true
+		}
+
+		list = append(list, instruction{op: op, operands: operands, origins: []int{i}})
+		i += width
+	}
+
+	for _, h := range handlers {
+		labels[h.Start] = true
+		labels[h.End] = true
+		labels[h.Target] = true
+	}
+
+	return list, labels, true
+}
+
+// layout maps the offset of every instruction of the original code, and
+// its end at oldLen, to where it ends up once list is encoded. A jump's
+// width depends on where its target ends up, so offsets are laid out again
+// until they settle. They only ever grow, starting from every jump being
+// narrow.
+func layout(list []instruction, oldLen int) map[int]int {
+	offsets := map[int]int{}
+	for {
+		next := make(map[int]int, len(list)+1)
+		pos := 0
+		for _, in := range list {
+			for _, origin := range in.origins {
+				next[origin] = pos
+			}
+
+			operands := in.operands
+			if isJump(in.op) {
+				operands = []int{offsets[operands[0]]}
+			}
+			pos += len(code.Make(in.op, operands...))
+		}
+		next[oldLen] = pos
+
+		if maps.Equal(next, offsets) {
+			return offsets
+		}
+		offsets = next
+	}
+}
+
+func encodeInstructions(list []instruction, offsets map[int]int) code.Instructions {
+	out := code.Instructions{}
+	for _, in := range list {
+		operands := in.operands
+		if isJump(in.op) {
+			operands = []int{offsets[operands[0]]}
+		}
+		out = append(out, code.Make(in.op, operands...)...)
+	}
+	return out
+}
+
+// moveLines moves every entry of lines along. Entries of instructions that
+// were fused or removed land on the same offset as the instruction taking
+// their place, and the last of them wins.
+func moveLines(lines code.LineTable, offsets map[int]int) code.LineTable {
+	var moved code.LineTable
+	for _, line := range lines {
+		moved = moved.Add(offsets[line.Offset], line.Position)
+	}
+	return moved
+}
+
+func moveHandlers(handlers []code.Handler, offsets map[int]int) []code.Handler {
+	var moved []code.Handler
+	for _, h := range handlers {
+		moved = append(moved, code.Handler{
+			Start:  offsets[h.Start],
+			End:    offsets[h.End],
+			Target: offsets[h.Target],
+			Depth:  h.Depth,
+		})
+	}
+	return moved
+}
+
+func isJump(op code.Opcode) bool {
+	return op == code.OpJump || op == code.OpJumpNotTruthy || op == code.OpJumpNotError
+}
@@ -0,0 +1,140 @@
+package compiler
+
+import (
+	"testing"
+
+	"llc/lang/code"
+)
+
+func TestPeephole(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "-5",
+			expectedConstants: []interface{}{5, -5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!true; !false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 7),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (false) { 10 } else { 20 }",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpJump, 9),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 12),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a, b) { a + 1; a - 2; a + b }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAddConst, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSubConst, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalAdd, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The OpAdd is where the consequence jumps to, so the local read
+			// by the alternative must not be fused into it.
+			input: "fn(a, c) { a + if (c) { 1 } else { a } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpJumpNotTruthy, 13),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpJump, 15),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for i := range tests {
+		tests[i].peephole = true
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestPeepholeMovesCallSitesAndHandlers(t *testing.T) {
+	compiler := New()
+	compiler.SetPeephole(true)
+
+	err := compiler.Compile(parse(`!true; try { !false; len("a") } catch (e) { e }`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	expected := []code.Instructions{
+		code.Make(code.OpFalse),
+		code.Make(code.OpPop),
+		code.Make(code.OpTrue),
+		code.Make(code.OpPop),
+		code.Make(code.OpGetBuiltin, 0),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpCall, 1),
+		code.Make(code.OpJump, 20),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpPop),
+	}
+	if err := testInstructions(expected, bytecode.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	if pos, ok := bytecode.Lines.Lookup(9); !ok || pos.String() != "1:25" {
+		t.Errorf("call position not moved. got=%v", bytecode.Lines)
+	}
+
+	if len(bytecode.Handlers) != 1 || bytecode.Handlers[0] != (code.Handler{Start: 2, End: 14, Target: 14}) {
+		t.Errorf("handler not moved. got=%+v", bytecode.Handlers)
+	}
+}
@@ -0,0 +1,132 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	FreeSymbols    []Symbol
+	numDefinitions int
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol), FreeSymbols: []Symbol{}}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// BeginBlock and EndBlock scope the names defined between them to a block,
+// such as a catch clause: they get slots of their own, and EndBlock makes the
+// names they hid visible again.
+func (s *SymbolTable) BeginBlock() map[string]Symbol {
+	saved := make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		saved[name] = symbol
+	}
+	return saved
+}
+
+func (s *SymbolTable) EndBlock(saved map[string]Symbol) {
+	for name, symbol := range s.store {
+		if symbol.Scope != GlobalScope && symbol.Scope != LocalScope {
+			continue
+		}
+
+		if previous, ok := saved[name]; !ok {
+			delete(s.store, name)
+		} else if previous != symbol {
+			s.store[name] = previous
+		}
+	}
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		symbol, ok = s.Outer.Resolve(name)
+		if !ok {
+			return symbol, ok
+		}
+
+		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+			return symbol, ok
+		}
+
+		return s.defineFree(symbol), true
+	}
+
+	return symbol, ok
+}
+
+// Names returns the names defined directly in this table for scope, indexed
+// by slot. Slots whose name was later shadowed are left empty.
+func (s *SymbolTable) Names(scope SymbolScope) []string {
+	if scope == FreeScope {
+		names := make([]string, len(s.FreeSymbols))
+		for i, symbol := range s.FreeSymbols {
+			names[i] = symbol.Name
+		}
+		return names
+	}
+
+	names := make([]string, s.numDefinitions)
+	for _, symbol := range s.store {
+		if symbol.Scope == scope && symbol.Index < len(names) {
+			names[symbol.Index] = symbol.Name
+		}
+	}
+
+	return names
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
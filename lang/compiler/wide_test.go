@@ -0,0 +1,54 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"llc/lang/code"
+)
+
+func TestFarJumps(t *testing.T) {
+	body := strings.Repeat("1; ", 20000)
+	input := "if (true) { " + body + "2 } else { 3 }; 4"
+
+	for _, peephole := range []bool{false, true} {
+		compiler := New()
+		compiler.SetPeephole(peephole)
+		if err := compiler.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		ins := compiler.Bytecode().Instructions
+		starts := map[int]bool{len(ins): true}
+		var targets []int
+		wide := 0
+
+		for i := 0; i < len(ins); {
+			_, operands, width, err := ins.Decode(i)
+			if err != nil {
+				t.Fatalf("offset %d: %s", i, err)
+			}
+
+			switch ins.Opcode(i) {
+			case code.OpJump, code.OpJumpNotTruthy:
+				targets = append(targets, operands[0])
+				if code.Opcode(ins[i]) == code.OpWide {
+					wide++
+				}
+			}
+
+			starts[i] = true
+			i += width
+		}
+
+		if wide == 0 {
+			t.Errorf("peephole=%t: no jump was widened", peephole)
+		}
+
+		for _, target := range targets {
+			if target <= 0xFFFF || !starts[target] {
+				t.Errorf("peephole=%t: bad jump target %d", peephole, target)
+			}
+		}
+	}
+}
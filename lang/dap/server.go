@@ -0,0 +1,473 @@
+// Package dap serves the Debug Adapter Protocol, so that editors can debug
+// llc scripts run by the tree-walking evaluator. The server follows the
+// script through the host's Debugger hook, and stops and steps it with a
+// debugger.Stepper like llc debug does.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"llc/lang/ast"
+	"llc/lang/debugger"
+	"llc/lang/evaluator"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+)
+
+// threadID is the one thread scripts run on.
+const threadID = 1
+
+var errNotStopped = errors.New("the script is not stopped")
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu sync.Mutex
+	seq     int
+
+	// These are only used by the goroutine serving requests.
+	launch     *launchArguments
+	program    *ast.Program
+	configured bool
+	started    bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+	resume     chan error
+
+	mu      sync.Mutex
+	stepper debugger.Stepper
+	// entry is set until the script reports its first line.
+	entry bool
+	// stopping makes the script stop at its next line.
+	stopping bool
+	exitCode int
+	// state is the script's state while it is stopped, and nil otherwise.
+	state object.DebugState
+	// references are what variablesReference n stands for while the script
+	// is stopped, at index n-1: the variables in scope or a value to expand.
+	references []any
+}
+
+// New returns a server reading requests from in and writing responses and
+// events to out.
+func New(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		resume: make(chan error),
+	}
+}
+
+// Serve handles requests until the client disconnects or in ends, and then
+// stops the script if it is still running.
+func (s *Server) Serve() error {
+	defer s.stop()
+
+	for {
+		msg, err := ReadMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Type == "request" && s.handle(msg) {
+			return nil
+		}
+	}
+}
+
+// handle answers req and reports whether the client disconnected. Work that
+// must not happen before the response, such as resuming the script, is done
+// after sending it.
+func (s *Server) handle(req *Message) bool { //nolint:cyclop
+	var (
+		body  any
+		after func()
+		err   error
+	)
+
+	switch req.Command {
+	case "initialize":
+		body = map[string]any{"supportsConfigurationDoneRequest": true}
+		after = func() { s.sendEvent("initialized", nil) }
+	case "launch":
+		err = s.launchScript(req.Arguments)
+		after = s.start
+	case "configurationDone":
+		s.configured = true
+		after = s.start
+	case "setBreakpoints":
+		body, err = s.setBreakpoints(req.Arguments)
+	case "threads":
+		body = map[string]any{"threads": []map[string]any{{"id": threadID, "name": "main"}}}
+	case "stackTrace":
+		body, err = s.stackTrace()
+	case "scopes":
+		body, err = s.scopes(req.Arguments)
+	case "variables":
+		body, err = s.variables(req.Arguments)
+	case "evaluate":
+		body, err = s.evaluate(req.Arguments)
+	case "continue":
+		body = map[string]any{"allThreadsContinued": true}
+		after, err = s.resumeScript(debugger.Continue)
+	case "next":
+		after, err = s.resumeScript(debugger.Next)
+	case "stepIn":
+		after, err = s.resumeScript(debugger.Step)
+	case "stepOut":
+		after, err = s.resumeScript(debugger.Out)
+	case "disconnect", "terminate":
+		after = s.stop
+	default:
+		err = fmt.Errorf("unsupported request %q", req.Command)
+	}
+
+	s.respond(req, body, err)
+	if after != nil && err == nil {
+		after()
+	}
+
+	return req.Command == "disconnect"
+}
+
+func (s *Server) launchScript(arguments json.RawMessage) error {
+	var args launchArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("parse errors in %s: %s", args.Program, strings.Join(p.Errors(), "; "))
+	}
+
+	s.launch, s.program = &args, program
+
+	s.mu.Lock()
+	s.entry = args.StopOnEntry
+	if !args.StopOnEntry {
+		s.stepper.Resume(debugger.Continue)
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// start runs the launched script once the client is done configuring it.
+func (s *Server) start() {
+	if s.launch == nil || !s.configured || s.started {
+		return
+	}
+	s.started = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+
+	host := &object.Host{
+		Stdin:    strings.NewReader(""),
+		Stdout:   &output{s, "stdout"},
+		Stderr:   &output{s, "stderr"},
+		Args:     s.launch.Args,
+		Debugger: s,
+		// exit only ends the debug session, never the adapter's process.
+		Capabilities: object.CapExit,
+		Exit: func(code int) {
+			s.mu.Lock()
+			s.exitCode, s.stopping = code, true
+			s.mu.Unlock()
+			cancel()
+		},
+	}
+
+	go func() {
+		defer close(s.done)
+
+		result := evaluator.EvalContext(ctx, s.program, object.NewEnvironmentWithHost(host))
+
+		s.mu.Lock()
+		stopping, exitCode := s.stopping, s.exitCode
+		s.mu.Unlock()
+
+		if errObj, ok := result.(*object.Error); ok && !stopping {
+			message := errObj.Inspect() + "\n"
+			if len(errObj.Stack) != 0 {
+				message += errObj.StackTrace()
+			}
+			s.sendEvent("output", map[string]any{"category": "stderr", "output": message})
+			exitCode = 1
+		}
+
+		s.sendEvent("exited", map[string]any{"exitCode": exitCode})
+		s.sendEvent("terminated", nil)
+	}()
+}
+
+// stop ends the script, if it is running, and waits for it.
+func (s *Server) stop() {
+	if !s.started {
+		return
+	}
+
+	s.mu.Lock()
+	s.stopping = true
+	stopped := s.state != nil
+	s.state = nil
+	s.mu.Unlock()
+
+	if stopped {
+		s.resume <- object.ErrStopped
+	}
+	s.cancel()
+	<-s.done
+}
+
+// Line implements object.Debugger for the launched script. When the script
+// stops, it tells the client and waits for a request resuming it.
+func (s *Server) Line(state object.DebugState) error {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return object.ErrStopped
+	}
+
+	entry := s.entry
+	s.entry = false
+	if !s.stepper.Follow(state) {
+		s.mu.Unlock()
+		return nil
+	}
+
+	reason := "step"
+	if entry {
+		reason = "entry"
+	} else if s.stepper.Breakpoint(state.Position().Line) {
+		reason = "breakpoint"
+	}
+	s.state, s.references = state, nil
+	s.mu.Unlock()
+
+	s.sendEvent("stopped", map[string]any{"reason": reason, "threadId": threadID, "allThreadsStopped": true})
+	return <-s.resume
+}
+
+func (s *Server) resumeScript(mode debugger.Mode) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return nil, errNotStopped
+	}
+
+	s.stepper.Resume(mode)
+	s.state, s.references = nil, nil
+	return func() { s.resume <- nil }, nil
+}
+
+func (s *Server) setBreakpoints(arguments json.RawMessage) (any, error) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	breakpoints := []breakpoint{}
+	s.stepper.Clear(0)
+	for _, b := range args.Breakpoints {
+		s.stepper.Break(b.Line)
+		breakpoints = append(breakpoints, breakpoint{Verified: true, Line: b.Line})
+	}
+
+	return map[string]any{"breakpoints": breakpoints}, nil
+}
+
+func (s *Server) stackTrace() (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return nil, errNotStopped
+	}
+
+	src := source{Name: filepath.Base(s.launch.Program), Path: s.launch.Program}
+	frames := []stackFrame{}
+	for i, f := range s.stepper.Frames() {
+		name := f.Function
+		if name == "" {
+			name = "main"
+		}
+		frames = append(frames, stackFrame{
+			ID: i, Name: name, Source: src, Line: f.Position.Line, Column: f.Position.Column,
+		})
+	}
+
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// scopes gives the innermost frame one scope with every variable it can
+// refer to. The engines do not show the variables of the other frames.
+func (s *Server) scopes(arguments json.RawMessage) (any, error) {
+	var args frameArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return nil, errNotStopped
+	}
+
+	scopes := []scope{}
+	if args.FrameID == 0 {
+		scopes = append(scopes, scope{Name: "Variables", VariablesReference: s.reference(s.state.Variables())})
+	}
+
+	return map[string]any{"scopes": scopes}, nil
+}
+
+func (s *Server) variables(arguments json.RawMessage) (any, error) {
+	var args variablesArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return nil, errNotStopped
+	}
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.references) {
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+
+	variables := []variable{}
+	switch ref := s.references[args.VariablesReference-1].(type) {
+	case []object.Variable:
+		for _, v := range ref {
+			variables = append(variables, s.variable(v.Name, v.Value))
+		}
+	case *object.Array:
+		for i, element := range ref.Elements {
+			variables = append(variables, s.variable(fmt.Sprintf("[%d]", i), element))
+		}
+	case *object.Hash:
+		for _, pair := range ref.Pairs {
+			variables = append(variables, s.variable(pair.Key.Inspect(), pair.Value))
+		}
+		sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+	}
+
+	return map[string]any{"variables": variables}, nil
+}
+
+func (s *Server) evaluate(arguments json.RawMessage) (any, error) {
+	var args evaluateArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	state := s.state
+	s.mu.Unlock()
+
+	if state == nil {
+		return nil, errNotStopped
+	}
+
+	// The script stays stopped until this goroutine resumes it, but the
+	// lock is not held while script functions run.
+	result, err := debugger.Evaluate(args.Expression, state)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := s.variable("", result)
+	return map[string]any{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference}, nil
+}
+
+// variable describes value, giving arrays and hashes a reference to expand
+// them by. s.mu must be held.
+func (s *Server) variable(name string, value object.Object) variable {
+	v := variable{Name: name, Value: debugger.Describe(value), Type: string(value.Type())}
+
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) != 0 {
+			v.VariablesReference = s.reference(value)
+		}
+	case *object.Hash:
+		if len(value.Pairs) != 0 {
+			v.VariablesReference = s.reference(value)
+		}
+	}
+
+	return v
+}
+
+// reference returns a variablesReference standing for ref until the script
+// resumes. s.mu must be held.
+func (s *Server) reference(ref any) int {
+	s.references = append(s.references, ref)
+	return len(s.references)
+}
+
+func (s *Server) respond(req *Message, body any, err error) {
+	resp := &response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		resp.Message, resp.Body = err.Error(), nil
+	}
+	s.send(func(seq int) any { resp.Seq = seq; return resp })
+}
+
+func (s *Server) sendEvent(name string, body any) {
+	s.send(func(seq int) any { return &event{Seq: seq, Type: "event", Event: name, Body: body} })
+}
+
+// send writes the message made for the next sequence number. Messages come
+// from both the goroutine serving requests and the script's.
+func (s *Server) send(message func(seq int) any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	_ = WriteMessage(s.out, message(s.seq))
+}
+
+// output sends what the script writes to a stream as output events.
+type output struct {
+	s        *Server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.s.sendEvent("output", map[string]any{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
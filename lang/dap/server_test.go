@@ -0,0 +1,387 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// client is a scripted DAP client talking to a Server over pipes.
+type client struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	seq    int
+	events []*Message
+	output strings.Builder
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	c := &client{t: t, w: requestWriter, r: bufio.NewReader(responseReader), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- New(requests, responses).Serve()
+		_ = responses.Close()
+	}()
+
+	return c
+}
+
+func (c *client) send(command string, arguments any) {
+	c.t.Helper()
+
+	c.seq++
+	req := &Request{Seq: c.seq, Type: "request", Command: command, Arguments: arguments}
+	if err := WriteMessage(c.w, req); err != nil {
+		c.t.Fatalf("writing %s: %s", command, err)
+	}
+}
+
+func (c *client) read() *Message {
+	c.t.Helper()
+
+	msg, err := ReadMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("reading: %s", err)
+	}
+	c.collect(msg)
+	return msg
+}
+
+// collect keeps what the script printed.
+func (c *client) collect(msg *Message) {
+	if msg.Type == "event" && msg.Event == "output" {
+		var body struct{ Output string }
+		_ = json.Unmarshal(msg.Body, &body)
+		c.output.WriteString(body.Output)
+	}
+}
+
+// request sends a request and decodes the body of its successful response
+// into body if that is not nil.
+func (c *client) request(command string, arguments any, body any) {
+	c.t.Helper()
+
+	c.send(command, arguments)
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+
+		if msg.Command != command || msg.RequestSeq != c.seq {
+			c.t.Fatalf("got response to %s (%d), want %s (%d)", msg.Command, msg.RequestSeq, command, c.seq)
+		}
+		if !msg.Success {
+			c.t.Fatalf("%s failed: %s", command, msg.Message)
+		}
+		if body != nil {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("decoding %s: %s", command, err)
+			}
+		}
+		return
+	}
+}
+
+// fail sends a request that must fail and returns its message.
+func (c *client) fail(command string, arguments any) string {
+	c.t.Helper()
+
+	c.send(command, arguments)
+	msg := c.read()
+	if msg.Type != "response" || msg.Success {
+		c.t.Fatalf("expected %s to fail, got %+v", command, msg)
+	}
+	return msg.Message
+}
+
+// event waits for the next event called name, and decodes its body into
+// body if that is not nil.
+func (c *client) event(name string, body any) {
+	c.t.Helper()
+
+	for {
+		var msg *Message
+		if len(c.events) != 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Type != "event" || msg.Event != name {
+			continue
+		}
+
+		if body != nil {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("decoding %s: %s", name, err)
+			}
+		}
+		return
+	}
+}
+
+func (c *client) stopped(reason string) {
+	c.t.Helper()
+
+	var body struct{ Reason string }
+	c.event("stopped", &body)
+	if body.Reason != reason {
+		c.t.Fatalf("stopped for %q, want %q", body.Reason, reason)
+	}
+}
+
+func (c *client) launch(source string, stopOnEntry bool, breakpoints ...int) string {
+	c.t.Helper()
+
+	path := filepath.Join(c.t.TempDir(), "script.llc")
+	if err := os.WriteFile(path, []byte(source), 0o600); err != nil {
+		c.t.Fatal(err)
+	}
+
+	lines := []map[string]int{}
+	for _, line := range breakpoints {
+		lines = append(lines, map[string]int{"line": line})
+	}
+
+	c.request("initialize", map[string]any{"adapterID": "llc"}, nil)
+	c.event("initialized", nil)
+	c.request("launch", map[string]any{"program": path, "stopOnEntry": stopOnEntry}, nil)
+	c.request("setBreakpoints", map[string]any{"source": map[string]string{"path": path}, "breakpoints": lines}, nil)
+	c.request("configurationDone", nil, nil)
+
+	return path
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+
+	c.request("disconnect", nil, nil)
+	// The script's last events may still come, until the server is done.
+	for {
+		msg, err := ReadMessage(c.r)
+		if err != nil {
+			break
+		}
+		c.collect(msg)
+	}
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("serve: %s", err)
+	}
+}
+
+type frames struct {
+	StackFrames []struct {
+		Name string
+		Line int
+	}
+}
+
+type variables struct {
+	Variables []struct {
+		Name               string
+		Value              string
+		VariablesReference int
+	}
+}
+
+func (v variables) String() string {
+	var out []string
+	for _, v := range v.Variables {
+		out = append(out, v.Name+"="+v.Value)
+	}
+	return strings.Join(out, " ")
+}
+
+const program = `let double = fn(n) {
+  let m = n * 2;
+  m
+};
+let xs = [1, double(2)];
+print(xs);
+double(5);`
+
+func TestBreakpointsAndInspection(t *testing.T) {
+	c := newClient(t)
+	c.launch(program, false, 3)
+	c.stopped("breakpoint")
+
+	var stack frames
+	c.request("stackTrace", map[string]any{"threadId": 1}, &stack)
+	if len(stack.StackFrames) != 2 || stack.StackFrames[0].Name != "double" || stack.StackFrames[0].Line != 3 ||
+		stack.StackFrames[1].Name != "main" || stack.StackFrames[1].Line != 5 {
+		t.Fatalf("wrong stack: %+v", stack)
+	}
+
+	var scopes struct {
+		Scopes []struct{ VariablesReference int }
+	}
+	c.request("scopes", map[string]any{"frameId": 0}, &scopes)
+	if len(scopes.Scopes) != 1 {
+		t.Fatalf("wrong scopes: %+v", scopes)
+	}
+
+	var vars variables
+	c.request("variables", map[string]any{"variablesReference": scopes.Scopes[0].VariablesReference}, &vars)
+	if vars.String() != "m=4 n=2 double=fn double" {
+		t.Errorf("wrong variables: %s", vars)
+	}
+
+	var result struct {
+		Result             string
+		VariablesReference int
+	}
+	c.request("evaluate", map[string]any{"expression": "m + n", "frameId": 0}, &result)
+	if result.Result != "6" {
+		t.Errorf("wrong result: %q", result.Result)
+	}
+
+	c.request("next", map[string]any{"threadId": 1}, nil)
+	c.stopped("step")
+	c.request("stackTrace", map[string]any{"threadId": 1}, &stack)
+	if len(stack.StackFrames) != 1 || stack.StackFrames[0].Line != 6 {
+		t.Fatalf("wrong stack after next: %+v", stack)
+	}
+
+	c.request("evaluate", map[string]any{"expression": "xs", "frameId": 0}, &result)
+	if result.Result != "[1, 4]" || result.VariablesReference == 0 {
+		t.Fatalf("wrong result: %+v", result)
+	}
+	c.request("variables", map[string]any{"variablesReference": result.VariablesReference}, &vars)
+	if vars.String() != "[0]=1 [1]=4" {
+		t.Errorf("wrong elements: %s", vars)
+	}
+
+	c.request("continue", map[string]any{"threadId": 1}, nil)
+	c.stopped("breakpoint")
+	if c.output.String() != "[1, 4]\n" {
+		t.Errorf("wrong output: %q", c.output.String())
+	}
+
+	c.disconnect()
+}
+
+func TestEvaluateCallsScriptFunctions(t *testing.T) {
+	c := newClient(t)
+	c.launch(program, false, 3)
+	c.stopped("breakpoint")
+
+	var result struct{ Result string }
+	c.request("evaluate", map[string]any{"expression": "double(20) + m", "frameId": 0}, &result)
+	if result.Result != "44" {
+		t.Errorf("wrong result: %q", result.Result)
+	}
+
+	var stack frames
+	c.request("stackTrace", map[string]any{"threadId": 1}, &stack)
+	if len(stack.StackFrames) != 2 || stack.StackFrames[0].Line != 3 {
+		t.Fatalf("wrong stack after evaluate: %+v", stack)
+	}
+
+	c.request("continue", map[string]any{"threadId": 1}, nil)
+	c.stopped("breakpoint")
+	c.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+	c := newClient(t)
+	c.launch(program, true)
+	c.stopped("entry")
+
+	expected := []struct {
+		command string
+		line    int
+	}{
+		{"next", 5},
+		{"stepIn", 2},
+		{"stepOut", 6},
+		{"stepIn", 7},
+		{"stepIn", 2},
+		{"next", 3},
+	}
+
+	for _, tt := range expected {
+		c.request(tt.command, map[string]any{"threadId": 1}, nil)
+		c.stopped("step")
+
+		var stack frames
+		c.request("stackTrace", map[string]any{"threadId": 1}, &stack)
+		if stack.StackFrames[0].Line != tt.line {
+			t.Fatalf("%s stopped at line %d, want %d", tt.command, stack.StackFrames[0].Line, tt.line)
+		}
+	}
+
+	c.request("continue", map[string]any{"threadId": 1}, nil)
+	var exited struct{ ExitCode int }
+	c.event("exited", &exited)
+	c.event("terminated", nil)
+	if exited.ExitCode != 0 {
+		t.Errorf("wrong exit code: %d", exited.ExitCode)
+	}
+
+	c.disconnect()
+}
+
+func TestScriptErrorsAndExit(t *testing.T) {
+	tests := []struct {
+		source   string
+		exitCode int
+		output   string
+	}{
+		{"let a = 1;\nlet b = a + true;", 1, "Error: type mismatch: INTEGER + BOOLEAN\n"},
+		{"print(1);\nexit(3);\nprint(2);", 3, "1\n"},
+	}
+
+	for _, tt := range tests {
+		c := newClient(t)
+		c.launch(tt.source, false)
+
+		var exited struct{ ExitCode int }
+		c.event("exited", &exited)
+		c.event("terminated", nil)
+		if exited.ExitCode != tt.exitCode {
+			t.Errorf("wrong exit code: %d, want %d", exited.ExitCode, tt.exitCode)
+		}
+		if c.output.String() != tt.output {
+			t.Errorf("wrong output: %q, want %q", c.output.String(), tt.output)
+		}
+
+		c.disconnect()
+	}
+}
+
+func TestRequestsNeedAStoppedScript(t *testing.T) {
+	c := newClient(t)
+
+	for _, command := range []string{"continue", "stackTrace", "evaluate"} {
+		if message := c.fail(command, map[string]any{"threadId": 1}); message != errNotStopped.Error() {
+			t.Errorf("%s: wrong message %q", command, message)
+		}
+	}
+	if message := c.fail("attach", nil); message != `unsupported request "attach"` {
+		t.Errorf("wrong message %q", message)
+	}
+
+	c.disconnect()
+}
+
+func TestDisconnectStopsTheScript(t *testing.T) {
+	c := newClient(t)
+	c.launch("let i = 0;\nprint(i);", true)
+	c.stopped("entry")
+	c.disconnect()
+
+	if strings.Contains(c.output.String(), "0") {
+		t.Errorf("script kept running: %q", c.output.String())
+	}
+}
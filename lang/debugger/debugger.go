@@ -0,0 +1,204 @@
+// Package debugger is an interactive debugger for llc scripts. A Session is
+// installed as the Debugger of the Host running a script. Whenever the
+// script reaches a breakpoint or finishes a step, the session reads commands
+// from its input until one resumes the script.
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"llc/lang/object"
+)
+
+type Session struct {
+	Stepper
+
+	source []string
+	in     *bufio.Scanner
+	out    io.Writer
+	// lastInput is repeated when an empty line is entered.
+	lastInput string
+}
+
+// New returns a session for a script with the given source, reading
+// commands from in and writing to out. The session stops before the first
+// line of the script.
+func New(source string, in io.Reader, out io.Writer) *Session {
+	return &Session{
+		source: strings.Split(source, "\n"),
+		in:     bufio.NewScanner(in),
+		out:    out,
+	}
+}
+
+// Line stops the script if it reached a breakpoint or finished a step, and
+// reads commands until one resumes it.
+func (s *Session) Line(state object.DebugState) error {
+	if !s.Follow(state) {
+		return nil
+	}
+
+	s.printLocation(state)
+	return s.prompt(state)
+}
+
+// prompt reads commands until one resumes the script. Running out of input
+// ends the script.
+func (s *Session) prompt(state object.DebugState) error {
+	for {
+		_, _ = fmt.Fprint(s.out, "(llc) ")
+		if !s.in.Scan() {
+			_, _ = fmt.Fprintln(s.out)
+			return object.ErrStopped
+		}
+
+		input := strings.TrimSpace(s.in.Text())
+		if input == "" {
+			input = s.lastInput
+		}
+		s.lastInput = input
+
+		resume, err := s.command(state, input)
+		if resume || err != nil {
+			return err
+		}
+	}
+}
+
+// command runs one command and reports whether it resumes the script.
+func (s *Session) command(state object.DebugState, input string) (bool, error) { //nolint:cyclop
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "":
+		return false, nil
+	case "c", "continue":
+		s.Resume(Continue)
+		return true, nil
+	case "s", "step":
+		s.Resume(Step)
+		return true, nil
+	case "n", "next":
+		s.Resume(Next)
+		return true, nil
+	case "o", "out":
+		s.Resume(Out)
+		return true, nil
+	case "b", "break":
+		s.breakCommand(arg)
+	case "clear":
+		s.clearCommand(arg)
+	case "bt", "stack":
+		s.printStack()
+	case "l", "locals":
+		for _, v := range state.Variables() {
+			_, _ = fmt.Fprintf(s.out, "%s = %s\n", v.Name, Describe(v.Value))
+		}
+	case "p", "print":
+		s.printExpression(state, arg)
+	case "list":
+		s.printSource(state.Position().Line, 3)
+	case "q", "quit":
+		return false, object.ErrStopped
+	case "h", "help":
+		_, _ = io.WriteString(s.out, help)
+	default:
+		_, _ = fmt.Fprintf(s.out, "unknown command %q, try help\n", name)
+	}
+
+	return false, nil
+}
+
+const help = `continue (c)      run to the next breakpoint
+step (s)          run to the next line
+next (n)          run to the next line, stepping over calls
+out (o)           run until the current call returns
+break (b) [line]  set a breakpoint, or list them
+clear [line]      delete a breakpoint, or all of them
+stack (bt)        show the active calls
+locals (l)        show the variables in scope
+print (p) expr    evaluate an expression in the current frame
+list              show the source around the current line
+quit (q)          stop the script
+`
+
+func (s *Session) breakCommand(arg string) {
+	if arg == "" {
+		for line := 1; line <= len(s.source); line++ {
+			if s.Breakpoint(line) {
+				_, _ = fmt.Fprintf(s.out, "breakpoint at line %d\n", line)
+			}
+		}
+		return
+	}
+
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 || line > len(s.source) {
+		_, _ = fmt.Fprintf(s.out, "no line %q\n", arg)
+		return
+	}
+
+	s.Break(line)
+	_, _ = fmt.Fprintf(s.out, "breakpoint at line %d\n", line)
+}
+
+func (s *Session) clearCommand(arg string) {
+	if arg == "" {
+		s.Clear(0)
+		return
+	}
+
+	line, err := strconv.Atoi(arg)
+	if err != nil || !s.Breakpoint(line) {
+		_, _ = fmt.Fprintf(s.out, "no breakpoint at line %q\n", arg)
+		return
+	}
+
+	s.Clear(line)
+}
+
+func (s *Session) printLocation(state object.DebugState) {
+	pos := state.Position()
+	_, _ = fmt.Fprintf(s.out, "%s at line %d\n", functionName(state.Function()), pos.Line)
+	s.printSource(pos.Line, 0)
+}
+
+// printSource prints the lines within context of line, marking it.
+func (s *Session) printSource(line, context int) {
+	for n := max(line-context, 1); n <= min(line+context, len(s.source)); n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		_, _ = fmt.Fprintf(s.out, "%s %3d  %s\n", marker, n, s.source[n-1])
+	}
+}
+
+func (s *Session) printStack() {
+	for i, f := range s.Frames() {
+		_, _ = fmt.Fprintf(s.out, "#%d %s at line %d\n", i, functionName(f.Function), f.Position.Line)
+	}
+}
+
+func (s *Session) printExpression(state object.DebugState, expr string) {
+	result, err := Evaluate(expr, state)
+	if err != nil {
+		_, _ = fmt.Fprintln(s.out, err)
+		return
+	}
+	_, _ = fmt.Fprintln(s.out, Describe(result))
+}
+
+// functionName names a call in the session's output; "" is the main
+// program.
+func functionName(name string) string {
+	if name == "" {
+		return "main"
+	}
+	return name
+}
@@ -0,0 +1,238 @@
+package debugger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"llc/lang/compiler"
+	"llc/lang/evaluator"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+	"llc/lang/vm"
+)
+
+const program = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let x = add(1, 2);
+print(x);`
+
+// debug runs source under a session reading commands, on the VM if onVM is
+// set, and returns everything written along with the error it ended with.
+func debug(t *testing.T, source, commands string, breakpoints []int, onVM bool) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	session := New(source, strings.NewReader(commands), &out)
+	for _, line := range breakpoints {
+		session.Break(line)
+	}
+	host := &object.Host{Stdout: &out, Debugger: session}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	if !onVM {
+		result := evaluator.Eval(program, object.NewEnvironmentWithHost(host))
+		if errObj, ok := result.(*object.Error); ok {
+			return out.String(), errObj.Err
+		}
+		return out.String(), nil
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.NewWithHost(comp.Bytecode(), host)
+	machine.SetGlobalNames(comp.SymbolTable().Names(compiler.GlobalScope))
+	err := machine.Run()
+	return out.String(), err
+}
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		commands    string
+		breakpoints []int
+		expected    string
+		stopped     bool
+	}{
+		{
+			"s\ns\ns\nbt\nl\np a * 10 + sum\no\nc\n",
+			nil,
+			`main at line 1
+>   1  let add = fn(a, b) {
+(llc) main at line 5
+>   5  let x = add(1, 2);
+(llc) add at line 2
+>   2    let sum = a + b;
+(llc) add at line 3
+>   3    sum
+(llc) #0 add at line 3
+#1 main at line 5
+(llc) a = 1
+b = 2
+sum = 3
+add = fn add
+(llc) 13
+(llc) main at line 6
+>   6  print(x);
+(llc) 3
+`,
+			false,
+		},
+		{
+			"c\nlocals\nclear 3\nc\n",
+			[]int{3},
+			`main at line 1
+>   1  let add = fn(a, b) {
+(llc) add at line 3
+>   3    sum
+(llc) a = 1
+b = 2
+sum = 3
+add = fn add
+(llc) (llc) 3
+`,
+			false,
+		},
+		{
+			"n\nn\n\nbreak\nb 9\n",
+			[]int{2},
+			`main at line 1
+>   1  let add = fn(a, b) {
+(llc) main at line 5
+>   5  let x = add(1, 2);
+(llc) add at line 2
+>   2    let sum = a + b;
+(llc) add at line 3
+>   3    sum
+(llc) breakpoint at line 2
+(llc) no line "9"
+(llc) 
+`,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		for _, onVM := range []bool{false, true} {
+			name := fmt.Sprintf("[%d] vm=%t", i, onVM)
+			t.Run(name, func(t *testing.T) {
+				out, err := debug(t, program, tt.commands, tt.breakpoints, onVM)
+				if errors.Is(err, object.ErrStopped) != tt.stopped || (err != nil && !tt.stopped) {
+					t.Fatalf("wrong error: %v", err)
+				}
+
+				if out != tt.expected {
+					t.Errorf("wrong output.\nexpected=%q\ngot=     %q", tt.expected, out)
+				}
+			})
+		}
+	}
+}
+
+// TestLocalsOfALaterCall checks that locals not set yet in a call are not
+// shown with the values of an earlier call.
+func TestLocalsOfALaterCall(t *testing.T) {
+	source := `let g = fn(p) {
+  let q = p + 1;
+  let r = q + 1;
+  r
+};
+g(9);
+g(1);`
+
+	expected := `main at line 1
+>   1  let g = fn(p) {
+(llc) g at line 2
+>   2    let q = p + 1;
+(llc) p = 9
+g = fn g
+(llc) g at line 2
+>   2    let q = p + 1;
+(llc) p = 1
+g = fn g
+(llc) `
+
+	for _, onVM := range []bool{false, true} {
+		name := fmt.Sprintf("vm=%t", onVM)
+		t.Run(name, func(t *testing.T) {
+			out, err := debug(t, source, "c\nlocals\nc\nlocals\nc\n", []int{2}, onVM)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if out != expected {
+				t.Errorf("wrong output.\nexpected=%q\ngot=     %q", expected, out)
+			}
+		})
+	}
+}
+
+// TestPrintCallsScriptFunctions checks that a function p calls runs
+// without the session stopping in it.
+func TestPrintCallsScriptFunctions(t *testing.T) {
+	out, err := debug(t, program, "c\np add(40, 2)\nc\nc\n", []int{2, 5}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `main at line 1
+>   1  let add = fn(a, b) {
+(llc) main at line 5
+>   5  let x = add(1, 2);
+(llc) 42
+(llc) add at line 2
+>   2    let sum = a + b;
+(llc) 3
+`
+	if out != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=     %q", expected, out)
+	}
+}
+
+func TestQuitStopsTheScript(t *testing.T) {
+	for _, onVM := range []bool{false, true} {
+		name := fmt.Sprintf("vm=%t", onVM)
+		t.Run(name, func(t *testing.T) {
+			out, err := debug(t, program, "q\n", nil, onVM)
+			if !errors.Is(err, object.ErrStopped) {
+				t.Fatalf("expected the script to be stopped, got %v", err)
+			}
+			if strings.Contains(out, "3\n") {
+				t.Errorf("script kept running after quit: %q", out)
+			}
+		})
+	}
+}
+
+func TestStoppedScriptsCannotCatch(t *testing.T) {
+	source := `let x = 0;
+try {
+  print(1);
+} catch (e) {
+  print("caught");
+};`
+
+	for _, onVM := range []bool{false, true} {
+		name := fmt.Sprintf("vm=%t", onVM)
+		t.Run(name, func(t *testing.T) {
+			out, err := debug(t, source, "c\nq\n", []int{3}, onVM)
+			if !errors.Is(err, object.ErrStopped) {
+				t.Fatalf("expected the script to be stopped, got %v", err)
+			}
+			if strings.Contains(out, "caught") {
+				t.Errorf("script caught the debugger stopping it: %q", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+
+	"llc/lang/evaluator"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+	"llc/lang/token"
+)
+
+// Mode is how far a script runs before it is stopped again, on top of the
+// breakpoints.
+type Mode int
+
+const (
+	// Step stops at the next line.
+	Step Mode = iota
+	// Next stops at the next line of the current call or a caller.
+	Next
+	// Out stops at the next line of a caller.
+	Out
+	// Continue only stops at breakpoints.
+	Continue
+)
+
+// Frame is an active call: the function and the position it last reported,
+// which for every call but the innermost is where it is waiting on a call.
+type Frame struct {
+	// Function is "" for the main program.
+	Function string
+	Position token.Position
+}
+
+// Stepper decides where a script stops, from the lines the engines report
+// to a Debugger. It tracks the active calls along the way. The zero Stepper
+// stops at the first line.
+type Stepper struct {
+	breakpoints map[int]bool
+
+	mode Mode
+	// depth is the call depth the current mode was chosen at.
+	depth  int
+	frames []Frame
+	// last is the last line and depth reported; engines may report the
+	// same line more than once.
+	last      int
+	lastDepth int
+}
+
+// Break sets a breakpoint on a source line.
+func (s *Stepper) Break(line int) {
+	if s.breakpoints == nil {
+		s.breakpoints = make(map[int]bool)
+	}
+	s.breakpoints[line] = true
+}
+
+// Clear deletes the breakpoint on a source line, or every breakpoint if line
+// is 0.
+func (s *Stepper) Clear(line int) {
+	if line == 0 {
+		clear(s.breakpoints)
+		return
+	}
+	delete(s.breakpoints, line)
+}
+
+// Breakpoint reports whether there is a breakpoint on a source line.
+func (s *Stepper) Breakpoint(line int) bool {
+	return s.breakpoints[line]
+}
+
+// Resume lets the script run in mode from the current call.
+func (s *Stepper) Resume(mode Mode) {
+	s.mode, s.depth = mode, len(s.frames)-1
+}
+
+// Follow records the line state reports and whether the script stops there.
+func (s *Stepper) Follow(state object.DebugState) bool {
+	pos, depth := state.Position(), state.Depth()
+	if s.frames != nil && pos.Line == s.last && depth == s.lastDepth {
+		return false
+	}
+	s.last, s.lastDepth = pos.Line, depth
+
+	for len(s.frames) <= depth {
+		s.frames = append(s.frames, Frame{})
+	}
+	s.frames = s.frames[:depth+1]
+	s.frames[depth] = Frame{Function: state.Function(), Position: pos}
+
+	if s.breakpoints[pos.Line] {
+		return true
+	}
+
+	switch s.mode {
+	case Step:
+		return true
+	case Next:
+		return depth <= s.depth
+	case Out:
+		return depth < s.depth
+	default:
+		return false
+	}
+}
+
+// Frames lists the active calls, innermost first.
+func (s *Stepper) Frames() []Frame {
+	frames := make([]Frame, len(s.frames))
+	for i, f := range s.frames {
+		frames[len(frames)-1-i] = f
+	}
+	return frames
+}
+
+// Evaluate evaluates expr with the tree-walking evaluator in an environment
+// holding the variables of state, which must be stopped. Assignments do not
+// change the script's variables, and functions compiled for the VM cannot
+// be called. The script's host has no Debugger meanwhile, so that script
+// functions expr calls run without stopping.
+func Evaluate(expr string, state object.DebugState) (object.Object, error) {
+	p := parser.New(lexer.New(expr))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse error: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	host := state.Host()
+	if host != nil {
+		debugger := host.Debugger
+		host.Debugger = nil
+		defer func() { host.Debugger = debugger }()
+	}
+
+	env := object.NewEnvironmentWithHost(host)
+	variables := state.Variables()
+	for i := len(variables) - 1; i >= 0; i-- {
+		env.Set(variables[i].Name, variables[i].Value)
+	}
+
+	result := evaluator.Eval(program, env)
+	if result == nil {
+		return object.NULL, nil
+	}
+	return result, nil
+}
+
+// Describe shows value as Inspect does, except for functions, which the
+// engines print differently and often at length.
+func Describe(value object.Object) string {
+	switch value := value.(type) {
+	case *object.Function:
+		return describeFunction(value.Name)
+	case *object.Closure:
+		return describeFunction(value.Fn.Name)
+	default:
+		return value.Inspect()
+	}
+}
+
+func describeFunction(name string) string {
+	if name == "" {
+		return "fn <anonymous>"
+	}
+	return "fn " + name
+}
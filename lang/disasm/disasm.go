@@ -0,0 +1,146 @@
+// Package disasm renders compiled llc bytecode as annotated text.
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"llc/lang/code"
+	"llc/lang/compiler"
+	"llc/lang/object"
+	"llc/lang/token"
+)
+
+// Disassemble lists the constant pool, the main program and every compiled
+// function. globals names the global slots, as returned by the compiler's
+// symbol table, and may be nil.
+func Disassemble(bytecode *compiler.Bytecode, globals []string) string {
+	d := &disassembler{bytecode: bytecode, globals: globals}
+
+	d.out.WriteString("constants:\n")
+	for i, constant := range bytecode.Constants {
+		fmt.Fprintf(&d.out, "  %04d %s\n", i, describeConstant(constant))
+	}
+
+	d.out.WriteString("\nmain:\n")
+	d.function(&object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Lines:        bytecode.Lines,
+		Handlers:     bytecode.Handlers,
+	})
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(&d.out, "\nfunction %s (constant %d):\n", functionName(fn), i)
+		d.function(fn)
+	}
+
+	return d.out.String()
+}
+
+type disassembler struct {
+	bytecode *compiler.Bytecode
+	globals  []string
+	out      bytes.Buffer
+}
+
+// function lists fn's instructions. The column after each offset gives the
+// source position the instruction was compiled from, where it changes.
+func (d *disassembler) function(fn *object.CompiledFunction) {
+	ins := fn.Instructions
+	var last token.Position
+
+	for i := 0; i < len(ins); {
+		where := ""
+		if pos, ok := fn.Lines.Lookup(i); ok && pos != last {
+			where, last = pos.String(), pos
+		}
+
+		def, operands, width, err := ins.Decode(i)
+		if err != nil {
+			fmt.Fprintf(&d.out, "  %04d %-6s ERROR: %s\n", i, where, err)
+			i += width
+			continue
+		}
+
+		line := code.FormatInstruction(def, operands)
+		if code.Opcode(ins[i]) == code.OpWide {
+			line = "OpWide " + line
+		}
+		if note := d.annotate(fn, ins.Opcode(i), operands); note != "" {
+			line = fmt.Sprintf("%-24s ; %s", line, note)
+		}
+		fmt.Fprintf(&d.out, "  %04d %-6s %s\n", i, where, line)
+		i += width
+	}
+
+	if len(fn.Handlers) != 0 {
+		d.out.WriteString("  handlers:\n")
+	}
+	for _, h := range fn.Handlers {
+		fmt.Fprintf(&d.out, "    %04d-%04d -> %04d (depth %d)\n", h.Start, h.End, h.Target, h.Depth)
+	}
+}
+
+//nolint:cyclop
+func (d *disassembler) annotate(fn *object.CompiledFunction, op code.Opcode, operands []int) string {
+	switch op {
+	case code.OpConstant, code.OpClosure, code.OpAddConst, code.OpSubConst:
+		if operands[0] < len(d.bytecode.Constants) {
+			return describeOperand(d.bytecode.Constants[operands[0]])
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return slotName(d.globals, operands[0])
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalAdd:
+		return slotName(fn.LocalNames, operands[0])
+	case code.OpGetFree:
+		return slotName(fn.FreeNames, operands[0])
+	case code.OpGetBuiltin:
+		if operands[0] < len(d.bytecode.Builtins) {
+			return d.bytecode.Builtins[operands[0]].Name
+		}
+	case code.OpCurrentClosure:
+		return functionName(fn)
+	}
+
+	return ""
+}
+
+func slotName(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return ""
+}
+
+func describeConstant(constant object.Object) string {
+	if fn, ok := constant.(*object.CompiledFunction); ok {
+		return fmt.Sprintf("fn %s (params %d, locals %d, free %d)",
+			functionName(fn), fn.NumParameters, fn.NumLocals, len(fn.FreeNames))
+	}
+
+	return fmt.Sprintf("%s %s", constant.Type(), describeOperand(constant))
+}
+
+func describeOperand(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.String:
+		return strconv.Quote(constant.Value)
+	case *object.CompiledFunction:
+		return "fn " + functionName(constant)
+	default:
+		return constant.Inspect()
+	}
+}
+
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
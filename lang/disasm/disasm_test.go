@@ -0,0 +1,93 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+
+	"llc/lang/code"
+	"llc/lang/compiler"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `let add = fn(a, b) { let sum = a + b; sum };
+let make = fn(x) { fn() { x } };
+len(add(1, "two"));`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	listing := Disassemble(comp.Bytecode(), comp.SymbolTable().Names(compiler.GlobalScope))
+
+	expected := `constants:
+  0000 fn add (params 2, locals 3, free 0)
+  0001 fn <anonymous> (params 0, locals 0, free 1)
+  0002 fn make (params 1, locals 1, free 0)
+  0003 INTEGER 1
+  0004 STRING "two"
+
+main:
+  0000 1:11   OpClosure 0 0            ; fn add
+  0004 1:1    OpSetGlobal 0            ; add
+  0007 2:12   OpClosure 2 0            ; fn make
+  0011 2:1    OpSetGlobal 1            ; make
+  0014 3:1    OpGetBuiltin 0           ; len
+  0016 3:5    OpGetGlobal 0            ; add
+  0019 3:9    OpConstant 3             ; 1
+  0022 3:12   OpConstant 4             ; "two"
+  0025 3:8    OpCall 2
+  0027 3:4    OpCall 1
+  0029 3:1    OpPop
+
+function add (constant 0):
+  0000 1:32   OpGetLocal 0             ; a
+  0002 1:36   OpGetLocal 1             ; b
+  0004 1:34   OpAdd
+  0005 1:22   OpSetLocal 2             ; sum
+  0007 1:39   OpGetLocal 2             ; sum
+  0009        OpReturnValue
+
+function <anonymous> (constant 1):
+  0000 2:27   OpGetFree 0              ; x
+  0002        OpReturnValue
+
+function make (constant 2):
+  0000 2:20   OpGetLocal 0             ; x
+  0002        OpClosure 1 1            ; fn <anonymous>
+  0006        OpReturnValue
+`
+
+	if listing != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, listing)
+	}
+}
+
+func TestDisassembleHandlers(t *testing.T) {
+	program := parser.New(lexer.New(`try { throw 1 } catch (e) { e }`)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	listing := Disassemble(comp.Bytecode(), comp.SymbolTable().Names(compiler.GlobalScope))
+	if !strings.Contains(listing, "  handlers:\n    0000-0008 -> 0008 (depth 0)\n") {
+		t.Errorf("handler table missing. got=\n%s", listing)
+	}
+}
+
+func TestDisassembleMalformed(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Instructions: code.Instructions{200, byte(code.OpConstant), 0},
+		Constants:    []object.Object{&object.Integer{Value: 1}},
+	}
+
+	listing := Disassemble(bytecode, nil)
+	if !strings.Contains(listing, "  0000        ERROR: opcode 200 undefined\n  0001        ERROR: OpConstant truncated") {
+		t.Errorf("wrong listing. got=\n%s", listing)
+	}
+}
@@ -0,0 +1,47 @@
+package evaluator
+
+import (
+	"llc/lang/ast"
+	"llc/lang/object"
+	"llc/lang/token"
+)
+
+// debugState is what the evaluator shows a Debugger before a statement.
+type debugState struct {
+	env      *object.Environment
+	position token.Position
+}
+
+func (s *debugState) Position() token.Position { return s.position }
+func (s *debugState) Depth() int               { return s.env.Meter().Depth() }
+
+func (s *debugState) Function() string {
+	fn := s.env.Function()
+	if fn == nil {
+		return ""
+	}
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+func (s *debugState) Variables() []object.Variable {
+	return s.env.Variables()
+}
+
+func (s *debugState) Host() *object.Host { return s.env.Host() }
+
+// debugStatement hands statement to the host's Debugger, if there is one,
+// before it runs.
+func debugStatement(statement ast.Statement, env *object.Environment) *object.Error {
+	host := env.Host()
+	if host == nil || host.Debugger == nil {
+		return nil
+	}
+
+	if err := host.Debugger.Line(&debugState{env: env, position: ast.Pos(statement)}); err != nil {
+		return limitError(err)
+	}
+	return nil
+}
@@ -1,35 +1,78 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"llc/lang/ast"
+	"llc/lang/builtins"
 	"llc/lang/object"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object { //nolint:gocognit,cyclop,funlen,gocyclo
+// MaxCallDepth bounds non-tail recursion, which runs on the Go stack, well
+// below the point where the Go runtime itself would crash.
+const MaxCallDepth = 10000
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	if env.Meter() != nil {
+		return eval(node, env)
+	}
+
+	return EvalContext(context.Background(), node, env)
+}
+
+// EvalContext evaluates node under ctx and the limits of the environment's
+// host. Running past either yields an error wrapping ctx.Err() or
+// object.ErrLimitExceeded.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	previous := env.SetMeter(object.NewMeter(ctx, hostLimits(env.Host())))
+	defer env.SetMeter(previous)
+
+	return eval(node, env)
+}
+
+func hostLimits(host *object.Host) object.Limits {
+	if host == nil {
+		return object.Limits{}
+	}
+	return host.Limits
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object { //nolint:gocognit,cyclop,funlen,gocyclo
+	if err := env.Meter().Step(); err != nil {
+		return limitError(err)
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(node.Expression, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := eval(node.ReturnValue, env)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		thrown := object.NewThrownValue(val)
+		return &object.Error{Message: thrown.Message, Kind: thrown.Kind, Data: thrown.Data}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
@@ -43,65 +86,85 @@ func Eval(node ast.Node, env *object.Environment) object.Object { //nolint:gocog
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
+		if err := env.Meter().Allocate(int64(len(elements)) + 1); err != nil {
+			return limitError(err)
+		}
 		return &object.Array{Elements: elements}
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Env: env, Body: body, Name: node.Name}
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		result := evalInfixExpression(node.Operator, left, right)
+		if result.Type() == object.StringObj {
+			if err := env.Meter().Allocate(1); err != nil {
+				return limitError(err)
+			}
+		}
+		return result
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
 			return quote(node.Arguments[0], env)
 		}
 
-		function := Eval(node.Function, env)
-		if isError(function) {
+		function := eval(node.Function, env)
+		if isAbrupt(function) {
 			return function
 		}
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return callFunction(function, args, env, node)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := eval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 
 		return evalIndexExpression(left, index)
+	case *ast.PropagateExpression:
+		val := eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if val.Type() == object.ErrorValueObj {
+			return &object.ReturnValue{Value: val}
+		}
+		return val
 	}
 
 	return nil
@@ -113,11 +176,25 @@ func evalIndexExpression(left, index object.Object) object.Object {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HashObj:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.ErrorValueObj && index.Type() == object.StringObj:
+		return evalErrorValueIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
+func evalErrorValueIndexExpression(errorValue, index object.Object) object.Object {
+	errorValueObj, _ := errorValue.(*object.ErrorValue)
+	name, _ := index.(*object.String)
+
+	field, ok := errorValueObj.Field(name.Value)
+	if !ok {
+		return newError("unknown error field: %s", name.Value)
+	}
+
+	return field
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObj, _ := hash.(*object.Hash)
 
@@ -147,20 +224,24 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	if err := env.Meter().Allocate(int64(len(node.Pairs)) + 1); err != nil {
+		return limitError(err)
+	}
+
 	pairs := make(map[object.HashKey]object.HashPair)
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
+		key := eval(keyNode, env)
+		if isAbrupt(key) {
 			return key
 		}
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			newError("unusable as hash key: %s", key.Type())
+			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
-		if isError(value) {
+		value := eval(valueNode, env)
+		if isAbrupt(value) {
 			return value
 		}
 
@@ -171,21 +252,86 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hash{Pairs: pairs}
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// Apply calls fn with already evaluated arguments.
+func Apply(fn object.Object, args []object.Object, host *object.Host) object.Object {
+	if function, ok := fn.(*object.Function); ok && function.Env.Meter() == nil {
+		previous := function.Env.SetMeter(object.NewMeter(context.Background(), hostLimits(host)))
+		defer function.Env.SetMeter(previous)
+	}
+
+	return applyFunction(fn, args, host, nil)
+}
+
+// applyFunction calls fn on behalf of call, which is nil when the call comes
+// from Go rather than from source.
+// callFunction calls function, counting the arrays builtins return against
+// the allocation limit.
+func callFunction(
+	function object.Object, args []object.Object, env *object.Environment, call *ast.CallExpression,
+) object.Object {
+	result := applyFunction(function, args, env.Host(), call)
+	if array, ok := result.(*object.Array); ok && function.Type() == object.BuiltinObj {
+		if err := env.Meter().Allocate(int64(len(array.Elements)) + 1); err != nil {
+			return limitError(err)
+		}
+	}
+	return result
+}
+
+func applyFunction(fn object.Object, args []object.Object, host *object.Host, call *ast.CallExpression) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		meter := fn.Env.Meter()
+		if err := meter.Enter(); err != nil {
+			return limitError(err)
+		}
+		defer meter.Leave()
+
+		if meter.Depth() > MaxCallDepth {
+			err := fmt.Errorf("%w: maximum call depth of %d exceeded", object.ErrStackOverflow, MaxCallDepth)
+			return withFrame(limitError(err), fn, call)
+		}
+
+		// Calls in tail position come back as a tailCall instead of growing
+		// the Go stack, and are run here in the caller's place.
+		for {
+			if len(args) != len(fn.Parameters) {
+				return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+			}
+
+			extendedEnv := extendFunctionEnv(fn, args)
+			evaluated := unwrapReturnValue(evalTailBlock(fn.Body, extendedEnv))
+
+			switch evaluated := evaluated.(type) {
+			case *tailCall:
+				fn, args, call = evaluated.fn, evaluated.args, evaluated.call
+			case *object.Error:
+				return withFrame(evaluated, fn, call)
+			default:
+				return evaluated
+			}
+		}
 	case *object.Builtin:
-		return fn.Function(args...)
+		return fn.Function(host, args...)
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// withFrame records fn and its call site on the stack of an error unwinding
+// through it.
+func withFrame(err *object.Error, fn *object.Function, call *ast.CallExpression) *object.Error {
+	frame := object.StackFrame{Function: fn.Name}
+	if call != nil {
+		frame.Line, frame.Column = call.Token.Line, call.Token.Column
+	}
+
+	err.Stack = append(err.Stack, frame)
+	return err
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	env := object.NewCallEnvironment(fn)
 
 	for paramIdx, param := range fn.Parameters {
 		env.Set(param.Value, args[paramIdx])
@@ -206,8 +352,8 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	var result []object.Object //nolint: prealloc
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		evaluated := eval(e, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -217,32 +363,97 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	condition := eval(ie.Condition, env)
+	if isAbrupt(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) { //nolint:gocritic
-		return Eval(ie.Consequence, env)
+		return eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+// evalTryExpression runs the catch clause for errors raised in the block and
+// the finally clause in every case. An error or return in the finally clause
+// replaces the outcome of the rest.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	// As on the VM, neither catch nor finally runs for the errors hosts stop
+	// scripts with, so that a return in finally cannot replace them.
+	result := eval(te.Block, env)
+	if stopsScript(result) {
+		return result
+	}
+
+	if errObj, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.CatchParameter.Value, toErrorValue(errObj))
+		result = eval(te.Catch, catchEnv)
+		if stopsScript(result) {
+			return result
+		}
+	}
+
+	if te.Finally != nil {
+		finally := eval(te.Finally, env)
+		if finally != nil && (finally.Type() == object.ErrorObj || finally.Type() == object.ReturnValueObj) {
+			return finally
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+
+	return result
+}
+
+// isCatchable keeps scripts from swallowing the errors their host uses to
+// stop them.
+func isCatchable(err *object.Error) bool {
+	return !errors.Is(err.Err, object.ErrLimitExceeded) &&
+		!errors.Is(err.Err, object.ErrStopped) &&
+		!errors.Is(err.Err, context.Canceled) &&
+		!errors.Is(err.Err, context.DeadlineExceeded)
+}
+
+func stopsScript(obj object.Object) bool {
+	errObj, ok := obj.(*object.Error)
+	return ok && !isCatchable(errObj)
+}
+
+func toErrorValue(err *object.Error) *object.ErrorValue {
+	kind := err.Kind
+	if kind == "" {
+		kind = object.RuntimeErrorKind
+	}
+
+	return &object.ErrorValue{Kind: kind, Message: err.Message, Data: err.Data, Stack: err.Stack}
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := lookupBuiltin(env.Host(), node.Value); ok {
 		return builtin
 	}
 
 	return newError("%s", "identifier not found: "+node.Value)
 }
 
+func lookupBuiltin(host *object.Host, name string) (*object.Builtin, bool) {
+	if host != nil && host.Builtins != nil {
+		return host.Builtins.Lookup(name)
+	}
+
+	return builtins.Lookup(name)
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -256,9 +467,11 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func isError(obj object.Object) bool {
+// isAbrupt reports errors and pending returns, which both unwind through the
+// enclosing expressions until a function boundary or a catch stops them.
+func isAbrupt(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ErrorObj
+		return obj.Type() == object.ErrorObj || obj.Type() == object.ReturnValueObj
 	}
 	return false
 }
@@ -304,6 +517,9 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal.Value * rightVal.Value}
 	case "/":
+		if rightVal.Value == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal.Value / rightVal.Value}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal.Value < rightVal.Value)
@@ -362,7 +578,11 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		if err := debugStatement(statement, env); err != nil {
+			return err
+		}
+
+		result = eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -379,20 +599,117 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		if err := debugStatement(statement, env); err != nil {
+			return err
+		}
+
+		result = eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
 			if rt == object.ReturnValueObj || rt == object.ErrorObj {
 				return result
 			}
-			return result
 		}
 	}
 
 	return result
 }
 
+// tailCall is a call in tail position, handed back to applyFunction to run in
+// place of the current one. It never escapes a function body.
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+	call *ast.CallExpression
+}
+
+func (tc *tailCall) Type() object.TypeObject { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evalTailBlock evaluates a function body, or a branch in tail position of
+// one, deferring a final call to the caller.
+func evalTailBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for i, statement := range block.Statements {
+		if err := debugStatement(statement, env); err != nil {
+			return err
+		}
+
+		if i < len(block.Statements)-1 {
+			result = eval(statement, env)
+			if result != nil && (result.Type() == object.ReturnValueObj || result.Type() == object.ErrorObj) {
+				return result
+			}
+			continue
+		}
+
+		switch statement := statement.(type) {
+		case *ast.ExpressionStatement:
+			return evalTailExpression(statement.Expression, env)
+		case *ast.ReturnStatement:
+			val := evalTailExpression(statement.ReturnValue, env)
+			if isAbrupt(val) {
+				return val
+			}
+			return &object.ReturnValue{Value: val}
+		default:
+			return eval(statement, env)
+		}
+	}
+
+	return result
+}
+
+func evalTailExpression(node ast.Expression, env *object.Environment) object.Object {
+	if err := env.Meter().Step(); err != nil {
+		return limitError(err)
+	}
+
+	switch node := node.(type) {
+	case *ast.IfExpression:
+		condition := eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return evalTailBlock(node.Consequence, env)
+		}
+		if node.Alternative != nil {
+			return evalTailBlock(node.Alternative, env)
+		}
+		return NULL
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return eval(node, env)
+		}
+
+		function := eval(node.Function, env)
+		if isAbrupt(function) {
+			return function
+		}
+
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
+			return args[0]
+		}
+
+		fn, ok := function.(*object.Function)
+		if !ok {
+			return callFunction(function, args, env, node)
+		}
+		return &tailCall{fn: fn, args: args, call: node}
+	default:
+		return eval(node, env)
+	}
+}
+
+func limitError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Err: err}
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -243,6 +243,22 @@ func TestErrorHandling(t *testing.T) {
 			`{"foo": "bar"}[fn(x) { x }]`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"{[1]: 2}",
+			"unusable as hash key: ARRAY",
+		},
+		{
+			"let z = 0; 1 / z",
+			"division by zero",
+		},
+		{
+			"fn(x) { x }(1, 2)",
+			"wrong number of arguments: want=1, got=2",
+		},
+		{
+			"let add = fn(x, y) { x + y }; add(1)",
+			"wrong number of arguments: want=2, got=1",
+		},
 	}
 
 	for i, tt := range tests {
@@ -312,6 +328,7 @@ func TestFunctionApplication(t *testing.T) {
 		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
 		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
 		{"fn(x) { x; }(5)", 5},
+		{"let last = fn(x) { x; x * 3 }; last(5);", 15},
 	}
 
 	for i, tt := range tests {
@@ -0,0 +1,131 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+)
+
+func TestIOBuiltinsAreSandboxedByDefault(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`read_file("x")`, "read_file: file system access is not allowed"},
+		{`write_file("x", "y")`, "write_file: file system access is not allowed"},
+		{`list_dir(".")`, "list_dir: file system access is not allowed"},
+		{`getenv("HOME")`, "getenv: environment access is not allowed"},
+		{`exit(1)`, "exit: process access is not allowed"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			}
+
+			if errObj.Message != tt.expectedMessage {
+				t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, tt.expectedMessage)
+			}
+		})
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	host := &object.Host{Capabilities: object.CapFS}
+
+	input := fmt.Sprintf(`
+	let path = "%s";
+	write_file(path + "/b.txt", "bravo");
+	write_file(path + "/a.txt", "alpha");
+	[list_dir(path), read_file(path + "/a.txt")]
+	`, dir)
+
+	evaluated := testEvalWithHost(input, host)
+	if evaluated.Inspect() != "[[a.txt, b.txt], alpha]" {
+		t.Fatalf("wrong result. got=%q", evaluated.Inspect())
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "b.txt"))
+	if err != nil {
+		t.Fatalf("file was not written: %s", err)
+	}
+
+	if string(content) != "bravo" {
+		t.Errorf("wrong file content. got=%q", content)
+	}
+
+	evaluated = testEvalWithHost(fmt.Sprintf(`read_file("%s/missing.txt")`, dir), host)
+	if _, ok := evaluated.(*object.Error); !ok {
+		t.Errorf("reading missing file should fail. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestGetenvBuiltin(t *testing.T) {
+	t.Setenv("LLC_TEST_VARIABLE", "value")
+	host := &object.Host{Capabilities: object.CapEnv}
+
+	evaluated := testEvalWithHost(`getenv("LLC_TEST_VARIABLE")`, host)
+	if evaluated.Inspect() != "value" {
+		t.Errorf("wrong result. got=%q", evaluated.Inspect())
+	}
+
+	evaluated = testEvalWithHost(`getenv("LLC_TEST_VARIABLE_UNSET")`, host)
+	testNullObject(t, evaluated)
+
+	evaluated = testEvalWithHost(`read_file("x")`, host)
+	if _, ok := evaluated.(*object.Error); !ok {
+		t.Errorf("env capability must not grant file access. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestArgsAndExitBuiltins(t *testing.T) {
+	exitCode := -1
+	host := &object.Host{
+		Args:         []string{"one", "two"},
+		Capabilities: object.CapExit,
+		Exit:         func(code int) { exitCode = code },
+	}
+
+	evaluated := testEvalWithHost(`args()`, host)
+	if evaluated.Inspect() != "[one, two]" {
+		t.Errorf("wrong args. got=%q", evaluated.Inspect())
+	}
+
+	evaluated = testEval(`args()`)
+	if evaluated.Inspect() != "[]" {
+		t.Errorf("sandboxed args must be empty. got=%q", evaluated.Inspect())
+	}
+
+	testEvalWithHost(`let f = fn() { exit(7) }; f()`, host)
+	if exitCode != 7 {
+		t.Errorf("wrong exit code. got=%d, want=%d", exitCode, 7)
+	}
+
+	host.Capabilities = 0
+	evaluated = testEvalWithHost(`exit(3)`, host)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "exit: process access is not allowed" {
+		t.Errorf("exit must need its capability. got=%T (%+v)", evaluated, evaluated)
+	}
+	if exitCode != 7 {
+		t.Errorf("exit ran without its capability. got=%d", exitCode)
+	}
+}
+
+func testEvalWithHost(input string, host *object.Host) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironmentWithHost(host)
+
+	return Eval(program, env)
+}
@@ -0,0 +1,121 @@
+package evaluator
+
+import (
+	"fmt"
+	"testing"
+
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+)
+
+func TestJSONParse(t *testing.T) {
+	tests := []struct {
+		document string
+		input    string
+		expected string
+	}{
+		{`1`, `json_parse(doc)`, "1"},
+		{`-42`, `json_parse(doc)`, "-42"},
+		{`true`, `json_parse(doc)`, "true"},
+		{`null`, `json_parse(doc)`, "null"},
+		{`"text"`, `json_parse(doc)`, "text"},
+		{`[1, false, null]`, `json_parse(doc)`, "[1, false, null]"},
+		{`{"a": [1, 2]}`, `json_parse(doc)["a"][1]`, "2"},
+		{`{"name": "llc"}`, `json_parse(doc)["name"]`, "llc"},
+		{`{}`, `json_parse(doc)["missing"]`, "null"},
+		{`[[], [], []]`, `len(json_parse(doc))`, "3"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			evaluated := testEvalJSON(tt.input, tt.document)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONStringify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_stringify(1)`, `1`},
+		{`json_stringify("<b>")`, `"<b>"`},
+		{`json_stringify([1, true, "x", json_parse("null")])`, `[1,true,"x",null]`},
+		{`json_stringify({"b": 2, "a": [1]})`, `{"a":[1],"b":2}`},
+		{`json_stringify({"a": [1]}, 2)`, "{\n  \"a\": [\n    1\n  ]\n}"},
+		{"json_stringify([1], \"\t\")", "[\n\t1\n]"},
+		{`json_stringify({"x": {"y": []}})`, `{"x":{"y":[]}}`},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			}
+
+			if str.Value != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", str.Value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`json_parse(1)`, "argument to `json_parse` must be STRING, got INTEGER"},
+		{`json_parse("[1,")`, "json_parse: unexpected EOF"},
+		{`json_parse("1 2")`, "json_parse: unexpected data after top-level value"},
+		{`json_parse("1.5")`, "json_parse: number 1.5 is not an integer"},
+		{`json_parse("[1, 2e3]")`, "json_parse: number 2e3 is not an integer"},
+		{`json_stringify(fn(x) { x })`, "json_stringify: unsupported value FUNCTION"},
+		{`json_stringify([len])`, "json_stringify: unsupported value BUILTIN"},
+		{`json_stringify({1: 2})`, "json_stringify: unsupported hash key INTEGER, keys must be STRING"},
+		{`json_stringify(1, true)`, "argument to `json_stringify` indent must be INTEGER or STRING, got BOOLEAN"},
+		{`json_stringify()`, "wrong number of arguments. got=0, want=1 or 2"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			}
+
+			if errObj.Message != tt.expectedMessage {
+				t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, tt.expectedMessage)
+			}
+		})
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	document := `{"enabled":true,"limits":[1,2,3],"name":"llc","owner":null}`
+
+	evaluated := testEvalJSON(`json_stringify(json_parse(doc))`, document)
+	if evaluated.Inspect() != document {
+		t.Errorf("round trip changed document. got=%q, want=%q", evaluated.Inspect(), document)
+	}
+}
+
+func testEvalJSON(input, document string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	env.Set("doc", &object.String{Value: document})
+
+	return Eval(program, env)
+}
@@ -0,0 +1,75 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+)
+
+func TestEvalContextLimits(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits object.Limits
+	}{
+		{"let f = fn() { f() }; f()", object.Limits{MaxSteps: 1000}},
+		{"let f = fn(x) { 1 + f(x + 1) }; f(0)", object.Limits{MaxCallDepth: 50}},
+		{"let f = fn(a) { f(push(a, 1)) }; f([])", object.Limits{MaxAllocations: 100}},
+		{`let f = fn(s) { f(s + "x") }; f("")`, object.Limits{MaxAllocations: 100}},
+		{"let f = fn() { {1: [1, 2, 3]} }; f(); f(); f()", object.Limits{MaxAllocations: 5}},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			host := &object.Host{Limits: tt.limits}
+			evaluated := testEvalContext(context.Background(), tt.input, host)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			}
+
+			if !errors.Is(errObj.Err, object.ErrLimitExceeded) {
+				t.Errorf("expected limit error. got=%q", errObj.Message)
+			}
+		})
+	}
+}
+
+func TestEvalContextWithinLimits(t *testing.T) {
+	host := &object.Host{Limits: object.Limits{MaxSteps: 10000, MaxCallDepth: 20, MaxAllocations: 100}}
+	input := "let f = fn(x) { if (x == 0) { [] } else { push(f(x - 1), x) } }; len(f(10))"
+
+	evaluated := testEvalContext(context.Background(), input, host)
+	testIntegerObject(t, evaluated, 10)
+}
+
+func TestEvalContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	evaluated := testEvalContext(ctx, "let f = fn() { f() }; f()", nil)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if !errors.Is(errObj.Err, context.Canceled) {
+		t.Errorf("expected context.Canceled. got=%q", errObj.Message)
+	}
+}
+
+func testEvalContext(ctx context.Context, input string, host *object.Host) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironmentWithHost(host)
+
+	return EvalContext(ctx, program, env)
+}
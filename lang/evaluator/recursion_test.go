@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+)
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } }; count(100000)", 0},
+		{"let count = fn(n) { if (n == 0) { return 7; } return count(n - 1); }; count(100000)", 7},
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(50000, 0)", 1250025000},
+		{`
+		let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+		let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+		if (even(100001)) { 1 } else { 0 }`, 0},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; let r = f(20000); if (r) { 1 } else { 2 }", 2},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+// TestTailCallOfABuiltin checks that a callee in tail position is evaluated
+// once when it turns out to be a builtin.
+func TestTailCallOfABuiltin(t *testing.T) {
+	var out bytes.Buffer
+	host := &object.Host{Stdout: &out}
+
+	input := `let pick = fn() { print("pick"); len }; let f = fn(s) { pick()(s) }; f("abc")`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	testIntegerObject(t, Eval(program, object.NewEnvironmentWithHost(host)), 3)
+
+	if out.String() != "pick\n" {
+		t.Errorf("wrong output. got=%q, want=%q", out.String(), "pick\n")
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	input := `
+	let down = fn(n) { 1 + down(n + 1) };
+	let start = fn() { let r = down(0); r };
+	start()`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if !errors.Is(errObj.Err, object.ErrStackOverflow) {
+		t.Errorf("expected stack overflow. got=%q", errObj.Message)
+	}
+
+	if len(errObj.Stack) != MaxCallDepth+1 {
+		t.Fatalf("wrong stack depth. got=%d, want=%d", len(errObj.Stack), MaxCallDepth+1)
+	}
+
+	if errObj.Stack[0].Function != "down" || errObj.Stack[len(errObj.Stack)-1].Function != "start" {
+		t.Errorf("wrong stack frames. got=%v ... %v", errObj.Stack[0], errObj.Stack[len(errObj.Stack)-1])
+	}
+
+	trace := errObj.StackTrace()
+	if !strings.HasPrefix(trace, "  at down (called at 2:29)\n") || !strings.HasSuffix(trace, "more frames\n") {
+		t.Errorf("wrong stack trace. got=%q", trace)
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `
+	let inner = fn(x) { x + true; 1 };
+	let outer = fn() { let y = inner(1); y };
+	outer()`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if trace := errObj.StackTrace(); trace != "  at inner (called at 3:34)\n  at outer (called at 4:7)\n" {
+		t.Errorf("wrong stack trace. got=%q", trace)
+	}
+
+	evaluated = testEval(`fn() { -true }()`)
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if trace := errObj.StackTrace(); trace != "  at <anonymous> (called at 1:15)\n" {
+		t.Errorf("wrong stack trace. got=%q", trace)
+	}
+}
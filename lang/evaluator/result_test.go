@@ -0,0 +1,62 @@
+package evaluator
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestErrorValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`error("boom")`, "Error: boom"},
+		{`error("boom", 42)["data"]`, "42"},
+		{`error("boom")["data"]`, "null"},
+		{`let e = error("boom"); 1; e["message"]`, "boom"},
+		{`[error("a"), 2][1]`, "2"},
+		{`is_error(error("a"))`, "true"},
+		{`is_error("a")`, "false"},
+		{`is_error(try { throw "x" } catch (e) { e })`, "true"},
+		{`error(1)`, "Error: argument to `error` must be STRING, got INTEGER"},
+		{`try { throw error("a", 1) } catch (e) { e["data"] }`, "1"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestPropagateOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn() { 5? }; f()`, "5"},
+		{`let f = fn() { error("no")?; 5 }; f()`, "Error: no"},
+		{`let parse = fn(x) { if (x > 0) { x } else { error("negative") } };
+		  let double = fn(x) { parse(x)? * 2 };
+		  [double(2), double(-1)]`, "[4, Error: negative]"},
+		{`let f = fn() { let x = error("a")?; x + 1 }; is_error(f())`, "true"},
+		{`let f = fn() { [1, error("in array")?, 3] }; f()["message"]`, "in array"},
+		{`let f = fn() { try { error("t")? } finally { 1 } }; f()`, "Error: t"},
+		{`let f = fn() { let r = fn() { error("inner")? }(); 2 }; f()`, "2"},
+		{`error("top")?; 1`, "Error: top"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), tt.expected)
+			}
+		})
+	}
+}
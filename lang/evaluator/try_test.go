@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"llc/lang/object"
+)
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw "boom"; 1 } catch (e) { e["message"] }`, "boom"},
+		{`try { throw "boom" } catch (e) { e["kind"] }`, "Error"},
+		{`try { throw [1, 2] } catch (e) { e["data"][1] }`, "2"},
+		{`try { 1 + true } catch (e) { e["kind"] + ": " + e["message"] }`, "RuntimeError: type mismatch: INTEGER + BOOLEAN"},
+		{`try { throw "boom" } catch (e) { e }`, "Error: boom"},
+		{`let f = fn() { throw "deep" }; let g = fn() { let r = f(); r }; try { g() } catch (e) { e["stack"] }`,
+			"[f (called at 1:56), g (called at 1:72)]"},
+		{`try { try { throw "inner" } catch (e) { throw e["message"] + "!" } } catch (e) { e["message"] }`, "inner!"},
+		{`try { throw "a" } catch (e) { try { throw e } catch (again) { again["message"] } }`, "a"},
+		{`let x = try { throw 1 } catch (e) { 5 }; x * 2`, "10"},
+		{`try { throw "a" } catch (e) { }`, "null"},
+		{`try { {[1]: 2} } catch (e) { e["message"] }`, "unusable as hash key: ARRAY"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestTryFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let r = try { 1 } finally { 5 }; r`, "1"},
+		{`try { 1 } catch (e) { 2 } finally { 3 }`, "1"},
+		{`try { throw "a" } catch (e) { 2 } finally { 3 }`, "2"},
+		{`let f = fn() { try { return 1; } finally { 2 }; 3 }; f()`, "1"},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, "2"},
+		{`try { try { throw "a" } finally { 1 } } catch (e) { e["message"] }`, "a"},
+		{`try { try { 1 } finally { throw "b" } } catch (e) { e["message"] }`, "b"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	evaluated := testEval(`let f = fn() { throw "boom" }; f(); 1`)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "boom" || errObj.Kind != "Error" {
+		t.Errorf("wrong error. got=%q (%s)", errObj.Message, errObj.Kind)
+	}
+
+	evaluated = testEval(`try { throw "x" } catch (e) { e["nope"] }`)
+	if evaluated.Inspect() != "Error: unknown error field: nope" {
+		t.Errorf("wrong result. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestLimitsAreNotCatchable(t *testing.T) {
+	host := &object.Host{Limits: object.Limits{MaxSteps: 500}}
+	input := `let f = fn() { f() }; try { f() } catch (e) { "caught" }`
+
+	evaluated := testEvalContext(context.Background(), input, host)
+	if _, ok := evaluated.(*object.Error); !ok {
+		t.Errorf("limit errors must not be caught. got=%q", evaluated.Inspect())
+	}
+
+	input = `let f = fn() { f() }; let g = fn() { try { f() } finally { return "swallowed" } }; g()`
+	evaluated = testEvalContext(context.Background(), input, host)
+	if errObj, ok := evaluated.(*object.Error); !ok || !errors.Is(errObj.Err, object.ErrLimitExceeded) {
+		t.Errorf("finally must not replace limit errors. got=%q", evaluated.Inspect())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	input = `let f = fn() { f() }; let g = fn() { try { 1 } catch (e) { 2 } finally { return f() } }; ` +
+		`try { g() } catch (e) { 1 } finally { return 2 }`
+	evaluated = testEvalContext(ctx, input, nil)
+	if errObj, ok := evaluated.(*object.Error); !ok || !errors.Is(errObj.Err, context.Canceled) {
+		t.Errorf("finally must not replace cancellation. got=%q", evaluated.Inspect())
+	}
+}
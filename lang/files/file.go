@@ -1,13 +1,22 @@
 package files
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
+	"llc/lang/ast"
+	"llc/lang/compiler"
 	"llc/lang/evaluator"
 	"llc/lang/lexer"
+	"llc/lang/llcb"
 	"llc/lang/object"
+	"llc/lang/optimizer"
 	"llc/lang/parser"
+	"llc/lang/verifier"
+	"llc/lang/vm"
 )
 
 func ReadStd() (*object.Environment, error) {
@@ -19,7 +28,7 @@ func ReadStd() (*object.Environment, error) {
 
 	for _, file := range files {
 		path := folder + "/" + file
-		_, err := ReadFile(path, env)
+		_, err := ReadFile(path, env, optimizer.Default)
 		if err != nil {
 			return nil, err
 		}
@@ -28,7 +37,21 @@ func ReadStd() (*object.Environment, error) {
 	return env, nil
 }
 
-func ReadFile(path string, env *object.Environment) (*object.Environment, error) {
+func ReadFile(path string, env *object.Environment, level optimizer.Level) (*object.Environment, error) {
+	program, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := evaluator.Eval(optimizer.Optimize(program, level), env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, evaluationError(path, errObj)
+	}
+
+	return env, nil
+}
+
+func parseFile(path string) (*ast.Program, error) {
 	sourceCode, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -41,7 +64,137 @@ func ReadFile(path string, env *object.Environment) (*object.Environment, error)
 		return nil, fmt.Errorf("error happened during parsing of %s. errors=%v", path, p.Errors())
 	}
 
-	_ = evaluator.Eval(program, env)
+	return program, nil
+}
 
-	return env, nil
+func evaluationError(path string, errObj *object.Error) error {
+	message := fmt.Sprintf("error happened during evaluation of %s. %s", path, errObj.Inspect())
+	if len(errObj.Stack) != 0 {
+		message += "\n" + strings.TrimSuffix(errObj.StackTrace(), "\n")
+	}
+	return errors.New(message)
+}
+
+// CompileFile parses and compiles the module at path for the VM.
+func CompileFile(path string, level optimizer.Level) (*compiler.Compiler, error) {
+	program, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	comp := compiler.New()
+	comp.SetPeephole(level >= optimizer.O1)
+	if err := comp.Compile(optimizer.Optimize(program, level)); err != nil {
+		return nil, fmt.Errorf("error happened during compilation of %s. %w", path, err)
+	}
+
+	return comp, nil
+}
+
+// BuildFile compiles the module at path and writes it to out as a .llcb file.
+// Bytecode that would not load again is not written.
+func BuildFile(path, out string, level optimizer.Level) error {
+	comp, err := CompileFile(path, level)
+	if err != nil {
+		return err
+	}
+
+	if err := verifier.Verify(comp.Bytecode()); err != nil {
+		return fmt.Errorf("error happened during compilation of %s. %w", path, err)
+	}
+
+	program := &llcb.Program{
+		Bytecode: comp.Bytecode(),
+		Globals:  comp.SymbolTable().Names(compiler.GlobalScope),
+	}
+
+	var buf bytes.Buffer
+	if err := llcb.Encode(&buf, program); err != nil {
+		return fmt.Errorf("error happened during encoding of %s. %w", path, err)
+	}
+
+	return os.WriteFile(out, buf.Bytes(), 0o644) //nolint:gosec
+}
+
+// LoadBytecodeFile reads and validates a .llcb file.
+func LoadBytecodeFile(path string) (*llcb.Program, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	program, err := llcb.Decode(file, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error happened during loading of %s. %w", path, err)
+	}
+
+	return program, nil
+}
+
+// RunBytecodeFile loads a .llcb file and runs it on the VM.
+func RunBytecodeFile(path string, host *object.Host) error {
+	program, err := LoadBytecodeFile(path)
+	if err != nil {
+		return err
+	}
+
+	return executionError(path, vm.NewWithHost(program.Bytecode, host).Run())
+}
+
+// DebugFile runs the module at path under host's Debugger, on the VM if
+// onVM is set and with the evaluator otherwise. A script stopped by the
+// debugger is not an error.
+func DebugFile(path string, host *object.Host, onVM bool, level optimizer.Level) error {
+	if onVM {
+		return debugOnVM(path, host, level)
+	}
+	return debugWithEvaluator(path, host, level)
+}
+
+func debugOnVM(path string, host *object.Host, level optimizer.Level) error {
+	comp, err := CompileFile(path, level)
+	if err != nil {
+		return err
+	}
+
+	machine := vm.NewWithHost(comp.Bytecode(), host)
+	machine.SetGlobalNames(comp.SymbolTable().Names(compiler.GlobalScope))
+	err = machine.Run()
+	if errors.Is(err, object.ErrStopped) {
+		return nil
+	}
+	return executionError(path, err)
+}
+
+func debugWithEvaluator(path string, host *object.Host, level optimizer.Level) error {
+	program, err := parseFile(path)
+	if err != nil {
+		return err
+	}
+
+	result := evaluator.Eval(optimizer.Optimize(program, level), object.NewEnvironmentWithHost(host))
+	if errObj, ok := result.(*object.Error); ok && !errors.Is(errObj.Err, object.ErrStopped) {
+		return evaluationError(path, errObj)
+	}
+
+	return nil
+}
+
+// executionError describes a runtime error of the VM with where it happened.
+func executionError(path string, err error) error {
+	var runtimeErr *vm.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		where := path
+		if runtimeErr.Position.Line != 0 {
+			where += ":" + runtimeErr.Position.String()
+		}
+		message := fmt.Sprintf("error happened during execution of %s. %s", where, runtimeErr.Error())
+		if len(runtimeErr.Stack) != 0 {
+			message += "\n" + strings.TrimSuffix(runtimeErr.StackTrace(), "\n")
+		}
+		return errors.New(message)
+	}
+
+	return err
 }
@@ -0,0 +1,51 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"llc/lang/object"
+	"llc/lang/optimizer"
+)
+
+// TestBuildAndRun builds modules to .llcb files and runs them from there.
+func TestBuildAndRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(x) { x * 2 }; print(f(21));", "42\n"},
+		{"let f = fn(x) { if (x) { if (x) { let y = 1; } } }; print(f(true));", "null\n"},
+		{"let f = fn(x) { if (x) { 1 } else { let y = 2; } }; print(f(false));", "null\n"},
+		{"let a = if (true) { let y = 1; }; print(a);", "null\n"},
+		{"let a = if (false) { 1 } else { }; print(a);", "null\n"},
+	}
+
+	for i, tt := range tests {
+		for _, level := range []optimizer.Level{optimizer.O0, optimizer.O1} {
+			name := fmt.Sprintf("[%d] O%d", i, level)
+			t.Run(name, func(t *testing.T) {
+				dir := t.TempDir()
+				path, out := filepath.Join(dir, "main.llc"), filepath.Join(dir, "main.llcb")
+				if err := os.WriteFile(path, []byte(tt.input), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := BuildFile(path, out, level); err != nil {
+					t.Fatalf("build error: %s", err)
+				}
+
+				var stdout bytes.Buffer
+				if err := RunBytecodeFile(out, &object.Host{Stdout: &stdout}); err != nil {
+					t.Fatalf("run error: %s", err)
+				}
+				if stdout.String() != tt.expected {
+					t.Errorf("wrong output. got=%q, want=%q", stdout.String(), tt.expected)
+				}
+			})
+		}
+	}
+}
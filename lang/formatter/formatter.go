@@ -0,0 +1,474 @@
+// Package formatter prints llc programs in one canonical layout: four-space
+// indentation, single spaces around operators, semicolons after every
+// statement but the last of a block, and call arguments, arrays and hashes
+// wrapped one element per line when they do not fit. Comments are kept.
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"llc/lang/ast"
+	"llc/lang/lexer"
+	"llc/lang/parser"
+	"llc/lang/token"
+)
+
+const (
+	indentation = "    "
+	maxWidth    = 80
+)
+
+// Format returns source in the canonical layout. Source with syntax errors
+// cannot be formatted and yields the first of them, as does source the
+// parser passes over without an error, which formatting would drop.
+func Format(source string) (string, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) != 0 {
+		return "", fmt.Errorf("%s: %s", errs[0].Position, errs[0].Message)
+	}
+
+	pr := &printer{lines: strings.Split(source, "\n"), comments: l.Comments()}
+	out := strings.TrimPrefix(pr.statements(program.Statements, token.Position{}, 0), "\n")
+	if out != "" {
+		out += "\n"
+	}
+
+	if err := sameTokens(source, out); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// sameTokens checks that formatted holds the tokens of source in order,
+// but for the semicolons and parentheses the printer adds and drops. It
+// also rejects a string missing its closing quote, which the lexer ends at
+// the end of the source.
+func sameTokens(source, formatted string) error {
+	in, out := tokens(source), tokens(formatted)
+
+	if n := len(in); n != 0 && in[n-1].Type == token.String && unterminated(source, in[n-1]) {
+		return fmt.Errorf("%s: unterminated string", in[n-1].Position())
+	}
+
+	for i, tok := range in {
+		if i == len(out) || out[i].Type != tok.Type || out[i].Literal != tok.Literal {
+			return fmt.Errorf("%s: unexpected %s", tok.Position(), describe(tok))
+		}
+	}
+	if len(out) > len(in) {
+		return fmt.Errorf("formatting adds %s", describe(out[len(in)]))
+	}
+	return nil
+}
+
+// tokens lexes source, leaving out comments, semicolons, parentheses and
+// the final EOF.
+func tokens(source string) []token.Token {
+	l := lexer.New(source)
+
+	var list []token.Token
+	for {
+		tok := l.NextToken()
+		switch tok.Type {
+		case token.Semicolon, token.LParen, token.RParen:
+			continue
+		case token.EOF:
+			return list
+		}
+		list = append(list, tok)
+	}
+}
+
+// unterminated reports whether the string tok, the last token of source,
+// runs to the end of source instead of to a closing quote.
+func unterminated(source string, tok token.Token) bool {
+	lines := strings.Split(source, "\n")
+	rest := string([]rune(lines[tok.Line-1])[tok.Column:])
+	if tok.Line < len(lines) {
+		rest += "\n" + strings.Join(lines[tok.Line:], "\n")
+	}
+	return rest == tok.Literal
+}
+
+func describe(tok token.Token) string {
+	if tok.Type == token.String {
+		return fmt.Sprintf("%q", tok.Literal)
+	}
+	return tok.Literal
+}
+
+type printer struct {
+	lines    []string
+	comments []token.Token
+	// next is the index of the first comment not printed yet.
+	next int
+}
+
+// statements prints each statement on a new line at depth, with the
+// comments before them and, if end is not the zero Position, the ones before
+// end; otherwise all that are left.
+func (p *printer) statements(statements []ast.Statement, end token.Position, depth int) string {
+	var out strings.Builder
+	indent := strings.Repeat(indentation, depth)
+
+	for i, statement := range statements {
+		start := startOf(statement)
+		out.WriteString(p.commentsBefore(start, indent, out.Len() == 0))
+		if out.Len() != 0 && p.blankBefore(start) {
+			out.WriteString("\n")
+		}
+
+		out.WriteString("\n" + indent + p.statement(statement, depth, len(indent)))
+		out.WriteString(terminator(statements, i))
+	}
+
+	out.WriteString(p.commentsBefore(end, indent, out.Len() == 0))
+	return out.String()
+}
+
+// commentsBefore prints the comments before pos, or all that are left if pos
+// is the zero Position. A comment that followed code on its line stays at the
+// end of the line printed last; the others get lines of their own.
+func (p *printer) commentsBefore(pos token.Position, indent string, first bool) string {
+	var out strings.Builder
+
+	for p.next < len(p.comments) && (pos.Line == 0 || p.comments[p.next].Position().Before(pos)) {
+		comment := p.comments[p.next]
+		p.next++
+
+		if p.trailing(comment) {
+			out.WriteString(" " + comment.Literal)
+			continue
+		}
+		if !first && p.blankBefore(comment.Position()) {
+			out.WriteString("\n")
+		}
+		out.WriteString("\n" + indent + comment.Literal)
+		first = false
+	}
+
+	return out.String()
+}
+
+func (p *printer) pendingBefore(pos token.Position) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Position().Before(pos)
+}
+
+// trailing reports whether comment follows code on its line.
+func (p *printer) trailing(comment token.Token) bool {
+	line := []rune(p.lines[comment.Line-1])
+	return strings.TrimSpace(string(line[:comment.Column-1])) != ""
+}
+
+// blankBefore reports whether the line before pos is empty, which is kept to
+// separate groups of statements.
+func (p *printer) blankBefore(pos token.Position) bool {
+	return pos.Line >= 2 && strings.TrimSpace(p.lines[pos.Line-2]) == ""
+}
+
+// terminator is the semicolon ending statements[i], if it needs one. Let
+// statements always do, since their value runs to the next semicolon. Others
+// do unless they end a block, or end with one and the next statement cannot
+// be read as continuing them.
+func terminator(statements []ast.Statement, i int) string {
+	if _, ok := statements[i].(*ast.LetStatement); ok {
+		return ";"
+	}
+	if i == len(statements)-1 {
+		return ""
+	}
+
+	if statement, ok := statements[i].(*ast.ExpressionStatement); ok {
+		switch statement.Expression.(type) {
+		case *ast.IfExpression, *ast.TryExpression:
+			next, ok := statements[i+1].(*ast.ExpressionStatement)
+			if !ok {
+				return ""
+			}
+			switch next.Token.Type {
+			case token.LParen, token.LBracket, token.Minus:
+			default:
+				return ""
+			}
+		}
+	}
+
+	return ";"
+}
+
+// statement prints statement at depth, starting at column.
+func (p *printer) statement(statement ast.Statement, depth, column int) string {
+	switch statement := statement.(type) {
+	case *ast.LetStatement:
+		prefix := "let " + statement.Name.Value
+		if statement.Type != nil {
+			prefix += ": " + statement.Type.String()
+		}
+		prefix += " = "
+		return prefix + p.expression(statement.Value, depth, column+len(prefix))
+	case *ast.ReturnStatement:
+		return "return " + p.expression(statement.ReturnValue, depth, column+len("return "))
+	case *ast.ThrowStatement:
+		return "throw " + p.expression(statement.Value, depth, column+len("throw "))
+	case *ast.ExpressionStatement:
+		return p.expression(statement.Expression, depth, column)
+	case *ast.BlockStatement:
+		return p.block(statement, depth, column)
+	}
+
+	return statement.String()
+}
+
+// expression prints expression at depth, starting at column.
+func (p *printer) expression(expression ast.Expression, depth, column int) string { //nolint:cyclop,funlen
+	switch e := expression.(type) {
+	case *ast.Identifier:
+		return e.Value
+	case *ast.IntegerLiteral, *ast.Boolean:
+		return e.TokenLiteral()
+	case *ast.StringLiteral:
+		return `"` + e.Value + `"`
+	case *ast.PrefixExpression:
+		return e.Operator + p.operand(e.Right, isInfix(e.Right), depth, column+len(e.Operator))
+	case *ast.InfixExpression:
+		precedence := precedenceOf(e.Operator)
+		left := p.operand(e.Left, isInfix(e.Left) && infixPrecedence(e.Left) < precedence, depth, column)
+		middle := " " + e.Operator + " "
+		column = advance(column, left+middle)
+		right := p.operand(e.Right, isInfix(e.Right) && infixPrecedence(e.Right) <= precedence, depth, column)
+		return left + middle + right
+	case *ast.CallExpression:
+		function := p.operand(e.Function, isOperation(e.Function), depth, column)
+		elements := make([]element, len(e.Arguments))
+		for i, argument := range e.Arguments {
+			elements[i] = p.expressionElement(argument)
+		}
+		return function + p.list("(", elements, ")", depth, advance(column, function))
+	case *ast.IndexExpression:
+		left := p.operand(e.Left, isOperation(e.Left), depth, column)
+		index := p.expression(e.Index, depth, advance(column, left)+1)
+		return left + "[" + index + "]"
+	case *ast.PropagateExpression:
+		return p.operand(e.Value, isOperation(e.Value), depth, column) + "?"
+	case *ast.ArrayLiteral:
+		elements := make([]element, len(e.Elements))
+		for i, element := range e.Elements {
+			elements[i] = p.expressionElement(element)
+		}
+		return p.list("[", elements, "]", depth, column)
+	case *ast.HashLiteral:
+		return p.list("{", p.pairs(e), "}", depth, column)
+	case *ast.FunctionLiteral:
+		head := "fn(" + parameters(e.Parameters, e.ParameterTypes) + ") "
+		if e.ReturnType != nil {
+			head += "-> " + e.ReturnType.String() + " "
+		}
+		return head + p.block(e.Body, depth, column+len(head))
+	case *ast.MacroLiteral:
+		head := "macro(" + parameters(e.Parameters, nil) + ") "
+		return head + p.block(e.Body, depth, column+len(head))
+	case *ast.IfExpression:
+		head := "if (" + p.expression(e.Condition, depth, column+len("if (")) + ") "
+		out := head + p.block(e.Consequence, depth, advance(column, head))
+		if e.Alternative != nil {
+			out += " else " + p.block(e.Alternative, depth, advance(column, out)+len(" else "))
+		}
+		return out
+	case *ast.TryExpression:
+		out := "try " + p.block(e.Block, depth, column+len("try "))
+		if e.Catch != nil {
+			head := " catch (" + e.CatchParameter.Value + ") "
+			out += head + p.block(e.Catch, depth, advance(column, out+head))
+		}
+		if e.Finally != nil {
+			out += " finally " + p.block(e.Finally, depth, advance(column, out)+len(" finally "))
+		}
+		return out
+	}
+
+	return expression.String()
+}
+
+// operand prints an operand of an operator, in parentheses if grouped.
+func (p *printer) operand(operand ast.Expression, grouped bool, depth, column int) string {
+	if grouped {
+		return "(" + p.expression(operand, depth, column+1) + ")"
+	}
+	return p.expression(operand, depth, column)
+}
+
+// block prints block on one line if it was written on one line, holds a
+// single statement and still fits; otherwise one statement per line.
+func (p *printer) block(block *ast.BlockStatement, depth, column int) string {
+	end := block.RBrace.Position()
+	if p.pendingBefore(end) {
+		return p.multilineBlock(block, depth)
+	}
+
+	switch {
+	case len(block.Statements) == 0:
+		return "{}"
+	case len(block.Statements) == 1 && block.Token.Line == block.RBrace.Line:
+		out := "{ " + p.statement(block.Statements[0], depth, column+2) + terminator(block.Statements, 0) + " }"
+		if !strings.Contains(out, "\n") && fits(column, out) {
+			return out
+		}
+	}
+
+	return p.multilineBlock(block, depth)
+}
+
+func (p *printer) multilineBlock(block *ast.BlockStatement, depth int) string {
+	return "{" + p.statements(block.Statements, block.RBrace.Position(), depth+1) +
+		"\n" + strings.Repeat(indentation, depth) + "}"
+}
+
+// element is an argument of a call, an element of an array or a pair of a
+// hash, printed at a depth and column.
+type element struct {
+	start token.Position
+	print func(depth, column int) string
+}
+
+func (p *printer) expressionElement(expression ast.Expression) element {
+	return element{start: startOf(expression), print: func(depth, column int) string {
+		return p.expression(expression, depth, column)
+	}}
+}
+
+// pairs are the pairs of hash in source order.
+func (p *printer) pairs(hash *ast.HashLiteral) []element {
+	keys := make([]ast.Expression, 0, len(hash.Pairs))
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return startOf(keys[i]).Before(startOf(keys[j])) })
+
+	elements := make([]element, len(keys))
+	for i, key := range keys {
+		elements[i] = element{start: startOf(key), print: func(depth, column int) string {
+			out := p.expression(key, depth, column) + ": "
+			return out + p.expression(hash.Pairs[key], depth, advance(column, out))
+		}}
+	}
+	return elements
+}
+
+// list prints elements between open and close on one line if they fit and
+// no comment comes between them; otherwise one element per line.
+func (p *printer) list(open string, elements []element, closing string, depth, column int) string {
+	next := p.next
+
+	out := open
+	flat := true
+	for i, e := range elements {
+		if i > 0 {
+			out += ", "
+		}
+		if p.pendingBefore(e.start) {
+			flat = false
+			break
+		}
+		out += e.print(depth, advance(column, out))
+	}
+	out += closing
+	if flat && fits(column, out) {
+		return out
+	}
+	p.next = next
+
+	indent := strings.Repeat(indentation, depth+1)
+	var wrapped strings.Builder
+	wrapped.WriteString(open)
+	for i, e := range elements {
+		wrapped.WriteString(p.commentsBefore(e.start, indent, i == 0))
+		wrapped.WriteString("\n" + indent + e.print(depth+1, len(indent)))
+		if i < len(elements)-1 {
+			wrapped.WriteString(",")
+		}
+	}
+	wrapped.WriteString("\n" + strings.Repeat(indentation, depth) + closing)
+
+	return wrapped.String()
+}
+
+func parameters(identifiers []*ast.Identifier, types []*ast.Type) string {
+	names := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		names[i] = identifier.Value
+		if i < len(types) && types[i] != nil {
+			names[i] += ": " + types[i].String()
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func isInfix(expression ast.Expression) bool {
+	_, ok := expression.(*ast.InfixExpression)
+	return ok
+}
+
+// isOperation reports whether expression needs parentheses to be called,
+// indexed or propagated.
+func isOperation(expression ast.Expression) bool {
+	switch expression.(type) {
+	case *ast.InfixExpression, *ast.PrefixExpression:
+		return true
+	}
+	return false
+}
+
+func infixPrecedence(expression ast.Expression) int {
+	return precedenceOf(expression.(*ast.InfixExpression).Operator)
+}
+
+func precedenceOf(operator string) int {
+	switch operator {
+	case "==", "!=":
+		return parser.EQUALS
+	case "<", ">":
+		return parser.LESSGRATER
+	case "+", "-":
+		return parser.SUM
+	}
+	return parser.PRODUCT
+}
+
+// startOf is the position of the first token of node.
+func startOf(node ast.Node) token.Position {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return startOf(node.Left)
+	case *ast.CallExpression:
+		return startOf(node.Function)
+	case *ast.IndexExpression:
+		return startOf(node.Left)
+	case *ast.PropagateExpression:
+		return startOf(node.Value)
+	}
+	return ast.Pos(node)
+}
+
+// advance is the column after printing s from column.
+func advance(column int, s string) int {
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return utf8.RuneCountInString(s[i+1:])
+	}
+	return column + utf8.RuneCountInString(s)
+}
+
+// fits reports whether s, printed from column, stays within maxWidth.
+func fits(column int, s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if column+utf8.RuneCountInString(line) > maxWidth {
+			return false
+		}
+		column = 0
+	}
+	return true
+}
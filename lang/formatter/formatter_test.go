@@ -0,0 +1,150 @@
+package formatter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"llc/lang/lexer"
+	"llc/lang/parser"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{
+			"let x=1+2*3;let f=fn(a,b){\n  a+b\n};f(x,2)",
+			"let x = 1 + 2 * 3;\nlet f = fn(a, b) {\n    a + b\n};\nf(x, 2)\n",
+		},
+		{
+			"(1 + 2) * 3 - (4 - 5); -(a + b); (-f)(x); !(-x)?; a - b - c",
+			"(1 + 2) * 3 - (4 - 5);\n-(a + b);\n(-f)(x);\n!(-x)?;\na - b - c\n",
+		},
+		{"let f = fn(x) { x * 2 }; let g = fn() {}", "let f = fn(x) { x * 2 };\nlet g = fn() {};\n"},
+		{
+			"if (x) { 1 }; print(x); if (x) { return 1; } else { 2 }; -1",
+			"if (x) { 1 }\nprint(x);\nif (x) { return 1 } else { 2 };\n-1\n",
+		},
+		{
+			"try { risky() } catch (e) { print(e) } finally { done() }; macro(a) { quote(unquote(a) + 1) }",
+			"try { risky() } catch (e) { print(e) } finally { done() }\nmacro(a) { quote(unquote(a) + 1) }\n",
+		},
+		{`{"b":1,"a":[true,false]}["a"]`, "{\"b\": 1, \"a\": [true, false]}[\"a\"]\n"},
+		{
+			"let xs:[int]=[1];let f=fn(a:int,b)->{string:fn(int)->bool}{a}",
+			"let xs: [int] = [1];\nlet f = fn(a: int, b) -> {string: fn(int) -> bool} { a };\n",
+		},
+		{
+			"// header\nlet x = 1; // one\n\n\n\n// about y\nlet y = fn() {\n  // inside\n" +
+				"  x // the result\n  // at the end\n};\n// trailer",
+			"// header\nlet x = 1; // one\n\n// about y\nlet y = fn() {\n    // inside\n" +
+				"    x // the result\n    // at the end\n};\n// trailer\n",
+		},
+		{
+			`let words = ["alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel"];`,
+			"let words = [\n    \"alpha\",\n    \"bravo\",\n    \"charlie\",\n    \"delta\",\n" +
+				"    \"echo\",\n    \"foxtrot\",\n    \"golf\",\n    \"hotel\"\n];\n",
+		},
+		{
+			`let f = fn() { describe("a fairly long description", {"first": 1, "second": 2, "third": 3}) };`,
+			"let f = fn() {\n    describe(\"a fairly long description\", {\"first\": 1, \"second\": 2, \"third\": 3})\n" +
+				"};\n",
+		},
+		{
+			"let xs = [1, // one\n2];\nmap(xs, fn(x) {\nx * 2\n})",
+			"let xs = [\n    1, // one\n    2\n];\nmap(xs, fn(x) {\n    x * 2\n})\n",
+		},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			got, err := Format(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.expected {
+				t.Fatalf("wrong output.\ngot=\n%s\nwant=\n%s", got, tt.expected)
+			}
+
+			again, err := Format(got)
+			if err != nil || again != got {
+				t.Errorf("formatting is not idempotent. got=\n%s", again)
+			}
+		})
+	}
+}
+
+func TestFormatSyntaxError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nlet = 2;", "2:5: expected next token to be IDENT, but got = instead"},
+		{"a[1", "1:4: expected next token to be ], but got EOF instead"},
+		{"quote [ false 0", "1:15: expected next token to be ], but got INT instead"},
+		{"f(1", "1:4: expected next token to be ), but got EOF instead"},
+		// The parser skips these tokens without an error.
+		{`let b = "x" y z;`, "1:13: unexpected y"},
+		{"let a = 1\n\"a\"", `2:1: unexpected "a"`},
+		{"let a = \"x;\nlet b = 2;\n", "1:9: unterminated string"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			_, err := Format(tt.input)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("wrong error. got=%v, want=%q", err, tt.expected)
+			}
+		})
+	}
+}
+
+// TestSources formats the examples and the standard library, which are kept
+// formatted, and checks that formatting does not change their meaning.
+func TestSources(t *testing.T) {
+	paths, err := filepath.Glob("../../examples/*.llc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	std, err := filepath.Glob("../../std/*.llc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range append(paths, std...) {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			formatted, err := Format(string(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formatted != string(source) {
+				t.Errorf("%s is not formatted. want=\n%s", path, formatted)
+			}
+			if parse(t, formatted) != parse(t, string(source)) {
+				t.Errorf("formatting changed the program")
+			}
+		})
+	}
+}
+
+func parse(t *testing.T, source string) string {
+	t.Helper()
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program.String()
+}
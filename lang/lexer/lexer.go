@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"llc/lang/token"
 )
 
@@ -9,9 +11,19 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           rune // current char under examination
+	line         int  // line of the current char
+	column       int  // column of the current char
+	comments     []token.Token
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -30,14 +42,27 @@ func (l *Lexer) peakChar() rune {
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: []rune(input)}
+	l := &Lexer{input: []rune(input), line: 1}
 	l.readChar()
 	return l
 }
 
-func (l *Lexer) NextToken() token.Token { //nolint:cyclop,funlen
-	var tok token.Token
+func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
+	for l.ch == '/' && l.peakChar() == '/' {
+		l.comments = append(l.comments, l.readComment())
+		l.skipWhitespace()
+	}
+
+	line, column := l.line, l.column
+	tok := l.nextToken()
+	tok.Line, tok.Column = line, column
+
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token { //nolint:cyclop,funlen
+	var tok token.Token
 	switch l.ch {
 	case '!':
 		if l.peakChar() == '=' {
@@ -73,14 +98,23 @@ func (l *Lexer) NextToken() token.Token { //nolint:cyclop,funlen
 		tok = newToken(token.RBracket, l.ch)
 	case ',':
 		tok = newToken(token.Comma, l.ch)
+	case '.':
+		tok = newToken(token.Dot, l.ch)
 	case '+':
 		tok = newToken(token.Plus, l.ch)
 	case '-':
-		tok = newToken(token.Minus, l.ch)
+		if l.peakChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.Arrow, Literal: "->"}
+		} else {
+			tok = newToken(token.Minus, l.ch)
+		}
 	case '*':
 		tok = newToken(token.Asterisk, l.ch)
 	case '/':
 		tok = newToken(token.Slash, l.ch)
+	case '?':
+		tok = newToken(token.Question, l.ch)
 	case '{':
 		tok = newToken(token.LBrace, l.ch)
 	case '}':
@@ -108,6 +142,24 @@ func (l *Lexer) NextToken() token.Token { //nolint:cyclop,funlen
 	return tok
 }
 
+// Comments returns the comments skipped so far, in source order. A comment
+// runs from // to the end of its line.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+func (l *Lexer) readComment() token.Token {
+	tok := token.Token{Type: token.Comment, Line: l.line, Column: l.column}
+
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	tok.Literal = strings.TrimRight(string(l.input[position:l.position]), " \t\r")
+
+	return tok
+}
+
 func (l *Lexer) readString() string {
 	position := l.position + 1
 	for {
@@ -121,18 +173,25 @@ func (l *Lexer) readString() string {
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	validIdentifierSymbol := func(ch rune) bool {
-		return isLetter(ch) || isDigit(ch) || ch == '_'
-	}
-
-	for validIdentifierSymbol(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	return string(l.input[position:l.position])
 }
 
+// IsIdentifier reports whether s is read as a single identifier or keyword.
+func IsIdentifier(s string) bool {
+	for i, ch := range s {
+		if !isLetter(ch) && (i == 0 || !isDigit(ch)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isLetter reports whether ch can start an identifier.
 func isLetter(ch rune) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
 func newToken(tokenType token.TypeTocken, ch rune) token.Token {
@@ -164,3 +164,111 @@ macro(x, y) { x + y };
 		}
 	}
 }
+
+func TestDotToken(t *testing.T) {
+	l := New("math.abs")
+
+	expected := []token.Token{
+		{Type: token.Ident, Literal: "math", Line: 1, Column: 1},
+		{Type: token.Dot, Literal: ".", Line: 1, Column: 5},
+		{Type: token.Ident, Literal: "abs", Line: 1, Column: 6},
+		{Type: token.EOF, Literal: "", Line: 1, Column: 9},
+	}
+
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok != want {
+			t.Fatalf("tests[%d] - wrong token. expected=%+v, got=%+v", i, want, tok)
+		}
+	}
+}
+
+func TestUnderscoreIdentifiers(t *testing.T) {
+	l := New("_debug(a_1)")
+
+	expected := []token.Token{
+		{Type: token.Ident, Literal: "_debug", Line: 1, Column: 1},
+		{Type: token.LParen, Literal: "(", Line: 1, Column: 7},
+		{Type: token.Ident, Literal: "a_1", Line: 1, Column: 8},
+		{Type: token.RParen, Literal: ")", Line: 1, Column: 11},
+		{Type: token.EOF, Literal: "", Line: 1, Column: 12},
+	}
+
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok != want {
+			t.Fatalf("tests[%d] - wrong token. expected=%+v, got=%+v", i, want, tok)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x(\"a\nb\")\n\tfoo"
+
+	expected := []token.Position{
+		{Line: 1, Column: 1},
+		{Line: 1, Column: 5},
+		{Line: 1, Column: 7},
+		{Line: 1, Column: 9},
+		{Line: 1, Column: 10},
+		{Line: 2, Column: 3},
+		{Line: 2, Column: 4},
+		{Line: 2, Column: 5},
+		{Line: 3, Column: 3},
+		{Line: 4, Column: 2},
+		{Line: 4, Column: 5},
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Position() != want {
+			t.Fatalf("tests[%d] - wrong position of %q. expected=%s, got=%s", i, tok.Literal, want, tok.Position())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// header\nlet x = 5; // five  \n10 / 2\n//"
+
+	expectedTokens := []token.TypeTocken{
+		token.Let, token.Ident, token.Assign, token.Int, token.Semicolon, token.Int, token.Slash, token.Int, token.EOF,
+	}
+	expectedComments := []token.Token{
+		{Type: token.Comment, Literal: "// header", Line: 1, Column: 1},
+		{Type: token.Comment, Literal: "// five", Line: 2, Column: 12},
+		{Type: token.Comment, Literal: "//", Line: 4, Column: 1},
+	}
+
+	l := New(input)
+	for i, want := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, want := range expectedComments {
+		if comments[i] != want {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, want, comments[i])
+		}
+	}
+}
+
+func TestArrowToken(t *testing.T) {
+	l := New("fn() -> int - 1")
+
+	expected := []token.TypeTocken{
+		token.Function, token.LParen, token.RParen, token.Arrow, token.Ident, token.Minus, token.Int, token.EOF,
+	}
+
+	for i, want := range expected {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+}
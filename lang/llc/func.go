@@ -0,0 +1,123 @@
+package llc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"llc/lang/object"
+)
+
+var (
+	hostType  = reflect.TypeOf((*object.Host)(nil))
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// WrapFunc turns an ordinary Go function into a builtin. Arguments are
+// converted with Decode and checked before the call; the result is converted
+// with ToObject. The function may take a leading *object.Host and may return
+// nothing, a value, an error, or a value and an error.
+func WrapFunc(fn interface{}) (object.BuiltinFunction, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("builtin must be a function, got %T", fn)
+	}
+
+	t := v.Type()
+	if err := checkResults(t); err != nil {
+		return nil, err
+	}
+
+	params := make([]reflect.Type, 0, t.NumIn())
+	for i := range t.NumIn() {
+		params = append(params, t.In(i))
+	}
+
+	takesHost := len(params) > 0 && params[0] == hostType
+	if takesHost {
+		params = params[1:]
+	}
+
+	return func(host *object.Host, args ...object.Object) (result object.Object) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = &object.Error{Message: fmt.Sprintf("panic in builtin: %v", r)}
+			}
+		}()
+
+		in, err := convertArgs(params, t.IsVariadic(), args)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+
+		if takesHost {
+			in = append([]reflect.Value{reflect.ValueOf(host)}, in...)
+		}
+
+		return convertResults(v.Call(in))
+	}, nil
+}
+
+func checkResults(t reflect.Type) error {
+	switch t.NumOut() {
+	case 0, 1:
+		return nil
+	case 2:
+		if t.Out(1) != errorType {
+			return errors.New("second result of builtin must be error")
+		}
+		return nil
+	default:
+		return fmt.Errorf("builtin must return at most 2 values, got %d", t.NumOut())
+	}
+}
+
+func convertArgs(params []reflect.Type, variadic bool, args []object.Object) ([]reflect.Value, error) {
+	fixed := len(params)
+	if variadic {
+		fixed--
+	}
+
+	if len(args) < fixed || !variadic && len(args) != fixed {
+		if variadic {
+			return nil, fmt.Errorf("wrong number of arguments. got=%d, want at least %d", len(args), fixed)
+		}
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=%d", len(args), fixed)
+	}
+
+	in := make([]reflect.Value, 0, len(args))
+	for i, arg := range args {
+		paramType := params[min(i, len(params)-1)]
+		if variadic && i >= fixed {
+			paramType = paramType.Elem()
+		}
+
+		value := reflect.New(paramType).Elem()
+		if err := decode(arg, value); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		in = append(in, value)
+	}
+
+	return in, nil
+}
+
+func convertResults(out []reflect.Value) object.Object {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		out = out[:len(out)-1]
+	}
+
+	if len(out) == 0 {
+		return object.NULL
+	}
+
+	obj, err := toObject(out[0], make(map[visit]bool))
+	if err != nil {
+		return &object.Error{Message: fmt.Sprintf("builtin result: %s", err)}
+	}
+
+	return obj
+}
@@ -0,0 +1,101 @@
+package llc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"llc/lang/object"
+)
+
+func TestWrapFunc(t *testing.T) {
+	tests := []struct {
+		fn       interface{}
+		args     []object.Object
+		expected string
+	}{
+		{func(a, b int) int { return a + b }, ints(1, 2), "3"},
+		{func(s string) string { return strings.ToUpper(s) }, []object.Object{str("abc")}, "ABC"},
+		{func(xs []int) int { return len(xs) }, []object.Object{&object.Array{Elements: ints(1, 2)}}, "2"},
+		{func() {}, nil, "null"},
+		{func() error { return nil }, nil, "null"},
+		{func(n int) (int, error) { return n * 2, nil }, ints(4), "8"},
+		{func(sep string, xs ...int) int { return len(sep) + len(xs) }, []object.Object{str("--"), ints(1)[0]}, "3"},
+		{func(xs ...int) int { return len(xs) }, nil, "0"},
+		{func(obj object.Object) string { return string(obj.Type()) }, ints(1), "INTEGER"},
+		{func(h *object.Host, n int) bool { return h.Allows(object.CapFS) && n == 1 }, ints(1), "true"},
+		{func(m map[string]int) []string { return []string{"k"} }, []object.Object{&object.Hash{}}, "[k]"},
+	}
+
+	host := &object.Host{Capabilities: object.CapFS}
+	for _, tt := range tests {
+		builtin, err := WrapFunc(tt.fn)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		result := builtin(host, tt.args...)
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %T. got=%s, want=%s", tt.fn, result.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestWrapFuncErrors(t *testing.T) {
+	tests := []struct {
+		fn       interface{}
+		args     []object.Object
+		expected string
+	}{
+		{func(a, b int) int { return a + b }, ints(1), "wrong number of arguments. got=1, want=2"},
+		{func(s string, xs ...int) int { return 0 }, nil, "wrong number of arguments. got=0, want at least 1"},
+		{func(a int) int { return a }, []object.Object{str("x")}, "argument 1: cannot decode STRING into int"},
+		{func(xs ...int) int { return 0 }, []object.Object{ints(1)[0], str("x")}, "argument 2: cannot decode STRING into int"},
+		{func() (int, error) { return 0, errors.New("boom") }, nil, "boom"},
+		{func() float64 { return 1.5 }, nil, "builtin result: unsupported Go type float64"},
+		{func() int { panic("bad") }, nil, "panic in builtin: bad"},
+	}
+
+	for _, tt := range tests {
+		builtin, err := WrapFunc(tt.fn)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		result := builtin(nil, tt.args...)
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("expected error for %T. got=%s", tt.fn, result.Inspect())
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error. got=%q, want=%q", errObj.Message, tt.expected)
+		}
+	}
+
+	invalid := []interface{}{
+		42,
+		(func())(nil),
+		func() (int, int) { return 0, 0 },
+		func() (int, int, error) { return 0, 0, nil },
+	}
+
+	for _, fn := range invalid {
+		if _, err := WrapFunc(fn); err == nil {
+			t.Errorf("expected WrapFunc error for %T", fn)
+		}
+	}
+}
+
+func ints(values ...int64) []object.Object {
+	objects := make([]object.Object, 0, len(values))
+	for _, v := range values {
+		objects = append(objects, &object.Integer{Value: v})
+	}
+	return objects
+}
+
+func str(s string) object.Object {
+	return &object.String{Value: s}
+}
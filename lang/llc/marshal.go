@@ -0,0 +1,357 @@
+package llc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"llc/lang/object"
+)
+
+// ToObject converts a Go value into an llc object. Integers, strings, bools,
+// slices, arrays, maps and structs are supported; struct fields are named by
+// their `llc` tag (`llc:"-"` skips a field) and default to the field name.
+func ToObject(value interface{}) (object.Object, error) {
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+
+	if value == nil {
+		return object.NULL, nil
+	}
+
+	return toObject(reflect.ValueOf(value), make(map[visit]bool))
+}
+
+// visit is a pointer, map or slice on the path from the value ToObject was
+// given to the one being converted. Meeting one again means the value is
+// cyclic, which llc objects cannot be.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func toObject(v reflect.Value, visiting map[visit]bool) (object.Object, error) { //nolint:cyclop
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if !v.IsNil() {
+			key := visit{ptr: v.Pointer(), typ: v.Type()}
+			if v.Kind() == reflect.Slice {
+				key.len = v.Len()
+			}
+			if visiting[key] {
+				return nil, fmt.Errorf("cyclic value of type %s", v.Type())
+			}
+			visiting[key] = true
+			defer delete(visiting, key)
+		}
+	}
+
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.Bool:
+		if v.Bool() {
+			return object.TRUE, nil
+		}
+		return object.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d overflows llc integer", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil //nolint:gosec
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return object.NULL, nil
+		}
+		return sliceToObject(v, visiting)
+	case reflect.Map:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		return mapToObject(v, visiting)
+	case reflect.Struct:
+		return structToObject(v, visiting)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		if obj, ok := v.Interface().(object.Object); ok {
+			return obj, nil
+		}
+		return toObject(v.Elem(), visiting)
+	default:
+		return nil, fmt.Errorf("unsupported Go type %s", v.Type())
+	}
+}
+
+func sliceToObject(v reflect.Value, visiting map[visit]bool) (object.Object, error) {
+	elements := make([]object.Object, 0, v.Len())
+	for i := range v.Len() {
+		element, err := toObject(v.Index(i), visiting)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+
+	return &object.Array{Elements: elements}, nil
+}
+
+func mapToObject(v reflect.Value, visiting map[visit]bool) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair, v.Len())
+
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := toObject(iter.Key(), visiting)
+		if err != nil {
+			return nil, err
+		}
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		value, err := toObject(iter.Value(), visiting)
+		if err != nil {
+			return nil, err
+		}
+
+		pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func structToObject(v reflect.Value, visiting map[visit]bool) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	t := v.Type()
+	for i := range t.NumField() {
+		name, ok := fieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+
+		value, err := toObject(v.Field(i), visiting)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", t.Field(i).Name, err)
+		}
+
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+
+	tag, _, _ := strings.Cut(field.Tag.Get("llc"), ",")
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// FromObject converts obj into plain Go values: int64, string, bool, nil,
+// []interface{} and map[string]interface{}.
+func FromObject(obj object.Object) (interface{}, error) {
+	var value interface{}
+	err := Decode(obj, &value)
+	return value, err
+}
+
+// Decode stores obj in the value pointed to by target, following the same
+// rules as ToObject in reverse.
+func Decode(obj object.Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return errors.New("decode target must be a non-nil pointer")
+	}
+
+	return decode(obj, v.Elem())
+}
+
+func decode(obj object.Object, v reflect.Value) error { //nolint:cyclop,funlen,gocognit
+	if obj.Type() == object.NullObj {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			if !reflect.TypeOf(obj).AssignableTo(v.Type()) {
+				return fmt.Errorf("cannot decode %s into %s", obj.Type(), v.Type())
+			}
+			v.Set(reflect.ValueOf(obj))
+			return nil
+		}
+		value, err := decodeGeneric(obj)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+		return nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decode(obj, v.Elem())
+	case reflect.Bool:
+		boolean, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch(obj, v)
+		}
+		v.SetBool(boolean.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch(obj, v)
+		}
+		if v.OverflowInt(integer.Value) {
+			return fmt.Errorf("integer %d overflows %s", integer.Value, v.Type())
+		}
+		v.SetInt(integer.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch(obj, v)
+		}
+		if integer.Value < 0 || v.OverflowUint(uint64(integer.Value)) { //nolint:gosec
+			return fmt.Errorf("integer %d overflows %s", integer.Value, v.Type())
+		}
+		v.SetUint(uint64(integer.Value)) //nolint:gosec
+	case reflect.String:
+		str, ok := obj.(*object.String)
+		if !ok {
+			return mismatch(obj, v)
+		}
+		v.SetString(str.Value)
+	case reflect.Slice:
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch(obj, v)
+		}
+		slice := reflect.MakeSlice(v.Type(), len(array.Elements), len(array.Elements))
+		for i, element := range array.Elements {
+			if err := decode(element, slice.Index(i)); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	case reflect.Array:
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch(obj, v)
+		}
+		if len(array.Elements) != v.Len() {
+			return fmt.Errorf("cannot decode array of %d elements into %s", len(array.Elements), v.Type())
+		}
+		for i, element := range array.Elements {
+			if err := decode(element, v.Index(i)); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return mismatch(obj, v)
+		}
+		return decodeMap(hash, v)
+	case reflect.Struct:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return mismatch(obj, v)
+		}
+		return decodeStruct(hash, v)
+	default:
+		return fmt.Errorf("unsupported Go type %s", v.Type())
+	}
+
+	return nil
+}
+
+func decodeGeneric(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Array:
+		var elements []interface{}
+		err := decode(obj, reflect.ValueOf(&elements).Elem())
+		return elements, err
+	case *object.Hash:
+		var pairs map[string]interface{}
+		err := decode(obj, reflect.ValueOf(&pairs).Elem())
+		return pairs, err
+	default:
+		return obj, nil
+	}
+}
+
+func decodeMap(hash *object.Hash, v reflect.Value) error {
+	m := reflect.MakeMapWithSize(v.Type(), len(hash.Pairs))
+
+	for _, pair := range hash.Pairs {
+		key := reflect.New(v.Type().Key()).Elem()
+		if err := decode(pair.Key, key); err != nil {
+			return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+		}
+
+		value := reflect.New(v.Type().Elem()).Elem()
+		if err := decode(pair.Value, value); err != nil {
+			return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+		}
+
+		m.SetMapIndex(key, value)
+	}
+
+	v.Set(m)
+	return nil
+}
+
+func decodeStruct(hash *object.Hash, v reflect.Value) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		name, ok := fieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+
+		key := &object.String{Value: name}
+		pair, ok := hash.Pairs[key.HashKey()]
+		if !ok {
+			continue
+		}
+
+		if err := decode(pair.Value, v.Field(i)); err != nil {
+			return fmt.Errorf("field %s: %w", t.Field(i).Name, err)
+		}
+	}
+
+	return nil
+}
+
+func mismatch(obj object.Object, v reflect.Value) error {
+	return fmt.Errorf("cannot decode %s into %s", obj.Type(), v.Type())
+}
@@ -0,0 +1,199 @@
+package llc
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"llc/lang/object"
+)
+
+type address struct {
+	City string `llc:"city"`
+}
+
+type user struct {
+	Address  *address        `llc:"address"`
+	Tags     map[string]bool `llc:"tags"`
+	Name     string          `llc:"name"`
+	Password string          `llc:"-"`
+	Scores   []int64         `llc:"scores"`
+	Age      uint8           `llc:"age"`
+	Extra    map[int64]string
+	internal int
+}
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{int8(-3), "-3"},
+		{uint32(7), "7"},
+		{"text", "text"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]interface{}{1, "a", nil}, "[1, a, null]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{map[int]bool{2: false}, "{2: false}"},
+		{&address{City: "Kyiv"}, "{city: Kyiv}"},
+		{(*address)(nil), "null"},
+		{&object.Integer{Value: 5}, "5"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.value)
+		if err != nil {
+			t.Errorf("unexpected error for %#v: %s", tt.value, err)
+			continue
+		}
+
+		if obj.Inspect() != tt.expected {
+			t.Errorf("wrong object for %#v. got=%s, want=%s", tt.value, obj.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestToObjectErrors(t *testing.T) {
+	tests := []interface{}{
+		1.5,
+		uint64(math.MaxUint64),
+		map[float64]int{1: 1},
+		[]func(){func() {}},
+		struct{ C chan int }{},
+	}
+
+	for _, value := range tests {
+		if _, err := ToObject(value); err == nil {
+			t.Errorf("expected error for %#v", value)
+		}
+	}
+}
+
+type node struct {
+	Next  *node `llc:"next"`
+	Value int   `llc:"value"`
+}
+
+func TestToObjectCycles(t *testing.T) {
+	loop := &node{Value: 1}
+	loop.Next = &node{Value: 2, Next: loop}
+
+	slice := []interface{}{1, nil}
+	slice[1] = slice
+
+	hash := map[string]interface{}{}
+	hash["self"] = hash
+
+	for _, value := range []interface{}{loop, slice, hash} {
+		if _, err := ToObject(value); err == nil || !strings.Contains(err.Error(), "cyclic value") {
+			t.Errorf("expected a cycle error for %T. got=%v", value, err)
+		}
+	}
+
+	// Values reached twice without a cycle are fine.
+	shared := &address{City: "Lviv"}
+	obj, err := ToObject([]*address{shared, shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Inspect() != "[{city: Lviv}, {city: Lviv}]" {
+		t.Errorf("wrong object. got=%s", obj.Inspect())
+	}
+}
+
+func TestStructRoundTrip(t *testing.T) {
+	in := user{
+		Name:     "ada",
+		Age:      36,
+		Password: "secret",
+		Scores:   []int64{10, 20},
+		Address:  &address{City: "London"},
+		Tags:     map[string]bool{"admin": true},
+		Extra:    map[int64]string{1: "one"},
+		internal: 1,
+	}
+
+	obj, err := ToObject(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		t.Fatalf("struct must become Hash. got=%T", obj)
+	}
+
+	if len(hash.Pairs) != 6 {
+		t.Errorf("wrong number of fields. got=%d (%s)", len(hash.Pairs), hash.Inspect())
+	}
+
+	var out user
+	if err := Decode(obj, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	in.Password = ""
+	in.internal = 0
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch.\nwant=%+v\ngot=%+v", in, out)
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	obj, err := ToObject(map[string]interface{}{
+		"list":  []interface{}{int64(1), "two", true, nil},
+		"inner": map[string]interface{}{"x": int64(1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := FromObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"list":  []interface{}{int64(1), "two", true, nil},
+		"inner": map[string]interface{}{"x": int64(1)},
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("wrong value.\nwant=%#v\ngot=%#v", expected, value)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var small int8
+	var unsigned uint
+	var text string
+	var pair [2]int
+	var obj object.Object
+
+	tests := []struct {
+		obj      object.Object
+		target   interface{}
+		expected string
+	}{
+		{&object.Integer{Value: 300}, &small, "integer 300 overflows int8"},
+		{&object.Integer{Value: -1}, &unsigned, "integer -1 overflows uint"},
+		{&object.Integer{Value: 1}, &text, "cannot decode INTEGER into string"},
+		{&object.Array{}, &pair, "cannot decode array of 0 elements into [2]int"},
+		{&object.Integer{Value: 1}, text, "decode target must be a non-nil pointer"},
+	}
+
+	for _, tt := range tests {
+		err := Decode(tt.obj, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. got=%v, want=%q", err, tt.expected)
+		}
+	}
+
+	fn := &object.Builtin{}
+	if err := Decode(fn, &obj); err != nil || obj != fn {
+		t.Errorf("objects must decode into object.Object targets. got=%v, %v", obj, err)
+	}
+}
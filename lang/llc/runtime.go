@@ -0,0 +1,199 @@
+package llc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"llc/lang/ast"
+	"llc/lang/builtins"
+	"llc/lang/evaluator"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/optimizer"
+	"llc/lang/parser"
+)
+
+// ErrLimitExceeded is returned when a script runs past the runtime's limits.
+var ErrLimitExceeded = object.ErrLimitExceeded
+
+// Runtime is an interpreter instance with its own global environment. It is
+// not safe for concurrent use.
+type Runtime struct {
+	env      *object.Environment
+	host     *object.Host
+	registry *builtins.Registry
+}
+
+func New() *Runtime {
+	return NewWithHost(nil)
+}
+
+// NewWithHost creates a runtime using a copy of host, so builtins registered
+// on the runtime never leak into other runtimes sharing the same host value.
+func NewWithHost(host *object.Host) *Runtime {
+	h := &object.Host{}
+	if host != nil {
+		*h = *host
+	}
+
+	registry := builtins.NewRegistry()
+	h.Builtins = registry
+
+	return &Runtime{
+		env:      object.NewEnvironmentWithHost(h),
+		host:     h,
+		registry: registry,
+	}
+}
+
+// SetLimits bounds every later evaluation and call on the runtime.
+func (r *Runtime) SetLimits(limits object.Limits) {
+	r.host.Limits = limits
+}
+
+func (r *Runtime) EvalString(source string) (object.Object, error) {
+	return r.EvalStringContext(context.Background(), source)
+}
+
+// EvalStringContext evaluates source, stopping with ctx.Err() when ctx is done
+// or with ErrLimitExceeded when the runtime's limits are exceeded.
+func (r *Runtime) EvalStringContext(ctx context.Context, source string) (object.Object, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse errors: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	return r.eval(ctx, program)
+}
+
+func (r *Runtime) EvalFile(path string) (object.Object, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.EvalString(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return result, nil
+}
+
+func (r *Runtime) eval(ctx context.Context, program *ast.Program) (object.Object, error) {
+	evaluator.DefineMacros(program, r.env)
+	expanded, _ := evaluator.ExpandMacros(program, r.env).(*ast.Program)
+
+	return result(evaluator.EvalContext(ctx, optimizer.Optimize(expanded, optimizer.Default), r.env))
+}
+
+func (r *Runtime) Get(name string) (object.Object, bool) {
+	return r.env.Get(name)
+}
+
+// Set binds a global after converting value with ToObject.
+func (r *Runtime) Set(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+
+	r.env.Set(name, obj)
+	return nil
+}
+
+// Call invokes the global function or builtin bound to name, converting each
+// argument with ToObject.
+func (r *Runtime) Call(name string, args ...interface{}) (object.Object, error) {
+	return r.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is Call bounded by ctx and the runtime's limits.
+func (r *Runtime) CallContext(ctx context.Context, name string, args ...interface{}) (object.Object, error) {
+	fn, ok := r.env.Get(name)
+	if !ok {
+		builtin, isBuiltin := r.registry.Lookup(name)
+		if !isBuiltin {
+			return nil, fmt.Errorf("function %s not defined", name)
+		}
+		fn = builtin
+	}
+
+	objects := make([]object.Object, 0, len(args))
+	for i, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		objects = append(objects, obj)
+	}
+
+	previous := r.env.SetMeter(object.NewMeter(ctx, r.host.Limits))
+	defer r.env.SetMeter(previous)
+
+	return result(evaluator.Apply(fn, objects, r.host))
+}
+
+// Register adds a native builtin visible only to this runtime.
+func (r *Runtime) Register(name string, fn object.BuiltinFunction) error {
+	return r.registry.Register(name, fn)
+}
+
+// RegisterFunc wraps fn with WrapFunc and registers it.
+func (r *Runtime) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := WrapFunc(fn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return r.registry.Register(name, builtin)
+}
+
+// Namespace groups builtins under a common prefix: functions registered on
+// rt.Namespace("math") are called from scripts as `math.name(...)`.
+func (r *Runtime) Namespace(name string) *Namespace {
+	return &Namespace{namespace: r.registry.Namespace(name)}
+}
+
+// Builtins returns the runtime's registry, for use with
+// compiler.NewWithBuiltins when running code on the VM.
+func (r *Runtime) Builtins() *builtins.Registry {
+	return r.registry
+}
+
+type Namespace struct {
+	namespace *builtins.Namespace
+}
+
+func (n *Namespace) Register(name string, fn object.BuiltinFunction) error {
+	return n.namespace.Register(name, fn)
+}
+
+func (n *Namespace) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := WrapFunc(fn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return n.namespace.Register(name, builtin)
+}
+
+func result(obj object.Object) (object.Object, error) {
+	if errObj, ok := obj.(*object.Error); ok {
+		if errObj.Err != nil {
+			return nil, errObj.Err
+		}
+		return nil, errors.New(errObj.Message)
+	}
+
+	if obj == nil {
+		return object.NULL, nil
+	}
+
+	return obj, nil
+}
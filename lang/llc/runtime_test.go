@@ -0,0 +1,264 @@
+package llc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"llc/lang/object"
+)
+
+func TestEvalString(t *testing.T) {
+	rt := New()
+
+	result, err := rt.EvalString(`let add = fn(a, b) { a + b }; add(1, 2)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Inspect() != "3" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	result, err = rt.EvalString(`add(40, 2)`)
+	if err != nil {
+		t.Fatalf("globals must survive between evaluations: %s", err)
+	}
+
+	if result.Inspect() != "42" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestEvalStringExpandsMacros(t *testing.T) {
+	rt := New()
+
+	result, err := rt.EvalString(`
+	let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) }) };
+	unless(10 > 5, "not greater", "greater")
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Inspect() != "greater" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestEvalStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let = 1`, "parse errors: expected next token to be IDENT, but got = instead; no prefix parse function for = found"},
+		{`1 + true`, "type mismatch: INTEGER + BOOLEAN"},
+		{`missing`, "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		_, err := New().EvalString(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestEvalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.llc")
+	err := os.WriteFile(path, []byte(`let discount = fn(total) { if (total > 100) { 10 } else { 0 } };`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := New()
+	if _, err := rt.EvalFile(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := rt.Call("discount", 150)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var discount int
+	if err := Decode(result, &discount); err != nil {
+		t.Fatal(err)
+	}
+
+	if discount != 10 {
+		t.Errorf("wrong discount. got=%d", discount)
+	}
+
+	if _, err := rt.EvalFile(filepath.Join(t.TempDir(), "missing.llc")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestGetAndSet(t *testing.T) {
+	type order struct {
+		Customer string `llc:"customer"`
+		Items    []int  `llc:"items"`
+	}
+
+	rt := New()
+	if err := rt.Set("order", order{Customer: "ada", Items: []int{3, 4}}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := rt.EvalString(`let total = order["items"][0] + order["items"][1]; order["customer"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Inspect() != "ada" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	total, ok := rt.Get("total")
+	if !ok {
+		t.Fatalf("total not defined")
+	}
+
+	if total.Inspect() != "7" {
+		t.Errorf("wrong total. got=%s", total.Inspect())
+	}
+
+	if _, ok := rt.Get("missing"); ok {
+		t.Errorf("missing should not be defined")
+	}
+
+	if err := rt.Set("invalid", 1.5); err == nil {
+		t.Errorf("expected error for unsupported type")
+	}
+}
+
+func TestCall(t *testing.T) {
+	var out bytes.Buffer
+	rt := NewWithHost(&object.Host{Stdout: &out})
+
+	_, err := rt.EvalString(`let greet = fn(names) { print("hello " + names[0]); len(names) }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := rt.Call("greet", []string{"ada", "grace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Inspect() != "2" || out.String() != "hello ada\n" {
+		t.Errorf("wrong call result. got=%s, output=%q", result.Inspect(), out.String())
+	}
+
+	result, err = rt.Call("len", "four")
+	if err != nil || result.Inspect() != "4" {
+		t.Errorf("builtins must be callable. got=%v, %v", result, err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected string
+	}{
+		{"missing", nil, "function missing not defined"},
+		{"greet", nil, "wrong number of arguments: want=1, got=0"},
+		{"greet", []interface{}{1.5}, "argument 0: unsupported Go type float64"},
+		{"greet", []interface{}{[]int{1}}, "type mismatch: STRING + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		_, err := rt.Call(tt.name, tt.args...)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. got=%v, want=%q", err, tt.expected)
+		}
+	}
+}
+
+func TestRegisterBuiltins(t *testing.T) {
+	rt := New()
+
+	err := rt.Register("answer", func(_ *object.Host, _ ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rt.Namespace("math").RegisterFunc("max", func(a, b int) int { return max(a, b) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rt.RegisterFunc("len", func() {}); err == nil {
+		t.Errorf("registering over a core builtin must fail")
+	}
+
+	if err := rt.RegisterFunc("bad", 1); err == nil {
+		t.Errorf("registering a non-function must fail")
+	}
+
+	result, err := rt.EvalString(`let f = fn(x) { math.max(x, answer()) }; f(7) + f(50)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Inspect() != "92" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	result, err = rt.Call("math.max", 1, 2)
+	if err != nil || result.Inspect() != "2" {
+		t.Errorf("namespaced builtin must be callable from Go. got=%v, %v", result, err)
+	}
+
+	if _, err := New().EvalString(`answer()`); err == nil {
+		t.Errorf("builtins must not leak between runtimes")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	rt := New()
+	rt.SetLimits(object.Limits{MaxSteps: 10000})
+
+	_, err := rt.EvalString(`let spin = fn(n) { spin(n + 1) }; spin(0)`)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded. got=%v", err)
+	}
+
+	_, err = rt.Call("spin", 0)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded from Call. got=%v", err)
+	}
+
+	result, err := rt.EvalString(`1 + 1`)
+	if err != nil {
+		t.Fatalf("budget must reset between evaluations: %s", err)
+	}
+
+	if result.Inspect() != "2" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	rt := New()
+	if _, err := rt.EvalString(`let spin = fn(n) { spin(n + 1) }`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Stepping through the tree-walker is cheap enough that the deadline hits
+	// long before the depth limit does.
+	rt.SetLimits(object.Limits{MaxCallDepth: 1 << 20})
+
+	_, err := rt.CallContext(ctx, "spin", 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error. got=%v", err)
+	}
+}
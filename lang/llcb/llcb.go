@@ -0,0 +1,360 @@
+// Package llcb reads and writes compiled llc programs.
+//
+// A .llcb file is the magic "LLCB", a uint16 format version, a payload and a
+// CRC-32 of everything before it. The payload lists the builtins the program
+// refers to by name, the global names, the constant pool and the main
+// function, with integers written as varints and strings length-prefixed.
+package llcb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"llc/lang/builtins"
+	"llc/lang/code"
+	"llc/lang/compiler"
+	"llc/lang/object"
+	"llc/lang/verifier"
+)
+
+// Version is the format version written by Encode. Decode rejects others.
+const Version = 3
+
+// Extension is the file extension of compiled programs.
+const Extension = ".llcb"
+
+var magic = []byte("LLCB")
+
+// ErrInvalid is wrapped by every error Decode returns for a malformed file.
+var ErrInvalid = errors.New("invalid llcb file")
+
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagFunction
+)
+
+// Program is the content of a .llcb file.
+type Program struct {
+	Bytecode *compiler.Bytecode
+	// Globals names the global slots, for tools such as the disassembler.
+	Globals []string
+}
+
+func Encode(w io.Writer, program *Program) error {
+	e := &encoder{}
+	e.out.Write(magic)
+	_ = binary.Write(&e.out, binary.BigEndian, uint16(Version))
+
+	bc := program.Bytecode
+
+	e.uint(len(bc.Builtins))
+	for _, def := range bc.Builtins {
+		e.string(def.Name)
+	}
+
+	e.strings(program.Globals)
+
+	e.uint(len(bc.Constants))
+	for i, constant := range bc.Constants {
+		if err := e.constant(constant); err != nil {
+			return fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	e.function(&object.CompiledFunction{
+		Instructions: bc.Instructions,
+		Lines:        bc.Lines,
+		Handlers:     bc.Handlers,
+	})
+
+	_ = binary.Write(&e.out, binary.BigEndian, crc32.ChecksumIEEE(e.out.Bytes()))
+
+	_, err := w.Write(e.out.Bytes())
+	return err
+}
+
+// Decode reads a program, resolving its builtins in registry (the core
+// builtins when nil) and verifying its bytecode before returning.
+func Decode(r io.Reader, registry *builtins.Registry) (*Program, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(magic)+2+4 || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, fmt.Errorf("%w: not an llcb file", ErrInvalid)
+	}
+
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalid)
+	}
+
+	if version := binary.BigEndian.Uint16(body[len(magic):]); version != Version {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalid, version)
+	}
+
+	if registry == nil {
+		registry = builtins.NewRegistry()
+	}
+
+	d := &decoder{data: body[len(magic)+2:]}
+	program, err := d.program(registry)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	if err := verifier.Verify(program.Bytecode); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	return program, nil
+}
+
+type encoder struct {
+	out bytes.Buffer
+}
+
+func (e *encoder) uint(n int) {
+	e.out.Write(binary.AppendUvarint(nil, uint64(n))) //nolint:gosec
+}
+
+func (e *encoder) int(n int64) {
+	e.out.Write(binary.AppendVarint(nil, n))
+}
+
+func (e *encoder) string(s string) {
+	e.uint(len(s))
+	e.out.WriteString(s)
+}
+
+func (e *encoder) strings(list []string) {
+	e.uint(len(list))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+func (e *encoder) constant(constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		e.out.WriteByte(tagInteger)
+		e.int(constant.Value)
+	case *object.String:
+		e.out.WriteByte(tagString)
+		e.string(constant.Value)
+	case *object.CompiledFunction:
+		e.out.WriteByte(tagFunction)
+		e.function(constant)
+	default:
+		return fmt.Errorf("cannot serialize %s", constant.Type())
+	}
+
+	return nil
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) {
+	e.string(fn.Name)
+	e.uint(fn.NumParameters)
+	e.uint(fn.NumLocals)
+	e.strings(fn.LocalNames)
+	e.strings(fn.FreeNames)
+
+	e.uint(len(fn.Instructions))
+	e.out.Write(fn.Instructions)
+
+	// Line table entries are written relative to the previous one, which
+	// keeps them to a byte or two each.
+	e.uint(len(fn.Lines))
+	var previous code.Line
+	for _, line := range fn.Lines {
+		e.uint(line.Offset - previous.Offset)
+		e.int(int64(line.Position.Line - previous.Position.Line))
+		e.uint(line.Position.Column)
+		previous = line
+	}
+
+	e.uint(len(fn.Handlers))
+	for _, h := range fn.Handlers {
+		e.uint(h.Start)
+		e.uint(h.End)
+		e.uint(h.Target)
+		e.uint(h.Depth)
+	}
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) program(registry *builtins.Registry) (*Program, error) {
+	bc := &compiler.Bytecode{}
+
+	names := d.strings()
+	for _, name := range names {
+		if d.err != nil {
+			break
+		}
+
+		builtin, ok := registry.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown builtin %s", name)
+		}
+		bc.Builtins = append(bc.Builtins, builtins.Definition{Name: name, Builtin: builtin})
+	}
+
+	program := &Program{Bytecode: bc, Globals: d.strings()}
+
+	count := d.count()
+	for i := 0; i < count && d.err == nil; i++ {
+		bc.Constants = append(bc.Constants, d.constant())
+	}
+
+	main := d.function()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.data) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes", len(d.data))
+	}
+
+	bc.Instructions = main.Instructions
+	bc.Lines = main.Lines
+	bc.Handlers = main.Handlers
+
+	return program, nil
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+	d.data = nil
+}
+
+func (d *decoder) uint() int {
+	n, read := binary.Uvarint(d.data)
+	if read == 0 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	if read < 0 || n > math.MaxInt32 {
+		d.fail("malformed integer")
+		return 0
+	}
+
+	d.data = d.data[read:]
+	return int(n) //nolint:gosec
+}
+
+func (d *decoder) int() int64 {
+	n, read := binary.Varint(d.data)
+	if read == 0 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	if read < 0 {
+		d.fail("malformed integer")
+		return 0
+	}
+
+	d.data = d.data[read:]
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint()
+	if n > len(d.data) {
+		d.fail("unexpected end of data")
+		return nil
+	}
+
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+// count reads a length that is about to drive a loop, bounding it by the
+// data left so that a corrupt length cannot trigger a huge allocation.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data) {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) strings() []string {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+
+	list := make([]string, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		list = append(list, d.string())
+	}
+	return list
+}
+
+func (d *decoder) constant() object.Object {
+	if len(d.data) == 0 {
+		d.fail("unexpected end of data")
+		return nil
+	}
+
+	tag := d.data[0]
+	d.data = d.data[1:]
+
+	switch tag {
+	case tagInteger:
+		return &object.Integer{Value: d.int()}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		return d.function()
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{
+		Name:          d.string(),
+		NumParameters: d.uint(),
+		NumLocals:     d.uint(),
+		LocalNames:    d.strings(),
+		FreeNames:     d.strings(),
+		Instructions:  code.Instructions(d.bytes()),
+	}
+
+	var previous code.Line
+	n := d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		line := code.Line{Offset: previous.Offset + d.uint()}
+		line.Position.Line = previous.Position.Line + int(d.int())
+		line.Position.Column = d.uint()
+		fn.Lines = append(fn.Lines, line)
+		previous = line
+	}
+
+	n = d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		fn.Handlers = append(fn.Handlers, code.Handler{Start: d.uint(), End: d.uint(), Target: d.uint(), Depth: d.uint()})
+	}
+
+	return fn
+}
@@ -0,0 +1,191 @@
+package llcb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"llc/lang/ast"
+	"llc/lang/builtins"
+	"llc/lang/code"
+	"llc/lang/compiler"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+	"llc/lang/vm"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + 2`, "3"},
+		{`"a" + "b"`, "ab"},
+		{`let x = -9223372036854775807; x`, "-9223372036854775807"},
+		{`let add = fn(a, b) { a + b }; add(2, 3)`, "5"},
+		{`let make = fn(x) { fn(y) { x + y } }; make(1)(2)`, "3"},
+		{`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10)`, "0"},
+		{`len([1, 2, 3])`, "3"},
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`let f = fn() { error("no")?; 1 }; f()`, "Error: no"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			comp := compile(t, tt.input)
+			data := encode(t, &Program{Bytecode: comp.Bytecode(), Globals: comp.SymbolTable().Names(compiler.GlobalScope)})
+
+			program, err := Decode(bytes.NewReader(data), nil)
+			if err != nil {
+				t.Fatalf("decode error: %s", err)
+			}
+
+			machine := vm.New(program.Bytecode)
+			if err := machine.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+
+			if result := machine.LastPoppedStackElem().Inspect(); result != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", result, tt.expected)
+			}
+
+			if !bytes.Equal(encode(t, program), data) {
+				t.Errorf("re-encoding the decoded program changed it")
+			}
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	comp := compile(t, "let add = fn(a, b) { let s = a + b; s };\nadd(1, 2)")
+	data := encode(t, &Program{Bytecode: comp.Bytecode(), Globals: comp.SymbolTable().Names(compiler.GlobalScope)})
+
+	program, err := Decode(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if fmt.Sprint(program.Globals) != "[add]" {
+		t.Errorf("wrong globals. got=%v", program.Globals)
+	}
+
+	fn, ok := program.Bytecode.Constants[0].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 0 is not a function. got=%T", program.Bytecode.Constants[0])
+	}
+
+	if fn.Name != "add" || fn.NumParameters != 2 || fn.NumLocals != 3 || fmt.Sprint(fn.LocalNames) != "[a b s]" {
+		t.Errorf("wrong function metadata. got=%+v", fn)
+	}
+
+	if pos, _ := program.Bytecode.Lines.Lookup(16); pos.String() != "2:4" {
+		t.Errorf("wrong call position. got=%v (%v)", pos, program.Bytecode.Lines)
+	}
+
+	if fmt.Sprint(fn.Lines) != fmt.Sprint(comp.Bytecode().Constants[0].(*object.CompiledFunction).Lines) {
+		t.Errorf("line table changed. got=%v", fn.Lines)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := encode(t, &Program{Bytecode: compile(t, `print(1)`).Bytecode()})
+
+	corrupt := append([]byte(nil), valid...)
+	corrupt[10] ^= 0xff
+
+	wrongVersion := append([]byte(nil), valid...)
+	wrongVersion[5] = 99
+	wrongVersion = reseal(wrongVersion)
+
+	tests := []struct {
+		data     []byte
+		registry *builtins.Registry
+		expected string
+	}{
+		{[]byte("nope"), nil, "invalid llcb file: not an llcb file"},
+		{corrupt, nil, "invalid llcb file: checksum mismatch"},
+		{wrongVersion, nil, "invalid llcb file: unsupported version 99"},
+		{reseal(valid[:len(valid)-6]), nil, "invalid llcb file: unexpected end of data"},
+		{reseal(append(valid[:len(valid)-4:len(valid)-4], 0, 0, 0, 0, 0)), nil, "invalid llcb file: 1 trailing bytes"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tt.data), tt.registry)
+			if !errors.Is(err, ErrInvalid) || err.Error() != tt.expected {
+				t.Errorf("wrong error. got=%v, want=%q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownBuiltin(t *testing.T) {
+	registry := builtins.NewRegistry()
+	if err := registry.Register("host_fn", func(*object.Host, ...object.Object) object.Object { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	comp := compiler.NewWithBuiltins(registry)
+	if err := comp.Compile(parse(`host_fn()`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	data := encode(t, &Program{Bytecode: comp.Bytecode()})
+
+	_, err := Decode(bytes.NewReader(data), nil)
+	if err == nil || err.Error() != "invalid llcb file: unknown builtin host_fn" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	if _, err := Decode(bytes.NewReader(data), registry); err != nil {
+		t.Errorf("unexpected error with the host registry: %s", err)
+	}
+}
+
+func compile(t *testing.T, input string) *compiler.Compiler {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return comp
+}
+
+func encode(t *testing.T, program *Program) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, program); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+// reseal replaces the checksum of a file whose body was edited on purpose.
+func reseal(data []byte) []byte {
+	body := append([]byte(nil), data[:len(data)-4]...)
+	return binary.BigEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+}
+
+func concat(instructions ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
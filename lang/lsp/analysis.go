@@ -0,0 +1,107 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"llc/lang/ast"
+	"llc/lang/lexer"
+	"llc/lang/parser"
+	"llc/lang/scope"
+	"llc/lang/token"
+)
+
+// symbol is a let binding in the document's outline, with the let bindings
+// inside its value, such as the locals of a function.
+type symbol struct {
+	binding  *scope.Binding
+	children []symbol
+}
+
+// document is the analysis of one version of a source file.
+type document struct {
+	lines   []string
+	program *ast.Program
+	errors  []parser.Error
+	info    *scope.Info
+	// symbols are the let bindings outside of any other let's value.
+	symbols []symbol
+}
+
+func analyze(text string) *document {
+	p := parser.New(lexer.New(text))
+	doc := &document{lines: strings.Split(text, "\n"), program: p.ParseProgram(), errors: p.ErrorList()}
+	doc.info = scope.Resolve(doc.program)
+	doc.symbols = doc.outline(doc.program)
+
+	return doc
+}
+
+// outline lists the let bindings in node that are not inside another let's
+// value.
+func (d *document) outline(node ast.Node) []symbol {
+	var symbols []symbol
+	ast.Walk(node, func(n ast.Node) bool {
+		let, ok := n.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			return true
+		}
+
+		symbols = append(symbols, symbol{binding: d.info.BindingOf(let.Name), children: d.outline(let.Value)})
+		return false
+	})
+	return symbols
+}
+
+// detail describes b in a line of llc, like a function's parameter list.
+func detail(b *scope.Binding) string {
+	switch b.Kind {
+	case scope.Parameter:
+		return "parameter " + b.Name()
+	case scope.Function:
+		fn, _ := b.Let.Value.(*ast.FunctionLiteral)
+		params := make([]string, len(fn.Parameters))
+		for i, p := range fn.Parameters {
+			params[i] = p.Value
+			if i < len(fn.ParameterTypes) && fn.ParameterTypes[i] != nil {
+				params[i] += ": " + fn.ParameterTypes[i].String()
+			}
+		}
+
+		out := "let " + b.Name() + " = fn(" + strings.Join(params, ", ") + ")"
+		if fn.ReturnType != nil {
+			out += " -> " + fn.ReturnType.String()
+		}
+		return out
+	default:
+		if b.Let.Type != nil {
+			return "let " + b.Name() + ": " + b.Let.Type.String()
+		}
+		return "let " + b.Name()
+	}
+}
+
+// nodeEnd is the position right after the last token found in node.
+func nodeEnd(node ast.Node) token.Position {
+	var end token.Position
+	ast.Walk(node, func(n ast.Node) bool {
+		pos := ast.Pos(n)
+		if block, ok := n.(*ast.BlockStatement); ok && block.RBrace.Line != 0 {
+			pos = block.RBrace.Position()
+		}
+		if pos.Line == 0 {
+			return true
+		}
+
+		pos.Column += utf8.RuneCountInString(n.TokenLiteral())
+		if _, ok := n.(*ast.StringLiteral); ok {
+			pos.Column += 2 // the quotes
+		}
+		if end.Before(pos) {
+			end = pos
+		}
+		return true
+	})
+
+	return end
+}
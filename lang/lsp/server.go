@@ -0,0 +1,387 @@
+// Package lsp serves the Language Server Protocol for llc sources:
+// diagnostics for syntax errors, hover, go-to-definition, references,
+// document symbols and completion. Names are resolved by package scope.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"llc/lang/ast"
+	"llc/lang/builtins"
+	"llc/lang/scope"
+	"llc/lang/token"
+)
+
+var errUnknownDocument = errors.New("unknown document")
+
+var keywords = []string{
+	"let", "fn", "if", "else", "return", "true", "false", "macro", "try", "catch", "finally", "throw",
+}
+
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+}
+
+// New returns a server reading messages from in and writing to out.
+func New(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, documents: make(map[string]*document)}
+}
+
+// Serve handles messages until the client sends exit or in ends.
+func (s *Server) Serve() error {
+	for {
+		msg, err := ReadMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *Message) error { //nolint:cyclop
+	var (
+		result any
+		err    error
+	)
+
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1, // full
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "llc"},
+		}
+	case "shutdown":
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return err
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return s.publishDiagnostics(params.TextDocument.URI, []Diagnostic{})
+	case "textDocument/hover":
+		result, err = s.hover(msg.Params)
+	case "textDocument/definition":
+		result, err = s.definition(msg.Params)
+	case "textDocument/references":
+		result, err = s.references(msg.Params)
+	case "textDocument/documentSymbol":
+		result, err = s.documentSymbols(msg.Params)
+	case "textDocument/completion":
+		result, err = s.completion(msg.Params)
+	default:
+		if msg.ID == nil {
+			return nil // notifications may be ignored
+		}
+		return s.reply(msg.ID, nil, &ResponseError{Code: codeMethodNotFound, Message: "unsupported method " + msg.Method})
+	}
+
+	if msg.ID == nil {
+		return nil
+	}
+	if err != nil {
+		return s.reply(msg.ID, nil, &ResponseError{Code: codeInvalidParams, Message: err.Error()})
+	}
+	return s.reply(msg.ID, result, nil)
+}
+
+func (s *Server) update(uri, text string) error {
+	doc := analyze(text)
+	s.documents[uri] = doc
+
+	diagnostics := []Diagnostic{}
+	for _, err := range doc.errors {
+		start := doc.toPosition(err.Position)
+		end := doc.toPosition(token.Position{Line: err.Position.Line, Column: err.Position.Column + 1})
+		diagnostics = append(diagnostics, Diagnostic{
+			Range: Range{Start: start, End: end}, Severity: severityError, Source: "llc", Message: err.Message,
+		})
+	}
+
+	return s.publishDiagnostics(uri, diagnostics)
+}
+
+func (s *Server) publishDiagnostics(uri string, diagnostics []Diagnostic) error {
+	return s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+// occurrenceAt finds the identifier at a position in a document, if any.
+func (s *Server) occurrenceAt(params textDocumentPositionParams) (*document, scope.Occurrence, bool, error) {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, scope.Occurrence{}, false, errUnknownDocument
+	}
+
+	o, found := doc.info.OccurrenceAt(doc.fromPosition(params.Position))
+	return doc, o, found, nil
+}
+
+func (s *Server) hover(raw json.RawMessage) (any, error) {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	doc, o, found, err := s.occurrenceAt(params)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var contents string
+	if o.Binding != nil {
+		contents = "```llc\n" + detail(o.Binding) + "\n```"
+	} else if builtin, ok := builtins.Docs[o.Ident.Value]; ok {
+		contents = "```llc\n" + builtin.Signature + "\n```\n" + builtin.Summary
+	} else {
+		return nil, nil
+	}
+
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: contents}, Range: doc.identRange(o.Ident)}, nil
+}
+
+func (s *Server) definition(raw json.RawMessage) (any, error) {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	doc, o, found, err := s.occurrenceAt(params)
+	if err != nil || !found || o.Binding == nil {
+		return nil, err
+	}
+
+	return Location{URI: params.TextDocument.URI, Range: doc.identRange(o.Binding.Ident)}, nil
+}
+
+func (s *Server) references(raw json.RawMessage) (any, error) {
+	var params referenceParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	doc, o, found, err := s.occurrenceAt(params.textDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	locations := []Location{}
+	if !found || o.Binding == nil {
+		return locations, nil
+	}
+
+	if params.Context.IncludeDeclaration {
+		locations = append(locations, Location{URI: params.TextDocument.URI, Range: doc.identRange(o.Binding.Ident)})
+	}
+	for _, ident := range o.Binding.Uses {
+		locations = append(locations, Location{URI: params.TextDocument.URI, Range: doc.identRange(ident)})
+	}
+
+	return locations, nil
+}
+
+func (s *Server) documentSymbols(raw json.RawMessage) (any, error) {
+	var params documentParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, errUnknownDocument
+	}
+
+	return doc.documentSymbols(doc.symbols), nil
+}
+
+func (d *document) documentSymbols(outline []symbol) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, s := range outline {
+		b := s.binding
+		kind := symbolVariable
+		if b.Kind == scope.Function {
+			kind = symbolFunction
+		}
+
+		symbols = append(symbols, DocumentSymbol{
+			Name:           b.Name(),
+			Detail:         detail(b),
+			Kind:           kind,
+			Range:          Range{Start: d.toPosition(b.Let.Token.Position()), End: d.toPosition(d.statementEnd(b.Let))},
+			SelectionRange: d.identRange(b.Ident),
+			Children:       d.documentSymbols(s.children),
+		})
+	}
+	return symbols
+}
+
+func (s *Server) completion(raw json.RawMessage) (any, error) {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, errUnknownDocument
+	}
+
+	pos := doc.fromPosition(params.Position)
+	prefix := doc.wordBefore(pos)
+
+	items := []CompletionItem{}
+	seen := make(map[string]bool)
+	add := func(item CompletionItem) {
+		if !seen[item.Label] && strings.HasPrefix(item.Label, prefix) {
+			seen[item.Label] = true
+			items = append(items, item)
+		}
+	}
+
+	for _, b := range doc.info.Visible(pos) {
+		kind := completionVariable
+		if b.Kind == scope.Function {
+			kind = completionFunction
+		}
+		add(CompletionItem{Label: b.Name(), Kind: kind, Detail: detail(b)})
+	}
+
+	names := make([]string, 0, len(builtins.Docs))
+	for name := range builtins.Docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(CompletionItem{Label: name, Kind: completionFunction, Detail: builtins.Docs[name].Signature})
+	}
+
+	for _, keyword := range keywords {
+		add(CompletionItem{Label: keyword, Kind: completionKeyword})
+	}
+
+	return items, nil
+}
+
+// statementEnd is the position right after statement. The AST does not
+// keep closing parentheses and brackets, nor semicolons, so they are taken
+// from the text.
+func (d *document) statementEnd(statement ast.Statement) token.Position {
+	end := nodeEnd(statement)
+	if end.Line < 1 || end.Line > len(d.lines) {
+		return end
+	}
+
+	line := []rune(d.lines[end.Line-1])
+	for end.Column <= len(line) && strings.ContainsRune(")]", line[end.Column-1]) {
+		end.Column++
+	}
+	if end.Column <= len(line) && line[end.Column-1] == ';' {
+		end.Column++
+	}
+	return end
+}
+
+// wordBefore returns the part of an identifier typed right before pos.
+func (d *document) wordBefore(pos token.Position) string {
+	if pos.Line < 1 || pos.Line > len(d.lines) {
+		return ""
+	}
+
+	line := []rune(d.lines[pos.Line-1])
+	end := min(pos.Column-1, len(line))
+	start := end
+	for start > 0 && isIdentifierRune(line[start-1]) {
+		start--
+	}
+	return string(line[start:end])
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || r == '.' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9'
+}
+
+func (s *Server) reply(id json.RawMessage, result any, respErr *ResponseError) error {
+	msg := map[string]any{"jsonrpc": "2.0", "id": id}
+	if respErr != nil {
+		msg["error"] = respErr
+	} else {
+		msg["result"] = result
+	}
+	return WriteMessage(s.out, msg)
+}
+
+func (s *Server) notify(method string, params any) error {
+	return WriteMessage(s.out, map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// toPosition and fromPosition convert between the one-based positions of
+// tokens, which count runes, and the zero-based ones of the protocol, which
+// count UTF-16 code units. Columns past the end of the line count as one
+// unit each.
+func (d *document) toPosition(pos token.Position) Position {
+	line := []rune(d.line(pos.Line))
+	column := max(pos.Column-1, 0)
+	n := min(column, len(line))
+	return Position{Line: max(pos.Line-1, 0), Character: len(utf16.Encode(line[:n])) + column - n}
+}
+
+func (d *document) fromPosition(pos Position) token.Position {
+	line := []rune(d.line(pos.Line + 1))
+	column, units := 0, 0
+	for column < len(line) && units < pos.Character {
+		units += utf16.RuneLen(line[column])
+		column++
+	}
+	return token.Position{Line: pos.Line + 1, Column: column + 1 + max(pos.Character-units, 0)}
+}
+
+// line returns the text of the one-based line n, or "" if there is none.
+func (d *document) line(n int) string {
+	if n < 1 || n > len(d.lines) {
+		return ""
+	}
+	return d.lines[n-1]
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	pos := ident.Token.Position()
+	end := token.Position{Line: pos.Line, Column: pos.Column + len([]rune(ident.Value))}
+	return Range{Start: d.toPosition(pos), End: d.toPosition(end)}
+}
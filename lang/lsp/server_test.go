@@ -0,0 +1,347 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// client is a scripted LSP client talking to a Server over pipes.
+type client struct {
+	t    *testing.T
+	w    io.Writer
+	r    *bufio.Reader
+	id   int
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	c := &client{t: t, w: requestWriter, r: bufio.NewReader(responseReader), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- New(requests, responses).Serve()
+		_ = responses.Close()
+	}()
+
+	return c
+}
+
+func (c *client) write(msg map[string]any) {
+	c.t.Helper()
+
+	msg["jsonrpc"] = "2.0"
+	if err := WriteMessage(c.w, msg); err != nil {
+		c.t.Fatalf("writing: %s", err)
+	}
+}
+
+func (c *client) read() *Message {
+	c.t.Helper()
+
+	msg, err := ReadMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("reading: %s", err)
+	}
+	return msg
+}
+
+// call sends a request and decodes the result of its response into result.
+func (c *client) call(method string, params any, result any) *ResponseError {
+	c.t.Helper()
+
+	c.id++
+	c.write(map[string]any{"id": c.id, "method": method, "params": params})
+
+	msg := c.read()
+	if string(msg.ID) != fmt.Sprint(c.id) {
+		c.t.Fatalf("got response to %s, want %d", msg.ID, c.id)
+	}
+	if msg.Error == nil && result != nil {
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			c.t.Fatalf("decoding %s: %s", method, err)
+		}
+	}
+	return msg.Error
+}
+
+// open sends a document and returns the diagnostics published for it.
+func (c *client) open(uri, text string) []Diagnostic {
+	c.t.Helper()
+
+	c.write(map[string]any{
+		"method": "textDocument/didOpen",
+		"params": map[string]any{"textDocument": map[string]any{"uri": uri, "languageId": "llc", "text": text}},
+	})
+	return c.diagnostics()
+}
+
+func (c *client) diagnostics() []Diagnostic {
+	c.t.Helper()
+
+	msg := c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %s", msg.Method)
+	}
+
+	var params struct{ Diagnostics []Diagnostic }
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params.Diagnostics
+}
+
+func (c *client) exit() {
+	c.t.Helper()
+
+	if err := c.call("shutdown", nil, nil); err != nil {
+		c.t.Fatalf("shutdown: %s", err.Message)
+	}
+	c.write(map[string]any{"method": "exit"})
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("serve: %s", err)
+	}
+}
+
+const uri = "file:///test.llc"
+
+const source = `let total = fn(xs: [int]) -> int {
+  let sum: int = 0;
+  let add = fn(a, b) { a + b };
+  add(sum, len(xs))
+};
+let result = total([1, 2]);
+print(result);`
+
+func position(uri string, line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func formatRange(r Range) string {
+	return fmt.Sprintf("%d:%d-%d:%d", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character)
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+
+	diagnostics := c.open(uri, "let x = ;")
+	if len(diagnostics) != 1 || formatRange(diagnostics[0].Range) != "0:8-0:9" ||
+		diagnostics[0].Message != "no prefix parse function for ; found" {
+		t.Fatalf("wrong diagnostics: %+v", diagnostics)
+	}
+
+	c.write(map[string]any{
+		"method": "textDocument/didChange",
+		"params": map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []map[string]any{{"text": "let x = 1;"}},
+		},
+	})
+	if diagnostics := c.diagnostics(); len(diagnostics) != 0 {
+		t.Errorf("fixed document still has diagnostics: %+v", diagnostics)
+	}
+
+	c.exit()
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{3, 11, "```llc\nlen(value)\n```\nReturns the length of a string or an array."},
+		{5, 14, "```llc\nlet total = fn(xs: [int]) -> int\n```"},
+		{2, 23, "```llc\nparameter a\n```"},
+		{1, 7, "```llc\nlet sum: int\n```"},
+		{1, 2, ""},
+	}
+
+	c := newClient(t)
+	c.open(uri, source)
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			var hover *Hover
+			c.call("textDocument/hover", position(uri, tt.line, tt.character), &hover)
+
+			got := ""
+			if hover != nil {
+				got = hover.Contents.Value
+			}
+			if got != tt.expected {
+				t.Errorf("wrong hover. got=%q, want=%q", got, tt.expected)
+			}
+		})
+	}
+
+	c.exit()
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	tests := []struct {
+		line, character int
+		definition      string
+		references      string
+	}{
+		// xs in len(xs) is the parameter of total.
+		{3, 15, "0:15-0:17", "0:15-0:17 3:15-3:17"},
+		// sum, from its declaration.
+		{1, 6, "1:6-1:9", "1:6-1:9 3:6-3:9"},
+		// a in a + b.
+		{2, 23, "2:15-2:16", "2:15-2:16 2:23-2:24"},
+		// total, called on line 6.
+		{5, 13, "0:4-0:9", "0:4-0:9 5:13-5:18"},
+		// len is a builtin.
+		{3, 11, "", ""},
+	}
+
+	c := newClient(t)
+	c.open(uri, source)
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			var location *Location
+			c.call("textDocument/definition", position(uri, tt.line, tt.character), &location)
+			got := ""
+			if location != nil {
+				got = formatRange(location.Range)
+			}
+			if got != tt.definition {
+				t.Errorf("wrong definition. got=%q, want=%q", got, tt.definition)
+			}
+
+			params := position(uri, tt.line, tt.character)
+			params["context"] = map[string]any{"includeDeclaration": true}
+			var locations []Location
+			c.call("textDocument/references", params, &locations)
+			var ranges []string
+			for _, l := range locations {
+				ranges = append(ranges, formatRange(l.Range))
+			}
+			if got := strings.Join(ranges, " "); got != tt.references {
+				t.Errorf("wrong references. got=%q, want=%q", got, tt.references)
+			}
+		})
+	}
+
+	c.exit()
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := newClient(t)
+	c.open(uri, source)
+
+	var symbols []DocumentSymbol
+	c.call("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}, &symbols)
+
+	var describe func(symbols []DocumentSymbol) string
+	describe = func(symbols []DocumentSymbol) string {
+		var out []string
+		for _, s := range symbols {
+			entry := fmt.Sprintf("%s(%d)@%s", s.Name, s.Kind, formatRange(s.Range))
+			if len(s.Children) != 0 {
+				entry += "[" + describe(s.Children) + "]"
+			}
+			out = append(out, entry)
+		}
+		return strings.Join(out, " ")
+	}
+
+	expected := "total(12)@0:0-4:2[sum(13)@1:2-1:19 add(12)@2:2-2:31] result(13)@5:0-5:27"
+	if got := describe(symbols); got != expected {
+		t.Errorf("wrong symbols.\ngot= %s\nwant=%s", got, expected)
+	}
+
+	c.exit()
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		text            string
+		line, character int
+		expected        string
+	}{
+		{source, 3, 4, "add"},
+		{source, 6, 2, "print"},
+		{"let value = 1;\nlet f = fn(v) {\n  v\n};\nva", 4, 2, "value"},
+		{"let value = 1;\nlet f = fn(v) {\n  v\n};\nva", 2, 3, "v value"},
+		{"re", 0, 2, "read_file rest return"},
+	}
+
+	c := newClient(t)
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			c.open(uri, tt.text)
+
+			var items []CompletionItem
+			c.call("textDocument/completion", position(uri, tt.line, tt.character), &items)
+
+			var labels []string
+			for _, item := range items {
+				labels = append(labels, item.Label)
+			}
+			if got := strings.Join(labels, " "); got != tt.expected {
+				t.Errorf("wrong completions. got=%q, want=%q", got, tt.expected)
+			}
+		})
+	}
+
+	c.exit()
+}
+
+// TestUTF16Positions checks that positions count UTF-16 code units, as
+// clients send them, after a character outside the Basic Multilingual Plane.
+func TestUTF16Positions(t *testing.T) {
+	c := newClient(t)
+
+	diagnostics := c.open(uri, `"😀" + ;`)
+	if len(diagnostics) != 1 || formatRange(diagnostics[0].Range) != "0:7-0:8" {
+		t.Errorf("wrong diagnostics: %+v", diagnostics)
+	}
+
+	c.open(uri, `let value = ["😀"]; value`)
+
+	var location *Location
+	c.call("textDocument/definition", position(uri, 0, 21), &location)
+	if location == nil || formatRange(location.Range) != "0:4-0:9" {
+		t.Errorf("wrong definition: %+v", location)
+	}
+
+	var symbols []DocumentSymbol
+	c.call("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}, &symbols)
+	if len(symbols) != 1 || formatRange(symbols[0].Range) != "0:0-0:19" {
+		t.Errorf("wrong symbols: %+v", symbols)
+	}
+
+	var items []CompletionItem
+	c.call("textDocument/completion", position(uri, 0, 22), &items)
+	if len(items) != 1 || items[0].Label != "value" {
+		t.Errorf("wrong completions: %+v", items)
+	}
+
+	c.exit()
+}
+
+func TestUnknownMethod(t *testing.T) {
+	c := newClient(t)
+
+	err := c.call("workspace/symbol", map[string]any{"query": ""}, nil)
+	if err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", err)
+	}
+
+	c.exit()
+}
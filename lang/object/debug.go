@@ -0,0 +1,67 @@
+package object
+
+import (
+	"errors"
+	"sort"
+
+	"llc/lang/token"
+)
+
+// ErrStopped is returned by a Debugger to end the script it is following.
+// Like ErrLimitExceeded, scripts cannot catch it.
+var ErrStopped = errors.New("stopped by the debugger")
+
+// Debugger follows a script as it runs. The engines call Line before running
+// code from a source line they were not already on in the current call, and
+// may call it more often, such as once per statement. An error returned by
+// Line stops the script with it.
+type Debugger interface {
+	Line(state DebugState) error
+}
+
+// DebugState is the execution state an engine shows its Debugger. It is only
+// valid during the call to Line.
+type DebugState interface {
+	// Position is where the code about to run comes from.
+	Position() token.Position
+	// Function names the running function: "" in the main program and
+	// "<anonymous>" in a function without a name.
+	Function() string
+	// Depth is the number of calls active, 0 in the main program.
+	Depth() int
+	// Variables lists what the running code can refer to by name, innermost
+	// first: locals, then free variables, then globals.
+	Variables() []Variable
+	// Host is the host running the script.
+	Host() *Host
+}
+
+type Variable struct {
+	Name  string
+	Value Object
+}
+
+// Variables lists the bindings of e and its outer environments, innermost
+// first and sorted by name within an environment. Bindings shadowed by an
+// inner one are left out.
+func (e *Environment) Variables() []Variable {
+	var variables []Variable
+	seen := make(map[string]bool)
+
+	for env := e; env != nil; env = env.outer {
+		names := make([]string, 0, len(env.store))
+		for name := range env.store {
+			if !seen[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			seen[name] = true
+			variables = append(variables, Variable{Name: name, Value: env.store[name]})
+		}
+	}
+
+	return variables
+}
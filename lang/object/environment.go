@@ -5,9 +5,43 @@ func NewEnvironment() *Environment {
 	return &Environment{store: s, outer: nil}
 }
 
+func NewEnvironmentWithHost(host *Host) *Environment {
+	env := NewEnvironment()
+	env.host = host
+	return env
+}
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	host  *Host
+	meter *Meter
+	// function is the function whose call created the environment.
+	function *Function
+}
+
+func (e *Environment) Host() *Host {
+	return e.root().host
+}
+
+func (e *Environment) root() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// Meter returns the meter of the execution currently using the environment.
+func (e *Environment) Meter() *Meter {
+	return e.root().meter
+}
+
+// SetMeter installs m for the current execution and returns the previous one.
+func (e *Environment) SetMeter(m *Meter) *Meter {
+	root := e.root()
+	previous := root.meter
+	root.meter = m
+	return previous
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -28,3 +62,21 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env.outer = outer
 	return env
 }
+
+// NewCallEnvironment is the environment of a call to fn, enclosed in the
+// one fn was defined in.
+func NewCallEnvironment(fn *Function) *Environment {
+	env := NewEnclosedEnvironment(fn.Env)
+	env.function = fn
+	return env
+}
+
+// Function is the function whose call e belongs to, or nil outside of any.
+func (e *Environment) Function() *Function {
+	for ; e != nil; e = e.outer {
+		if e.function != nil {
+			return e.function
+		}
+	}
+	return nil
+}
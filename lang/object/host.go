@@ -0,0 +1,98 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Capability is a permission a host grants to the scripts it runs. Builtins
+// with side effects outside the interpreter check for it before acting.
+type Capability uint8
+
+const (
+	CapFS Capability = 1 << iota
+	CapEnv
+	// CapExit lets scripts end the host process through Host.Exit.
+	CapExit
+)
+
+// BuiltinLookup resolves builtins by name. It lets a host replace the core
+// builtin set with one extended by its own functions.
+type BuiltinLookup interface {
+	Lookup(name string) (*Builtin, bool)
+}
+
+// Host describes the process embedding the interpreter. Unset streams fall
+// back to the process' standard ones. A nil Host is a fully sandboxed one: no
+// capabilities, no arguments and no way to exit.
+type Host struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	Exit   func(code int)
+
+	Builtins BuiltinLookup
+
+	stdin *bufio.Reader
+	Args  []string
+
+	Capabilities Capability
+	Limits       Limits
+
+	// Debugger, when set, follows scripts run by the evaluator and the VM.
+	Debugger Debugger
+}
+
+var (
+	processStdin     *bufio.Reader
+	processStdinOnce sync.Once
+)
+
+func (h *Host) Allows(c Capability) bool {
+	return h != nil && h.Capabilities&c == c
+}
+
+func (h *Host) Output() io.Writer {
+	if h == nil || h.Stdout == nil {
+		return os.Stdout
+	}
+	return h.Stdout
+}
+
+func (h *Host) ErrorOutput() io.Writer {
+	if h == nil || h.Stderr == nil {
+		return os.Stderr
+	}
+	return h.Stderr
+}
+
+// ReadLine returns the next line from the host's input without the trailing
+// line break. The reader is shared, so scripts and the REPL can both consume
+// the same stream without losing buffered data.
+func (h *Host) ReadLine() (string, error) {
+	reader := h.input()
+
+	line, err := reader.ReadString('\n')
+	if err != nil && (line == "" || err != io.EOF) { //nolint:errorlint
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (h *Host) input() *bufio.Reader {
+	if h == nil || h.Stdin == nil {
+		processStdinOnce.Do(func() {
+			processStdin = bufio.NewReader(os.Stdin)
+		})
+		return processStdin
+	}
+
+	if h.stdin == nil {
+		h.stdin = bufio.NewReader(h.Stdin)
+	}
+	return h.stdin
+}
@@ -0,0 +1,100 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrLimitExceeded is returned when a script runs past one of its Limits.
+	ErrLimitExceeded = errors.New("execution limit exceeded")
+	// ErrStackOverflow is returned when recursion exceeds what the engine
+	// itself can support, regardless of Limits.
+	ErrStackOverflow = errors.New("stack overflow")
+)
+
+// Limits bounds the resources a single execution may use. Zero means
+// unlimited.
+type Limits struct {
+	MaxSteps       int64
+	MaxCallDepth   int
+	MaxAllocations int64
+}
+
+// contextCheckInterval is how many steps pass between polls of ctx.Err, which
+// is too slow to call on every step.
+const contextCheckInterval = 1024
+
+// Meter tracks one execution against its Limits and context. A nil Meter
+// never fails.
+type Meter struct {
+	ctx    context.Context //nolint:containedctx
+	limits Limits
+
+	steps       int64
+	depth       int
+	allocations int64
+}
+
+func NewMeter(ctx context.Context, limits Limits) *Meter {
+	return &Meter{ctx: ctx, limits: limits}
+}
+
+func (m *Meter) Step() error {
+	if m == nil {
+		return nil
+	}
+
+	m.steps++
+	if m.limits.MaxSteps > 0 && m.steps > m.limits.MaxSteps {
+		return fmt.Errorf("%w: more than %d steps", ErrLimitExceeded, m.limits.MaxSteps)
+	}
+
+	if m.steps%contextCheckInterval == 0 {
+		return m.ctx.Err()
+	}
+
+	return nil
+}
+
+func (m *Meter) Enter() error {
+	if m == nil {
+		return nil
+	}
+
+	m.depth++
+	if m.limits.MaxCallDepth > 0 && m.depth > m.limits.MaxCallDepth {
+		m.depth--
+		return fmt.Errorf("%w: call depth over %d", ErrLimitExceeded, m.limits.MaxCallDepth)
+	}
+
+	return m.ctx.Err()
+}
+
+// Depth is the number of calls currently active.
+func (m *Meter) Depth() int {
+	if m == nil {
+		return 0
+	}
+	return m.depth
+}
+
+func (m *Meter) Leave() {
+	if m != nil {
+		m.depth--
+	}
+}
+
+func (m *Meter) Allocate(n int64) error {
+	if m == nil {
+		return nil
+	}
+
+	m.allocations += n
+	if m.limits.MaxAllocations > 0 && m.allocations > m.limits.MaxAllocations {
+		return fmt.Errorf("%w: more than %d allocations", ErrLimitExceeded, m.limits.MaxAllocations)
+	}
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"llc/lang/ast"
+	"llc/lang/code"
 )
 
 type TypeObject string
@@ -17,6 +18,7 @@ const (
 	NullObj        = "NULL"
 	ReturnValueObj = "RETURN_VALUE"
 	ErrorObj       = "ERROR"
+	ErrorValueObj  = "ERROR_VALUE"
 	FunctionObj    = "FUNCTION"
 	StringObj      = "STRING"
 	BuiltinObj     = "BUILTIN"
@@ -24,6 +26,15 @@ const (
 	HashObj        = "HASH"
 	QuoteObj       = "QUOTE_OBJ"
 	MacroObj       = "MACRO"
+
+	CompiledFunctionObj = "COMPILED_FUNCTION_OBJ"
+	ClosureObj          = "CLOSURE"
+)
+
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
 )
 
 type HashKey struct {
@@ -69,6 +80,30 @@ type Integer struct {
 	Value int64
 }
 
+// Integers from smallIntMin to smallIntMax are preallocated. Integers are
+// never mutated, so NewInteger can hand the same object to every caller.
+const (
+	smallIntMin = -128
+	smallIntMax = 1024
+)
+
+var smallInts = func() []Integer {
+	ints := make([]Integer, smallIntMax-smallIntMin+1)
+	for i := range ints {
+		ints[i].Value = int64(i + smallIntMin)
+	}
+	return ints
+}()
+
+// NewInteger returns an Integer holding value, without allocating for small
+// values.
+func NewInteger(value int64) *Integer {
+	if value >= smallIntMin && value <= smallIntMax {
+		return &smallInts[value-smallIntMin]
+	}
+	return &Integer{Value: value}
+}
+
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() TypeObject { return IntegerObj }
 func (i *Integer) HashKey() HashKey { return HashKey{Type: i.Type(), Value: uint64(i.Value)} } //nolint:gosec
@@ -103,15 +138,121 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
 	Message string
+	// Err is the Go error behind Message, if any, kept so hosts can match it
+	// with errors.Is.
+	Err error
+	// Stack lists the functions the error unwound through, innermost first.
+	Stack []StackFrame
+	// Kind and Data are set for errors raised by `throw`; other errors are
+	// runtime errors.
+	Kind string
+	Data Object
 }
 
 func (e *Error) Type() TypeObject { return ErrorObj }
 func (e *Error) Inspect() string  { return "Error: " + e.Message }
 
+// StackFrame is a call the error unwound through: the function called and
+// where it was called from. A zero position means the call came from Go.
+type StackFrame struct {
+	Function string
+	Line     int
+	Column   int
+}
+
+func (f StackFrame) String() string {
+	name := f.Function
+	if name == "" {
+		name = "<anonymous>"
+	}
+
+	if f.Line == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (called at %d:%d)", name, f.Line, f.Column)
+}
+
+// maxTraceFrames caps how much of a deep stack, typically a runaway
+// recursion, FormatStack prints.
+const maxTraceFrames = 16
+
+// FormatStack renders frames one per line, innermost first.
+func FormatStack(frames []StackFrame) string {
+	var out strings.Builder
+
+	for i, frame := range frames {
+		if i == maxTraceFrames {
+			fmt.Fprintf(&out, "  ... %d more frames\n", len(frames)-maxTraceFrames)
+			break
+		}
+		fmt.Fprintf(&out, "  at %s\n", frame)
+	}
+
+	return out.String()
+}
+
+func (e *Error) StackTrace() string {
+	return FormatStack(e.Stack)
+}
+
+const RuntimeErrorKind = "RuntimeError"
+
+// ErrorValue is an error as seen by scripts, e.g. the value bound by a catch
+// clause. Its fields are read by indexing: e["message"], e["kind"],
+// e["data"] and e["stack"]. It doubles as a Go error so the VM can raise it.
+type ErrorValue struct {
+	Kind    string
+	Message string
+	Data    Object
+	Stack   []StackFrame
+}
+
+func (ev *ErrorValue) Type() TypeObject { return ErrorValueObj }
+func (ev *ErrorValue) Inspect() string  { return ev.Kind + ": " + ev.Message }
+func (ev *ErrorValue) Error() string    { return ev.Message }
+
+// Field returns the value of one of the error's indexable fields.
+func (ev *ErrorValue) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: ev.Message}, true
+	case "kind":
+		return &String{Value: ev.Kind}, true
+	case "data":
+		if ev.Data == nil {
+			return NULL, true
+		}
+		return ev.Data, true
+	case "stack":
+		frames := make([]Object, len(ev.Stack))
+		for i, frame := range ev.Stack {
+			frames[i] = &String{Value: frame.String()}
+		}
+		return &Array{Elements: frames}, true
+	default:
+		return nil, false
+	}
+}
+
+// NewThrownValue wraps the operand of `throw`. Error values are rethrown as
+// they are and strings become the message; anything else is kept as data.
+func NewThrownValue(value Object) *ErrorValue {
+	switch value := value.(type) {
+	case *ErrorValue:
+		return &ErrorValue{Kind: value.Kind, Message: value.Message, Data: value.Data}
+	case *String:
+		return &ErrorValue{Kind: "Error", Message: value.Value}
+	default:
+		return &ErrorValue{Kind: "Error", Message: value.Inspect(), Data: value}
+	}
+}
+
 type Function struct {
 	Body       *ast.BlockStatement
 	Env        *Environment
 	Parameters []*ast.Identifier
+	// Name is the let binding the function literal was assigned to, if any.
+	Name string
 }
 
 func (f *Function) Type() TypeObject { return FunctionObj }
@@ -139,7 +280,7 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: hash.Sum64()}
 }
 
-type BuiltinFunction = func(args ...Object) Object
+type BuiltinFunction = func(host *Host, args ...Object) Object
 
 type Builtin struct {
 	Function BuiltinFunction
@@ -196,3 +337,32 @@ func (m *Macro) Inspect() string {
 		m.Body.String(),
 	)
 }
+
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string
+	// Lines maps the function's instructions to their positions in the source.
+	Lines    code.LineTable
+	Handlers []code.Handler
+	// LocalNames and FreeNames name the local and free variable slots, for
+	// tools such as the disassembler.
+	LocalNames []string
+	FreeNames  []string
+}
+
+func (cf *CompiledFunction) Type() TypeObject { return CompiledFunctionObj }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() TypeObject { return ClosureObj }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
@@ -60,3 +60,19 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("different integers has same hash key")
 	}
 }
+
+func TestNewInteger(t *testing.T) {
+	for _, value := range []int64{smallIntMin - 1, smallIntMin, 0, 7, smallIntMax, smallIntMax + 1, -1 << 63} {
+		if got := NewInteger(value).Value; got != value {
+			t.Errorf("wrong value. got=%d, want=%d", got, value)
+		}
+	}
+
+	if NewInteger(7) != NewInteger(7) {
+		t.Errorf("small integers are not shared")
+	}
+
+	if NewInteger(smallIntMax+1) == NewInteger(smallIntMax+1) {
+		t.Errorf("large integers must not be shared")
+	}
+}
@@ -0,0 +1,288 @@
+// Package optimizer rewrites programs before they reach the evaluator or the
+// compiler. It only performs rewrites both engines agree on: folding
+// operators whose operands are literals and dropping branches of `if`
+// expressions whose condition is a literal.
+package optimizer
+
+import (
+	"strconv"
+
+	"llc/lang/ast"
+	"llc/lang/token"
+)
+
+type Level int
+
+const (
+	// O0 leaves programs exactly as parsed.
+	O0 Level = iota
+	// O1 folds constants and eliminates dead branches.
+	O1
+)
+
+// Default is the level used when the host does not ask for one.
+const Default = O1
+
+// Optimize rewrites program in place and returns it. Arguments of quote are
+// never touched, so macros see the code exactly as written.
+func Optimize(program *ast.Program, level Level) *ast.Program {
+	if level < O1 {
+		return program
+	}
+
+	program.Statements = statements(program.Statements)
+	return program
+}
+
+func statements(list []ast.Statement) []ast.Statement {
+	out := make([]ast.Statement, 0, len(list))
+
+	for i, s := range list {
+		s = statement(s)
+
+		if live, ok := liveBranch(s); ok && canInline(live, i == len(list)-1) {
+			if live != nil {
+				out = append(out, live.Statements...)
+			}
+			continue
+		}
+
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// liveBranch reports the branch an `if` statement with a literal condition
+// always takes, which is nil when that is a missing else.
+func liveBranch(s ast.Statement) (*ast.BlockStatement, bool) {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+
+	ie, ok := es.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+
+	truthy, ok := literalTruthiness(ie.Condition)
+	if !ok {
+		return nil, false
+	}
+
+	if truthy {
+		return ie.Consequence, true
+	}
+	return ie.Alternative, true
+}
+
+// canInline reports whether the statements of a live branch can replace the
+// `if` around them. Blocks do not introduce scopes, so only the value of the
+// last statement of a block can tell the difference.
+func canInline(live *ast.BlockStatement, last bool) bool {
+	if !last {
+		return true
+	}
+
+	if live == nil || len(live.Statements) == 0 {
+		return false
+	}
+
+	_, ok := live.Statements[len(live.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func block(b *ast.BlockStatement) *ast.BlockStatement {
+	if b != nil {
+		b.Statements = statements(b.Statements)
+	}
+	return b
+}
+
+func statement(s ast.Statement) ast.Statement {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		s.Expression = expression(s.Expression)
+	case *ast.LetStatement:
+		s.Value = expression(s.Value)
+	case *ast.ReturnStatement:
+		s.ReturnValue = expression(s.ReturnValue)
+	case *ast.ThrowStatement:
+		s.Value = expression(s.Value)
+	case *ast.BlockStatement:
+		return block(s)
+	}
+
+	return s
+}
+
+//nolint:cyclop
+func expression(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		e.Right = expression(e.Right)
+		return foldPrefix(e)
+	case *ast.InfixExpression:
+		e.Left = expression(e.Left)
+		e.Right = expression(e.Right)
+		return foldInfix(e)
+	case *ast.IfExpression:
+		return ifExpression(e)
+	case *ast.CallExpression:
+		if e.Function.TokenLiteral() == "quote" {
+			return e
+		}
+		e.Function = expression(e.Function)
+		for i, arg := range e.Arguments {
+			e.Arguments[i] = expression(arg)
+		}
+	case *ast.IndexExpression:
+		e.Left = expression(e.Left)
+		e.Index = expression(e.Index)
+	case *ast.PropagateExpression:
+		e.Value = expression(e.Value)
+	case *ast.ArrayLiteral:
+		for i, element := range e.Elements {
+			e.Elements[i] = expression(element)
+		}
+	case *ast.HashLiteral:
+		pairs := make(map[ast.Expression]ast.Expression, len(e.Pairs))
+		for key, value := range e.Pairs {
+			pairs[expression(key)] = expression(value)
+		}
+		e.Pairs = pairs
+	case *ast.FunctionLiteral:
+		block(e.Body)
+	case *ast.TryExpression:
+		block(e.Block)
+		block(e.Catch)
+		block(e.Finally)
+	}
+
+	return e
+}
+
+func ifExpression(ie *ast.IfExpression) ast.Expression {
+	ie.Condition = expression(ie.Condition)
+	block(ie.Consequence)
+	block(ie.Alternative)
+
+	truthy, ok := literalTruthiness(ie.Condition)
+	if !ok {
+		return ie
+	}
+
+	live := ie.Alternative
+	if truthy {
+		live = ie.Consequence
+		ie.Alternative = nil
+	}
+
+	if live != nil && len(live.Statements) == 1 {
+		if es, ok := live.Statements[0].(*ast.ExpressionStatement); ok {
+			return es.Expression
+		}
+	}
+
+	return ie
+}
+
+// literalTruthiness follows the engines' rule that everything but false and
+// null is truthy.
+func literalTruthiness(e ast.Expression) (bool, bool) {
+	switch e := e.(type) {
+	case *ast.Boolean:
+		return e.Value, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+func foldPrefix(pe *ast.PrefixExpression) ast.Expression {
+	switch pe.Operator {
+	case "-":
+		if right, ok := pe.Right.(*ast.IntegerLiteral); ok {
+			return integer(pe.Token, -right.Value)
+		}
+	case "!":
+		if truthy, ok := literalTruthiness(pe.Right); ok {
+			return boolean(pe.Token, !truthy)
+		}
+	}
+
+	return pe
+}
+
+//nolint:cyclop
+func foldInfix(ie *ast.InfixExpression) ast.Expression {
+	switch left := ie.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := ie.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return ie
+		}
+
+		tok := left.Token
+		switch ie.Operator {
+		case "+":
+			return integer(tok, left.Value+right.Value)
+		case "-":
+			return integer(tok, left.Value-right.Value)
+		case "*":
+			return integer(tok, left.Value*right.Value)
+		case "/":
+			if right.Value != 0 {
+				return integer(tok, left.Value/right.Value)
+			}
+		case "<":
+			return boolean(tok, left.Value < right.Value)
+		case ">":
+			return boolean(tok, left.Value > right.Value)
+		case "==":
+			return boolean(tok, left.Value == right.Value)
+		case "!=":
+			return boolean(tok, left.Value != right.Value)
+		}
+	case *ast.Boolean:
+		right, ok := ie.Right.(*ast.Boolean)
+		if !ok {
+			return ie
+		}
+
+		switch ie.Operator {
+		case "==":
+			return boolean(left.Token, left.Value == right.Value)
+		case "!=":
+			return boolean(left.Token, left.Value != right.Value)
+		}
+	case *ast.StringLiteral:
+		right, ok := ie.Right.(*ast.StringLiteral)
+		if ok && ie.Operator == "+" {
+			tok := left.Token
+			tok.Literal = left.Value + right.Value
+			return &ast.StringLiteral{Token: tok, Value: tok.Literal}
+		}
+	}
+
+	return ie
+}
+
+// integer and boolean build literals positioned at tok, so that errors and
+// call sites still point at the original source.
+func integer(tok token.Token, value int64) *ast.IntegerLiteral {
+	tok.Type = token.Int
+	tok.Literal = strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: tok, Value: value}
+}
+
+func boolean(tok token.Token, value bool) *ast.Boolean {
+	tok.Type = token.False
+	if value {
+		tok.Type = token.True
+	}
+	tok.Literal = strconv.FormatBool(value)
+	return &ast.Boolean{Token: tok, Value: value}
+}
@@ -0,0 +1,120 @@
+package optimizer
+
+import (
+	"fmt"
+	"testing"
+
+	"llc/lang/ast"
+	"llc/lang/compiler"
+	"llc/lang/evaluator"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+	"llc/lang/vm"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 3 + 4", "10"},
+		{"x + 2 * 3", "(x + 6)"},
+		{"2 * 3 + x", "(6 + x)"},
+		{"-(1 + 2)", "-3"},
+		{"10 / 0", "(10 / 0)"},
+		{"1 < 2 == true", "true"},
+		{"1 != 1", "false"},
+		{"!true", "false"},
+		{"!5", "false"},
+		{`"a" + "b" + "c"`, "abc"},
+		{`"a" == "a"`, "(a == a)"},
+		{"let f = fn(x) { x * (60 * 60) };", "let f = fn(x) (x * 3600);"},
+		{"[1 + 1, {2 * 2: 3 - 3}][0]", "([2, {4:0}][0])"},
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (1 > 2) { 1 } else { 2 }", "2"},
+		{"let x = if (false) { 1 };", "let x = iffalse false 1;"},
+		{"if (true) { let a = 1; a }", "let a = 1;a"},
+		{"if (true) { let a = 1; }", "iftrue true let a = 1;"},
+		{"if (false) { 1 }; 2", "2"},
+		{"if (false) { 1 }", "iffalse false 1"},
+		{"let f = fn() { if (true) { let a = 1; a } else { 0 } }", "let f = fn() let a = 1;a;"},
+		{"let x = if (true) { let a = 1; a } else { 0 };", "let x = iftrue true let a = 1;a;"},
+		{"quote(1 + 2)", "quote((1 + 2))"},
+		{"f(1 + 2)", "f(3)"},
+		{"try { 1 + 1 } catch (e) { 2 * 2 } finally { 3 - 3 }", "try 2 catch (e) 4 finally 0"},
+		{"throw 1 + 1;", "throw 2;"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			program := Optimize(parse(tt.input), O1)
+			if program.String() != tt.expected {
+				t.Errorf("wrong program. got=%q, want=%q", program.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestOptimizeO0(t *testing.T) {
+	program := Optimize(parse("2 * 3"), O0)
+	if program.String() != "(2 * 3)" {
+		t.Errorf("O0 must not change programs. got=%q", program.String())
+	}
+}
+
+func TestOptimizedProgramsBehaveTheSame(t *testing.T) {
+	tests := []string{
+		"2 * 3 + 4",
+		"9223372036854775807 + 1",
+		"-9223372036854775807 - 1 / -1",
+		`"a" + "b"`,
+		"!!1",
+		"if (1 > 2) { 1 }",
+		"if (1 < 2) { 1 }",
+		"let f = fn(n) { if (true) { let m = n * (2 + 3); m } else { 0 } }; f(2)",
+		"let f = fn() { if (false) { return 1; }; if (true) { return 2; }; 3 }; f()",
+		"let x = 1; if (true) { let x = 2; }; x",
+		"[1 + 1, 2 * 2][1]",
+	}
+
+	for i, input := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			want := evaluator.Eval(parse(input), object.NewEnvironment()).Inspect()
+
+			got := evaluator.Eval(Optimize(parse(input), O1), object.NewEnvironment()).Inspect()
+			if got != want {
+				t.Errorf("evaluator result changed. got=%q, want=%q", got, want)
+			}
+
+			got = runVM(t, input)
+			if got != want {
+				t.Errorf("vm result differs. got=%q, want=%q", got, want)
+			}
+		})
+	}
+}
+
+func runVM(t *testing.T, input string) string {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(Optimize(parse(input), O1)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return "Error: " + err.Error()
+	}
+
+	return machine.LastPoppedStackElem().Inspect()
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
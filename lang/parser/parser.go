@@ -32,6 +32,7 @@ var precedences = map[token.TypeTocken]int{
 	token.Slash:    PRODUCT,
 	token.Asterisk: PRODUCT,
 	token.LBracket: INDEX,
+	token.Question: INDEX,
 }
 
 type Parser struct {
@@ -40,13 +41,18 @@ type Parser struct {
 	infixParseFns  map[token.TypeTocken]infixParseFn
 	curToken       token.Token
 	peekToken      token.Token
-	errors         []string
+	errors         []Error
+}
+
+// Error is a syntax error and the position of the token it was found at.
+type Error struct {
+	Position token.Position
+	Message  string
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l: l,
 	}
 
 	p.nextToken()
@@ -66,6 +72,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LBracket, p.parseArrayLiteral)
 	p.registerPrefix(token.LBrace, p.parseHashLiteral)
 	p.registerPrefix(token.Macro, p.parseMacroLiteral)
+	p.registerPrefix(token.Try, p.parseTryExpression)
 
 	p.infixParseFns = make(map[string]infixParseFn)
 	p.registerInfix(token.Plus, p.parseInfixExpression)
@@ -78,17 +85,30 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LParen, p.parseCallExpression)
 	p.registerInfix(token.LBracket, p.parseIndexExpression)
+	p.registerInfix(token.Question, p.parsePropagateExpression)
 
 	return p
 }
 
 func (p *Parser) Errors() []string {
+	messages := []string{}
+	for _, err := range p.errors {
+		messages = append(messages, err.Message)
+	}
+	return messages
+}
+
+// ErrorList is Errors with the position of each error.
+func (p *Parser) ErrorList() []Error {
 	return p.errors
 }
 
+func (p *Parser) errorAt(tok token.Token, format string, a ...interface{}) {
+	p.errors = append(p.errors, Error{Position: tok.Position(), Message: fmt.Sprintf(format, a...)})
+}
+
 func (p *Parser) peekError(t token.TypeTocken) {
-	msg := fmt.Sprintf("expected next token to be %s, but got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, "expected next token to be %s, but got %s instead", t, p.peekToken.Type)
 }
 
 func (p *Parser) nextToken() {
@@ -118,6 +138,8 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.Return:
 		return p.parseReturnStatement()
+	case token.Throw:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -213,11 +235,10 @@ func (p *Parser) parseExpressionList(end token.TypeTocken) []ast.Expression {
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.peekTokenIs(end) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 
-	p.nextToken()
 	return list
 }
 
@@ -227,14 +248,17 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 	exp.Index = p.parseExpression(LOWEST)
 
-	if !p.peekTokenIs(token.RBracket) {
+	if !p.expectPeek(token.RBracket) {
 		return nil
 	}
-	p.nextToken()
 
 	return exp
 }
 
+func (p *Parser) parsePropagateExpression(left ast.Expression) ast.Expression {
+	return &ast.PropagateExpression{Token: p.curToken, Value: left}
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -242,7 +266,15 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.ParameterTypes = p.parseFunctionParameters()
+
+	if p.peekTokenIs(token.Arrow) {
+		p.nextToken()
+		p.nextToken()
+		if lit.ReturnType = p.parseType(); lit.ReturnType == nil {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LBrace) {
 		return nil
@@ -252,31 +284,113 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// parseFunctionParameters also returns the type annotation of each
+// parameter, nil for those without one, or no types at all if none has one.
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []*ast.Type) {
 	identifiers := []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RParen) {
 		p.nextToken()
-		return identifiers
+		return identifiers, nil
 	}
 
-	p.nextToken()
+	var types []*ast.Type
+	annotated := false
+	parameter := func() {
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		identifiers = append(identifiers, ident)
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+		var typ *ast.Type
+		if p.peekTokenIs(token.Colon) {
+			p.nextToken()
+			p.nextToken()
+			typ = p.parseType()
+			annotated = true
+		}
+		types = append(types, typ)
+	}
+
+	p.nextToken()
+	parameter()
 
 	for p.peekTokenIs(token.Comma) {
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		parameter()
 	}
 
 	if !p.expectPeek(token.RParen) {
+		return nil, nil
+	}
+
+	if !annotated {
+		types = nil
+	}
+	return identifiers, types
+}
+
+// parseType parses the type annotation starting at the current token.
+func (p *Parser) parseType() *ast.Type {
+	typ := &ast.Type{Token: p.curToken}
+
+	switch p.curToken.Type {
+	case token.Ident:
+	case token.LBracket:
+		p.nextToken()
+		typ.Element = p.parseType()
+		if typ.Element == nil || !p.expectPeek(token.RBracket) {
+			return nil
+		}
+	case token.LBrace:
+		p.nextToken()
+		typ.Key = p.parseType()
+		if typ.Key == nil || !p.expectPeek(token.Colon) {
+			return nil
+		}
+		p.nextToken()
+		typ.Value = p.parseType()
+		if typ.Value == nil || !p.expectPeek(token.RBrace) {
+			return nil
+		}
+	case token.Function:
+		if !p.parseFunctionType(typ) {
+			return nil
+		}
+	default:
+		p.errorAt(p.curToken, "expected a type, got %s", p.curToken.Type)
 		return nil
 	}
 
-	return identifiers
+	return typ
+}
+
+func (p *Parser) parseFunctionType(typ *ast.Type) bool {
+	if !p.expectPeek(token.LParen) {
+		return false
+	}
+
+	typ.Parameters = []*ast.Type{}
+	for !p.peekTokenIs(token.RParen) {
+		p.nextToken()
+		parameter := p.parseType()
+		if parameter == nil {
+			return false
+		}
+		typ.Parameters = append(typ.Parameters, parameter)
+
+		if !p.peekTokenIs(token.RParen) && !p.expectPeek(token.Comma) {
+			return false
+		}
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.Arrow) {
+		p.nextToken()
+		p.nextToken()
+		typ.Result = p.parseType()
+		return typ.Result != nil
+	}
+	return true
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
@@ -314,6 +428,49 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBrace) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.Catch) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LParen) || !p.expectPeek(token.Ident) {
+			return nil
+		}
+
+		expression.CatchParameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectPeek(token.RParen) || !p.expectPeek(token.LBrace) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.Finally) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBrace) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.errorAt(p.curToken, "expected catch or finally after try block")
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -325,6 +482,10 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.RBrace) {
+		block.RBrace = p.curToken
+	}
+
 	return block
 }
 
@@ -343,8 +504,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -394,6 +554,14 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	if p.peekTokenIs(token.Colon) {
+		p.nextToken()
+		p.nextToken()
+		if stmt.Type = p.parseType(); stmt.Type == nil {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(token.Assign) {
 		return nil
 	}
@@ -401,6 +569,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	for !p.curTokenIs(token.Semicolon) && !p.curTokenIs(token.EOF) {
 		p.nextToken()
 	}
@@ -408,6 +580,20 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -422,8 +608,22 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// parseIdentifier also folds namespaced names such as `math.abs` into a
+// single identifier; namespaces only exist for host-registered builtins.
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	for p.peekTokenIs(token.Dot) {
+		p.nextToken()
+		if !p.expectPeek(token.Ident) {
+			return nil
+		}
+
+		ident.Value += "." + p.curToken.Literal
+	}
+	ident.Token.Literal = ident.Value
+
+	return ident
 }
 
 func (p *Parser) parseMacroLiteral() ast.Expression {
@@ -433,7 +633,14 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	var types []*ast.Type
+	lit.Parameters, types = p.parseFunctionParameters()
+	for _, typ := range types {
+		if typ != nil {
+			p.errorAt(typ.Token, "macro parameters cannot have type annotations")
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LBrace) {
 		return nil
@@ -445,8 +652,7 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TypeTocken) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) curTokenIs(t token.TypeTocken) bool {
@@ -105,6 +105,33 @@ func TestIdentifierExpression(t *testing.T) {
 	}
 }
 
+func TestNamespacedIdentifierExpression(t *testing.T) {
+	l := lexer.New("math.abs(-1);")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, call.Function, "math.abs") {
+		return
+	}
+
+	p = New(lexer.New("math.1"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected parser error for incomplete namespaced identifier")
+	}
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
@@ -264,6 +291,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"f(x)? + 1", "((f(x)?) + 1)"},
+		{"-a?", "(-(a?))"},
+		{"a[0]?[1]", "(((a[0])?)[1])"},
+		{"f()?()?", "((f()?)()?)"},
 	}
 
 	for i, tt := range tests {
@@ -906,3 +937,177 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 
 	return true
 }
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		hasCatch   bool
+		hasFinally bool
+		expected   string
+	}{
+		{"try { x } catch (e) { e }", true, false, "try x catch (e) e"},
+		{"try { x } finally { y }", false, true, "try x finally y"},
+		{"try { x } catch (err) { y } finally { z }", true, true, "try x catch (err) y finally z"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+			if !ok {
+				t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+			}
+
+			exp, ok := stmt.Expression.(*ast.TryExpression)
+			if !ok {
+				t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+			}
+
+			if (exp.Catch != nil) != tt.hasCatch || (exp.Finally != nil) != tt.hasFinally {
+				t.Errorf("wrong clauses. catch=%v, finally=%v", exp.Catch != nil, exp.Finally != nil)
+			}
+
+			if exp.String() != tt.expected {
+				t.Errorf("wrong string. got=%q, want=%q", exp.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []string{
+		"try { x }",
+		"try { x } catch { y }",
+		"try { x } catch (1) { y }",
+	}
+
+	for i, input := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			p := New(lexer.New(input))
+			p.ParseProgram()
+
+			if len(p.Errors()) == 0 {
+				t.Errorf("expected parser errors for %q", input)
+			}
+		})
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	p := New(lexer.New(`throw "boom"; 1`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.String() != "throw boom;" {
+		t.Errorf("wrong string. got=%q", stmt.String())
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, but got INT instead"},
+		{"let x = ;", "1:9: no prefix parse function for ; found"},
+		{"fn(x) {\n  x +\n}", "3:1: no prefix parse function for } found"},
+		{"try { x }", "1:9: expected catch or finally after try block"},
+		{"let x: = 1;", "1:8: expected a type, got ="},
+		{"fn(a: [int) { a }", "1:11: expected next token to be ], but got ) instead"},
+		{"macro(a: int) { a }", "1:10: macro parameters cannot have type annotations"},
+		{"a[1", "1:4: expected next token to be ], but got EOF instead"},
+		{"f(1", "1:4: expected next token to be ), but got EOF instead"},
+		{"[1, 2 3]", "1:7: expected next token to be ], but got INT instead"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+
+			errors := p.ErrorList()
+			if len(errors) == 0 {
+				t.Fatalf("expected parser errors for %q", tt.input)
+			}
+			if got := errors[0].Position.String() + ": " + errors[0].Message; got != tt.expected {
+				t.Errorf("wrong error. got=%q, want=%q", got, tt.expected)
+			}
+			if p.Errors()[0] != errors[0].Message {
+				t.Errorf("Errors and ErrorList disagree: %q", p.Errors()[0])
+			}
+		})
+	}
+}
+
+func TestBlockClosingBrace(t *testing.T) {
+	p := New(lexer.New("fn(x) {\n  x\n}; if (true) { 1"))
+	program := p.ParseProgram()
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if pos := fn.Body.RBrace.Position(); pos.String() != "3:1" {
+		t.Errorf("wrong closing brace. got=%s", pos)
+	}
+
+	ifExp := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if ifExp.Consequence.RBrace.Line != 0 {
+		t.Errorf("unclosed block has a closing brace at %s", ifExp.Consequence.RBrace.Position())
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 1;", "let x: int = 1;"},
+		{"let xs: [string] = [];", "let xs: [string] = [];"},
+		{`let h: {string: [int]} = {};`, "let h: {string: [int]} = {};"},
+		{"let f: fn(int, bool) -> string = g;", "let f: fn(int, bool) -> string = g;"},
+		{"let f: fn() = g;", "let f: fn() = g;"},
+		{"fn(a: int, b, c: [string]) -> bool { a }", "fn(a: int, b, c: [string]) -> bool a"},
+		{"fn(a, b) -> fn(int) -> int { a }", "fn(a, b) -> fn(int) -> int a"},
+		{"fn(a, b) { a - b }", "fn(a, b) (a - b)"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. got=%q, want=%q", got, tt.expected)
+			}
+		})
+	}
+
+	p := New(lexer.New("fn(a, b: int) { a }; fn(a, b) { a }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	annotated := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(annotated.ParameterTypes) != 2 || annotated.ParameterTypes[0] != nil ||
+		annotated.ParameterTypes[1].String() != "int" {
+		t.Errorf("wrong parameter types: %v", annotated.ParameterTypes)
+	}
+	plain := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if plain.ParameterTypes != nil || plain.ReturnType != nil {
+		t.Errorf("unannotated function has types: %v %v", plain.ParameterTypes, plain.ReturnType)
+	}
+}
@@ -0,0 +1,150 @@
+// Package regvm is a register-based backend for compiled programs. Lower
+// translates the stack bytecode produced by package compiler into code whose
+// operands name registers, and VM runs it with the same objects, builtins,
+// limits and error handling as package vm.
+package regvm
+
+import (
+	"bytes"
+	"fmt"
+
+	"llc/lang/code"
+)
+
+type Opcode byte
+
+// Registers are numbered from the start of the running function's window:
+// its locals first, then one register per operand stack slot of the stack
+// bytecode. K is the constant pool and G the globals store.
+const (
+	OpLoadConstant   Opcode = iota // R[A] = K[B]
+	OpLoadTrue                     // R[A] = true
+	OpLoadFalse                    // R[A] = false
+	OpLoadNull                     // R[A] = null
+	OpMove                         // R[A] = R[B]
+	OpAdd                          // R[A] = R[B] + R[C]
+	OpSub                          // R[A] = R[B] - R[C]
+	OpMul                          // R[A] = R[B] * R[C]
+	OpDiv                          // R[A] = R[B] / R[C]
+	OpAddConstant                  // R[A] = R[B] + K[C]
+	OpSubConstant                  // R[A] = R[B] - K[C]
+	OpEqual                        // R[A] = R[B] == R[C]
+	OpNotEqual                     // R[A] = R[B] != R[C]
+	OpGreaterThan                  // R[A] = R[B] > R[C]
+	OpMinus                        // R[A] = -R[B]
+	OpBang                         // R[A] = !R[B]
+	OpJump                         // pc = A
+	OpJumpNotTruthy                // if !R[A] { pc = B }
+	OpJumpNotError                 // if R[A] is not an error value { pc = B }
+	OpGetGlobal                    // R[A] = G[B]
+	OpSetGlobal                    // G[A] = R[B]
+	OpGetBuiltin                   // R[A] = builtin B
+	OpGetFree                      // R[A] = free variable B
+	OpCurrentClosure               // R[A] = the running closure
+	OpArray                        // R[A] = [R[B], ..., R[B+C-1]]
+	OpHash                         // R[A] = {R[B]: R[B+1], ..., R[B+C-2]: R[B+C-1]}
+	OpIndex                        // R[A] = R[B][R[C]]
+	OpCall                         // R[A] = R[A](R[A+1], ..., R[A+B])
+	OpClosure                      // R[A] = closure of K[B] over R[A], ..., R[A+C-1]
+	OpReturnValue                  // return R[A]
+	OpReturn                       // return null
+	OpThrow                        // throw R[A]
+	OpResult                       // the program's last value = R[A]
+)
+
+type definition struct {
+	name     string
+	operands int
+}
+
+var definitions = [...]definition{
+	OpLoadConstant:   {"LoadConstant", 2},
+	OpLoadTrue:       {"LoadTrue", 1},
+	OpLoadFalse:      {"LoadFalse", 1},
+	OpLoadNull:       {"LoadNull", 1},
+	OpMove:           {"Move", 2},
+	OpAdd:            {"Add", 3},
+	OpSub:            {"Sub", 3},
+	OpMul:            {"Mul", 3},
+	OpDiv:            {"Div", 3},
+	OpAddConstant:    {"AddConstant", 3},
+	OpSubConstant:    {"SubConstant", 3},
+	OpEqual:          {"Equal", 3},
+	OpNotEqual:       {"NotEqual", 3},
+	OpGreaterThan:    {"GreaterThan", 3},
+	OpMinus:          {"Minus", 2},
+	OpBang:           {"Bang", 2},
+	OpJump:           {"Jump", 1},
+	OpJumpNotTruthy:  {"JumpNotTruthy", 2},
+	OpJumpNotError:   {"JumpNotError", 2},
+	OpGetGlobal:      {"GetGlobal", 2},
+	OpSetGlobal:      {"SetGlobal", 2},
+	OpGetBuiltin:     {"GetBuiltin", 2},
+	OpGetFree:        {"GetFree", 2},
+	OpCurrentClosure: {"CurrentClosure", 1},
+	OpArray:          {"Array", 3},
+	OpHash:           {"Hash", 3},
+	OpIndex:          {"Index", 3},
+	OpCall:           {"Call", 2},
+	OpClosure:        {"Closure", 3},
+	OpReturnValue:    {"ReturnValue", 1},
+	OpReturn:         {"Return", 0},
+	OpThrow:          {"Throw", 1},
+	OpResult:         {"Result", 1},
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(definitions) {
+		return definitions[op].name
+	}
+	return fmt.Sprintf("Opcode(%d)", op)
+}
+
+type Instruction struct {
+	Op      Opcode
+	A, B, C int
+}
+
+func (ins Instruction) String() string {
+	operands := []int{ins.A, ins.B, ins.C}
+	if int(ins.Op) < len(definitions) {
+		operands = operands[:definitions[ins.Op].operands]
+	}
+
+	out := ins.Op.String()
+	for _, operand := range operands {
+		out += fmt.Sprintf(" %d", operand)
+	}
+	return out
+}
+
+type Instructions []Instruction
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+	for pc, in := range ins {
+		fmt.Fprintf(&out, "%04d %s\n", pc, in)
+	}
+	return out.String()
+}
+
+// Handler is an entry of a function's exception-handler table. An error
+// raised by an instruction in [Start, End) is caught by storing it in
+// Register and jumping to Target.
+type Handler struct {
+	Start    int
+	End      int
+	Target   int
+	Register int
+}
+
+type Function struct {
+	Instructions  Instructions
+	NumRegisters  int
+	NumParameters int
+	Name          string
+	// Lines maps pcs to source positions like the line table of the stack
+	// bytecode the function was lowered from.
+	Lines    code.LineTable
+	Handlers []Handler
+}
@@ -0,0 +1,428 @@
+package regvm
+
+import (
+	"fmt"
+
+	"llc/lang/builtins"
+	"llc/lang/code"
+	"llc/lang/compiler"
+	"llc/lang/object"
+	"llc/lang/verifier"
+)
+
+// Program is a compiled program lowered to register code.
+type Program struct {
+	Main      *Function
+	Constants []object.Object
+	// Functions holds the lowered form of each function constant at the
+	// constant's index, and nil for other constants.
+	Functions []*Function
+	Builtins  []builtins.Definition
+}
+
+// Lower translates bytecode into register code. The operand stack depth of
+// every instruction is known statically, so each stack slot becomes a fixed
+// register after the function's locals. Reads of locals are not copied into
+// a slot unless the local changes or the slot has to be in place, as for
+// the arguments of a call. Bytecode that fails verification is rejected.
+func Lower(bytecode *compiler.Bytecode) (*Program, error) {
+	if err := verifier.Verify(bytecode); err != nil {
+		return nil, err
+	}
+
+	program := &Program{
+		Constants: bytecode.Constants,
+		Functions: make([]*Function, len(bytecode.Constants)),
+		Builtins:  bytecode.Builtins,
+	}
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		lowered, err := lowerFunction(fn, false)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+
+		lowered.Name = fn.Name
+		lowered.NumParameters = fn.NumParameters
+		program.Functions[i] = lowered
+	}
+
+	main, err := lowerFunction(&object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Lines:        bytecode.Lines,
+		Handlers:     bytecode.Handlers,
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("main: %w", err)
+	}
+	program.Main = main
+
+	return program, nil
+}
+
+type lowerer struct {
+	numLocals int
+	main      bool
+	out       Instructions
+
+	// stack holds, for each operand stack slot, the register its value is
+	// read from: the slot's own register, or the local it was loaded from.
+	stack     []int
+	maxDepth  int
+	reachable bool
+	underflow bool
+
+	// offset is the stack bytecode offset being lowered.
+	offset int
+	labels map[int]bool
+	depths map[int]int
+	pcs    map[int]int
+	// jumps are the pcs of jumps whose target is still an offset.
+	jumps []int
+}
+
+func lowerFunction(compiled *object.CompiledFunction, main bool) (*Function, error) {
+	ins, numLocals, handlers := compiled.Instructions, compiled.NumLocals, compiled.Handlers
+
+	depths, err := verifier.Depths(compiled, main)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &lowerer{
+		numLocals: numLocals,
+		main:      main,
+		reachable: true,
+		labels:    make(map[int]bool),
+		depths:    depths,
+		pcs:       make(map[int]int),
+	}
+
+	for _, h := range handlers {
+		l.labels[h.Start], l.labels[h.End], l.labels[h.Target] = true, true, true
+	}
+
+	for offset := 0; offset < len(ins); {
+		_, operands, width, err := ins.Decode(offset)
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %w", offset, err)
+		}
+
+		if isJump(ins.Opcode(offset)) {
+			l.labels[operands[0]] = true
+		}
+		offset += width
+	}
+
+	for offset := 0; offset <= len(ins); {
+		l.offset = offset
+		if l.labels[offset] {
+			if err := l.enterLabel(); err != nil {
+				return nil, fmt.Errorf("offset %d: %w", offset, err)
+			}
+		}
+		l.pcs[offset] = len(l.out)
+
+		if offset == len(ins) {
+			break
+		}
+
+		_, operands, width, _ := ins.Decode(offset)
+		reachable := l.reachable
+		l.underflow = false
+		if err := l.lower(ins.Opcode(offset), operands); err != nil {
+			return nil, fmt.Errorf("offset %d: %w", offset, err)
+		}
+		if l.underflow && reachable {
+			return nil, fmt.Errorf("offset %d: operand stack underflow", offset)
+		}
+
+		offset += width
+	}
+
+	for _, pc := range l.jumps {
+		in := &l.out[pc]
+		target := &in.B
+		if in.Op == OpJump {
+			target = &in.A
+		}
+
+		var ok bool
+		if *target, ok = l.pcs[*target]; !ok {
+			return nil, fmt.Errorf("jump to %d is not an instruction boundary", *target)
+		}
+	}
+
+	fn := &Function{
+		Instructions: l.out,
+		NumRegisters: numLocals + l.maxDepth,
+	}
+
+	for _, line := range compiled.Lines {
+		fn.Lines = fn.Lines.Add(l.pcs[line.Offset], line.Position)
+	}
+
+	for _, h := range handlers {
+		fn.Handlers = append(fn.Handlers, Handler{
+			Start:    l.pcs[h.Start],
+			End:      l.pcs[h.End],
+			Target:   l.pcs[h.Target],
+			Register: numLocals + h.Depth,
+		})
+	}
+
+	return fn, nil
+}
+
+var binaryOps = map[code.Opcode]Opcode{
+	code.OpAdd:         OpAdd,
+	code.OpSub:         OpSub,
+	code.OpMul:         OpMul,
+	code.OpDiv:         OpDiv,
+	code.OpEqual:       OpEqual,
+	code.OpNotEqual:    OpNotEqual,
+	code.OpGreaterThan: OpGreaterThan,
+	code.OpIndex:       OpIndex,
+}
+
+var loadOps = map[code.Opcode]Opcode{
+	code.OpConstant:       OpLoadConstant,
+	code.OpTrue:           OpLoadTrue,
+	code.OpFalse:          OpLoadFalse,
+	code.OpNull:           OpLoadNull,
+	code.OpGetGlobal:      OpGetGlobal,
+	code.OpGetBuiltin:     OpGetBuiltin,
+	code.OpGetFree:        OpGetFree,
+	code.OpCurrentClosure: OpCurrentClosure,
+}
+
+func (l *lowerer) lower(op code.Opcode, operands []int) error { //nolint:cyclop,funlen
+	if load, ok := loadOps[op]; ok {
+		operand := 0
+		if len(operands) > 0 {
+			operand = operands[0]
+		}
+		l.emit(load, l.pushSlot(), operand, 0)
+		return nil
+	}
+
+	if binary, ok := binaryOps[op]; ok {
+		right := l.pop()
+		left := l.pop()
+		l.emit(binary, l.pushSlot(), left, right)
+		return nil
+	}
+
+	switch op {
+	case code.OpGetLocal:
+		l.push(operands[0])
+	case code.OpSetLocal:
+		l.setLocal(operands[0])
+	case code.OpSetGlobal:
+		l.emit(OpSetGlobal, operands[0], l.pop(), 0)
+	case code.OpAddConst, code.OpSubConst:
+		fused := OpAddConstant
+		if op == code.OpSubConst {
+			fused = OpSubConstant
+		}
+		left := l.pop()
+		l.emit(fused, l.pushSlot(), left, operands[0])
+	case code.OpGetLocalAdd:
+		left := l.pop()
+		l.emit(OpAdd, l.pushSlot(), left, operands[0])
+	case code.OpMinus, code.OpBang:
+		unary := OpMinus
+		if op == code.OpBang {
+			unary = OpBang
+		}
+		operand := l.pop()
+		l.emit(unary, l.pushSlot(), operand, 0)
+	case code.OpPop:
+		value := l.pop()
+		if l.main {
+			l.emit(OpResult, value, 0, 0)
+		}
+	case code.OpJump:
+		l.materialize(0)
+		l.jump(OpJump, 0, operands[0])
+		l.reachable = false
+	case code.OpJumpNotTruthy:
+		condition := l.pop()
+		l.materialize(0)
+		l.jump(OpJumpNotTruthy, condition, operands[0])
+	case code.OpJumpNotError:
+		l.materialize(0)
+		l.jump(OpJumpNotError, l.top(), operands[0])
+	case code.OpArray, code.OpHash:
+		collection := OpArray
+		if op == code.OpHash {
+			collection = OpHash
+		}
+		first := l.popInPlace(operands[0])
+		l.emit(collection, l.pushSlot(), first, operands[0])
+	case code.OpCall:
+		l.popInPlace(operands[0] + 1)
+		l.emit(OpCall, l.pushSlot(), operands[0], 0)
+	case code.OpClosure:
+		l.popInPlace(operands[1])
+		l.emit(OpClosure, l.pushSlot(), operands[0], operands[1])
+	case code.OpReturnValue:
+		l.emit(OpReturnValue, l.pop(), 0, 0)
+		l.reachable = false
+	case code.OpReturn:
+		l.emit(OpReturn, 0, 0, 0)
+		l.reachable = false
+	case code.OpThrow:
+		l.emit(OpThrow, l.pop(), 0, 0)
+		l.reachable = false
+	default:
+		return fmt.Errorf("opcode %d cannot be lowered", op)
+	}
+
+	return nil
+}
+
+// enterLabel starts a basic block. Control can arrive from elsewhere, where
+// every slot is in its own register, so the falling-through path is made to
+// agree. A label no path reaches, such as one only jumped to from behind a
+// return, starts unreachable code.
+func (l *lowerer) enterLabel() error {
+	if l.reachable {
+		l.materialize(0)
+	}
+
+	known, ok := l.depths[l.offset]
+	if l.reachable && known != len(l.stack) {
+		return fmt.Errorf("operand stack depth %d, want %d", len(l.stack), known)
+	}
+
+	l.stack = l.stack[:0]
+	for range known {
+		l.pushSlot()
+	}
+	l.reachable = ok
+
+	return nil
+}
+
+func (l *lowerer) setLocal(local int) {
+	value := l.pop()
+	before := len(l.out)
+	l.materializeLocal(local)
+
+	if value == local {
+		return
+	}
+
+	// A value computed just before can be computed into the local directly.
+	if last := before - 1; last >= 0 && len(l.out) == before && !l.labels[l.offset] &&
+		value == l.slot(len(l.stack)) && l.out[last].A == value && retargetable(l.out[last].Op) {
+		l.out[last].A = local
+		return
+	}
+
+	l.emit(OpMove, local, value, 0)
+}
+
+// retargetable reports whether op writes R[A] without A having any other
+// meaning.
+func retargetable(op Opcode) bool {
+	switch op {
+	case OpCall, OpClosure, OpJump, OpJumpNotTruthy, OpJumpNotError, OpSetGlobal,
+		OpReturnValue, OpReturn, OpThrow, OpResult:
+		return false
+	default:
+		return true
+	}
+}
+
+func (l *lowerer) slot(i int) int {
+	return l.numLocals + i
+}
+
+func (l *lowerer) push(register int) {
+	l.stack = append(l.stack, register)
+	l.maxDepth = max(l.maxDepth, len(l.stack))
+}
+
+func (l *lowerer) pushSlot() int {
+	register := l.slot(len(l.stack))
+	l.push(register)
+	return register
+}
+
+func (l *lowerer) pop() int {
+	if len(l.stack) == 0 {
+		l.underflow = true
+		return 0
+	}
+
+	register := l.stack[len(l.stack)-1]
+	l.stack = l.stack[:len(l.stack)-1]
+	return register
+}
+
+func (l *lowerer) top() int {
+	if len(l.stack) == 0 {
+		l.underflow = true
+		return 0
+	}
+	return l.stack[len(l.stack)-1]
+}
+
+// popInPlace pops n slots that an instruction reads as consecutive
+// registers, and returns the first of them.
+func (l *lowerer) popInPlace(n int) int {
+	if n > len(l.stack) {
+		l.underflow = true
+		return 0
+	}
+
+	first := len(l.stack) - n
+	l.materialize(first)
+	l.stack = l.stack[:first]
+	return l.slot(first)
+}
+
+// materialize copies slots from index from on that are read from a local
+// into their own registers.
+func (l *lowerer) materialize(from int) {
+	for i := from; i < len(l.stack); i++ {
+		if l.stack[i] != l.slot(i) {
+			l.emit(OpMove, l.slot(i), l.stack[i], 0)
+			l.stack[i] = l.slot(i)
+		}
+	}
+}
+
+// materializeLocal copies the slots read from local before it changes.
+func (l *lowerer) materializeLocal(local int) {
+	for i, register := range l.stack {
+		if register == local {
+			l.emit(OpMove, l.slot(i), local, 0)
+			l.stack[i] = l.slot(i)
+		}
+	}
+}
+
+func (l *lowerer) jump(op Opcode, register, target int) {
+	l.jumps = append(l.jumps, len(l.out))
+	if op == OpJump {
+		l.emit(op, target, 0, 0)
+	} else {
+		l.emit(op, register, target, 0)
+	}
+}
+
+func (l *lowerer) emit(op Opcode, a, b, c int) {
+	l.out = append(l.out, Instruction{Op: op, A: a, B: b, C: c})
+}
+
+func isJump(op code.Opcode) bool {
+	return op == code.OpJump || op == code.OpJumpNotTruthy || op == code.OpJumpNotError
+}
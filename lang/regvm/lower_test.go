@@ -0,0 +1,52 @@
+package regvm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLower(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		registers int
+	}{
+		{
+			// Locals are read in place and a result is computed straight into
+			// the local it is assigned to.
+			`fn(a, b) { let c = a + b; c * a }`,
+			"0000 Add 2 0 1\n0001 Mul 3 2 0\n0002 ReturnValue 3\n",
+			5,
+		},
+		{
+			// Arguments of a call have to be in consecutive registers.
+			`fn(f, x) { f(x, 1) }`,
+			"0000 LoadConstant 4 0\n0001 Move 2 0\n0002 Move 3 1\n0003 Call 2 2\n0004 ReturnValue 2\n",
+			5,
+		},
+		{
+			// Slots read from locals are copied in place before a jump, where
+			// both paths have to agree.
+			`fn(x) { [x, if (true) { let y = 2; y }] }`,
+			"0000 LoadTrue 3\n0001 Move 2 0\n0002 JumpNotTruthy 3 6\n0003 LoadConstant 1 0\n0004 Move 3 1\n" +
+				"0005 Jump 7\n0006 LoadNull 3\n0007 Array 2 2 2\n0008 ReturnValue 2\n",
+			4,
+		},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			program := lower(t, compile(t, tt.input, false))
+			fn := program.Functions[len(program.Functions)-1]
+
+			if fn.Instructions.String() != tt.expected {
+				t.Errorf("wrong instructions.\nwant=\n%s\ngot=\n%s", tt.expected, fn.Instructions)
+			}
+
+			if fn.NumRegisters != tt.registers {
+				t.Errorf("wrong number of registers. got=%d, want=%d", fn.NumRegisters, tt.registers)
+			}
+		})
+	}
+}
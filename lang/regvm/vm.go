@@ -0,0 +1,532 @@
+package regvm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"llc/lang/builtins"
+	"llc/lang/code"
+	"llc/lang/object"
+	"llc/lang/vm"
+)
+
+// MaxRegisters bounds the register file shared by all frames, which starts
+// small and grows with the call depth.
+const MaxRegisters = 1 << 16
+
+const initialRegisters = 256
+
+// Closure is a function value of the register VM.
+type Closure struct {
+	Fn   *Function
+	Free []object.Object
+}
+
+func (c *Closure) Type() object.TypeObject { return object.ClosureObj }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+type frame struct {
+	cl *Closure
+	// pc is the next instruction; pc-1 is the one running.
+	pc   int
+	base int
+}
+
+type VM struct {
+	host      *object.Host
+	meter     *object.Meter
+	program   *Program
+	constants []object.Object
+	builtins  []builtins.Definition
+
+	registers []object.Object
+	globals   []object.Object
+
+	frames      []frame
+	framesIndex int
+
+	result object.Object
+}
+
+func New(program *Program) *VM {
+	return NewWithHost(program, nil)
+}
+
+func NewWithHost(program *Program, host *object.Host) *VM {
+	definitions := program.Builtins
+	if definitions == nil {
+		definitions = builtins.Definitions
+	}
+
+	frames := make([]frame, vm.MaxFrames)
+	frames[0] = frame{cl: &Closure{Fn: program.Main}}
+
+	return &VM{
+		host:      host,
+		program:   program,
+		constants: program.Constants,
+		builtins:  definitions,
+
+		registers: make([]object.Object, max(initialRegisters, program.Main.NumRegisters)),
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// Result is the value of the last expression statement of the program, or
+// of its top-level return.
+func (m *VM) Result() object.Object {
+	return m.result
+}
+
+func (m *VM) Run() error {
+	return m.RunContext(context.Background())
+}
+
+// RunContext runs the program like vm.VM.RunContext does.
+func (m *VM) RunContext(ctx context.Context) error {
+	var limits object.Limits
+	if m.host != nil {
+		limits = m.host.Limits
+	}
+
+	m.meter = object.NewMeter(ctx, limits)
+	defer func() { m.meter = nil }()
+
+	for {
+		err := m.run()
+		if err == nil {
+			return nil
+		}
+
+		stack := m.callStack()
+		f := &m.frames[m.framesIndex-1]
+		position, _ := f.cl.Fn.Lines.Lookup(f.pc - 1)
+		if !m.handleError(err, stack) {
+			return &vm.RuntimeError{Err: err, Stack: stack, Position: position}
+		}
+	}
+}
+
+func (m *VM) handleError(err error, stack []object.StackFrame) bool {
+	if errors.Is(err, object.ErrLimitExceeded) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	for i := m.framesIndex - 1; i >= 0; i-- {
+		f := &m.frames[i]
+
+		for _, handler := range f.cl.Fn.Handlers {
+			if f.pc-1 < handler.Start || f.pc-1 >= handler.End {
+				continue
+			}
+
+			for m.framesIndex > i+1 {
+				m.popFrame()
+			}
+
+			errorValue := &object.ErrorValue{Kind: object.RuntimeErrorKind, Message: err.Error()}
+			var thrown *object.ErrorValue
+			if errors.As(err, &thrown) {
+				errorValue.Kind, errorValue.Data = thrown.Kind, thrown.Data
+			}
+			errorValue.Stack = stack[:len(stack)-i]
+
+			m.registers[f.base+handler.Register] = errorValue
+			f.pc = handler.Target
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *VM) callStack() []object.StackFrame {
+	stack := make([]object.StackFrame, 0, m.framesIndex-1)
+
+	for i := m.framesIndex - 1; i > 0; i-- {
+		caller := &m.frames[i-1]
+		pos, _ := caller.cl.Fn.Lines.Lookup(caller.pc - 1)
+
+		stack = append(stack, object.StackFrame{
+			Function: m.frames[i].cl.Fn.Name,
+			Line:     pos.Line,
+			Column:   pos.Column,
+		})
+	}
+
+	return stack
+}
+
+func (m *VM) run() error { //nolint:gocognit,cyclop,funlen,gocyclo,maintidx
+	for {
+		// f stays valid until the next call or return, after which the loop
+		// picks up the new current frame.
+		f := &m.frames[m.framesIndex-1]
+		instructions := f.cl.Fn.Instructions
+		if f.pc >= len(instructions) {
+			return nil
+		}
+
+		if err := m.meter.Step(); err != nil {
+			return err
+		}
+
+		in := &instructions[f.pc]
+		f.pc++
+		r := m.registers[f.base:]
+
+		switch in.Op {
+		case OpLoadConstant:
+			r[in.A] = m.constants[in.B]
+		case OpLoadTrue:
+			r[in.A] = object.TRUE
+		case OpLoadFalse:
+			r[in.A] = object.FALSE
+		case OpLoadNull:
+			r[in.A] = object.NULL
+		case OpMove:
+			r[in.A] = r[in.B]
+		case OpAdd, OpSub, OpMul, OpDiv:
+			result, err := m.binary(in.Op, r[in.B], r[in.C])
+			if err != nil {
+				return err
+			}
+			r[in.A] = result
+		case OpAddConstant, OpSubConstant:
+			op := OpAdd
+			if in.Op == OpSubConstant {
+				op = OpSub
+			}
+
+			result, err := m.binary(op, r[in.B], m.constants[in.C])
+			if err != nil {
+				return err
+			}
+			r[in.A] = result
+		case OpEqual, OpNotEqual, OpGreaterThan:
+			result, err := compare(in.Op, r[in.B], r[in.C])
+			if err != nil {
+				return err
+			}
+			r[in.A] = result
+		case OpMinus:
+			integer, ok := r[in.B].(*object.Integer)
+			if !ok {
+				return fmt.Errorf("unsupported type for negation: %s", r[in.B].Type())
+			}
+			r[in.A] = object.NewInteger(-integer.Value)
+		case OpBang:
+			r[in.A] = nativeBoolToBooleanObject(!isTruthy(r[in.B]))
+		case OpJump:
+			f.pc = in.A
+		case OpJumpNotTruthy:
+			if !isTruthy(r[in.A]) {
+				f.pc = in.B
+			}
+		case OpJumpNotError:
+			if _, ok := r[in.A].(*object.ErrorValue); !ok {
+				f.pc = in.B
+			}
+		case OpGetGlobal:
+			if in.B >= len(m.globals) {
+				return fmt.Errorf("global %d read before it was set", in.B)
+			}
+			r[in.A] = m.globals[in.B]
+		case OpSetGlobal:
+			if in.A >= vm.GlobalsSize {
+				return fmt.Errorf("global %d out of range", in.A)
+			}
+			if in.A >= len(m.globals) {
+				m.globals = slices.Grow(m.globals, in.A+1-len(m.globals))[:in.A+1]
+			}
+			m.globals[in.A] = r[in.B]
+		case OpGetBuiltin:
+			r[in.A] = m.builtins[in.B].Builtin
+		case OpGetFree:
+			r[in.A] = f.cl.Free[in.B]
+		case OpCurrentClosure:
+			r[in.A] = f.cl
+		case OpArray:
+			if err := m.meter.Allocate(int64(in.C) + 1); err != nil {
+				return err
+			}
+
+			elements := make([]object.Object, in.C)
+			copy(elements, r[in.B:in.B+in.C])
+			r[in.A] = &object.Array{Elements: elements}
+		case OpHash:
+			if err := m.meter.Allocate(int64(in.C/2) + 1); err != nil {
+				return err
+			}
+
+			hash, err := buildHash(r[in.B : in.B+in.C])
+			if err != nil {
+				return err
+			}
+			r[in.A] = hash
+		case OpIndex:
+			result, err := index(r[in.B], r[in.C])
+			if err != nil {
+				return err
+			}
+			r[in.A] = result
+		case OpCall:
+			if err := m.call(f, in.A, in.B); err != nil {
+				return err
+			}
+		case OpClosure:
+			fn := m.program.Functions[in.B]
+			if fn == nil {
+				return fmt.Errorf("not a function: %+v", m.constants[in.B])
+			}
+
+			free := make([]object.Object, in.C)
+			copy(free, r[in.A:in.A+in.C])
+			r[in.A] = &Closure{Fn: fn, Free: free}
+		case OpReturnValue, OpReturn:
+			value := object.Object(object.NULL)
+			if in.Op == OpReturnValue {
+				value = r[in.A]
+			}
+
+			if m.framesIndex == 1 {
+				m.result = value
+				f.pc = len(instructions)
+				continue
+			}
+
+			m.popFrame()
+			m.registers[f.base-1] = value
+		case OpThrow:
+			return object.NewThrownValue(r[in.A])
+		case OpResult:
+			m.result = r[in.A]
+		default:
+			return fmt.Errorf("unknown opcode %s", in.Op)
+		}
+	}
+}
+
+// call runs the callee in register a of f with the n registers after it as
+// arguments. A closure gets a frame whose window starts at its first
+// argument, so the arguments become its first locals.
+func (m *VM) call(f *frame, a, n int) error {
+	callee := m.registers[f.base+a]
+
+	switch callee := callee.(type) {
+	case *Closure:
+		if n != callee.Fn.NumParameters {
+			return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Fn.NumParameters, n)
+		}
+		return m.pushFrame(callee, f.base+a+1)
+	case *object.Builtin:
+		args := m.registers[f.base+a+1 : f.base+a+1+n]
+		result := callee.Function(m.host, args...)
+
+		if errObj, ok := result.(*object.Error); ok {
+			return errors.New(errObj.Message)
+		}
+
+		if result == nil {
+			result = object.NULL
+		}
+
+		if array, ok := result.(*object.Array); ok {
+			if err := m.meter.Allocate(int64(len(array.Elements)) + 1); err != nil {
+				return err
+			}
+		}
+
+		m.registers[f.base+a] = result
+		return nil
+	default:
+		return fmt.Errorf("calling non-function: %s", callee.Type())
+	}
+}
+
+func (m *VM) pushFrame(cl *Closure, base int) error {
+	if m.framesIndex >= vm.MaxFrames {
+		return fmt.Errorf("%w: more than %d frames", object.ErrStackOverflow, vm.MaxFrames)
+	}
+
+	if need := base + cl.Fn.NumRegisters; need > len(m.registers) {
+		if need > MaxRegisters {
+			return fmt.Errorf("%w: more than %d registers", object.ErrStackOverflow, MaxRegisters)
+		}
+
+		registers := make([]object.Object, min(max(need, 2*len(m.registers)), MaxRegisters))
+		copy(registers, m.registers)
+		m.registers = registers
+	}
+
+	if err := m.meter.Enter(); err != nil {
+		return err
+	}
+
+	m.frames[m.framesIndex] = frame{cl: cl, base: base}
+	m.framesIndex++
+
+	return nil
+}
+
+func (m *VM) popFrame() {
+	m.framesIndex--
+	m.meter.Leave()
+}
+
+func (m *VM) binary(op Opcode, left, right object.Object) (object.Object, error) {
+	leftInt, leftOk := left.(*object.Integer)
+	rightInt, rightOk := right.(*object.Integer)
+
+	if leftOk && rightOk {
+		switch op {
+		case OpAdd:
+			return object.NewInteger(leftInt.Value + rightInt.Value), nil
+		case OpSub:
+			return object.NewInteger(leftInt.Value - rightInt.Value), nil
+		case OpMul:
+			return object.NewInteger(leftInt.Value * rightInt.Value), nil
+		default:
+			if rightInt.Value == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return object.NewInteger(leftInt.Value / rightInt.Value), nil
+		}
+	}
+
+	leftString, leftOk := left.(*object.String)
+	rightString, rightOk := right.(*object.String)
+
+	if leftOk && rightOk {
+		if op != OpAdd {
+			return nil, fmt.Errorf("unknown string operator: %d", stackOpcodes[op])
+		}
+
+		if err := m.meter.Allocate(1); err != nil {
+			return nil, err
+		}
+
+		return &object.String{Value: leftString.Value + rightString.Value}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported types for binary operation: %s %s", left.Type(), right.Type())
+}
+
+// stackOpcodes are the stack VM's opcodes for operators, so that both VMs
+// report errors the same way.
+var stackOpcodes = map[Opcode]code.Opcode{
+	OpAdd:         code.OpAdd,
+	OpSub:         code.OpSub,
+	OpMul:         code.OpMul,
+	OpDiv:         code.OpDiv,
+	OpEqual:       code.OpEqual,
+	OpNotEqual:    code.OpNotEqual,
+	OpGreaterThan: code.OpGreaterThan,
+}
+
+func compare(op Opcode, left, right object.Object) (object.Object, error) {
+	leftInt, leftOk := left.(*object.Integer)
+	rightInt, rightOk := right.(*object.Integer)
+
+	if leftOk && rightOk {
+		switch op {
+		case OpEqual:
+			return nativeBoolToBooleanObject(leftInt.Value == rightInt.Value), nil
+		case OpNotEqual:
+			return nativeBoolToBooleanObject(leftInt.Value != rightInt.Value), nil
+		default:
+			return nativeBoolToBooleanObject(leftInt.Value > rightInt.Value), nil
+		}
+	}
+
+	switch op {
+	case OpEqual:
+		return nativeBoolToBooleanObject(left == right), nil
+	case OpNotEqual:
+		return nativeBoolToBooleanObject(left != right), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %d (%s %s)", stackOpcodes[op], left.Type(), right.Type())
+	}
+}
+
+func index(left, index object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			break
+		}
+
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return object.NULL, nil
+		}
+		return left.Elements[i.Value], nil
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+
+		pair, ok := left.Pairs[key.HashKey()]
+		if !ok {
+			return object.NULL, nil
+		}
+		return pair.Value, nil
+	case *object.ErrorValue:
+		name, ok := index.(*object.String)
+		if !ok {
+			break
+		}
+
+		field, ok := left.Field(name.Value)
+		if !ok {
+			return nil, fmt.Errorf("unknown error field: %s", name.Value)
+		}
+		return field, nil
+	}
+
+	return nil, fmt.Errorf("index operator not supported: %s", left.Type())
+}
+
+func buildHash(registers []object.Object) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := 0; i < len(registers); i += 2 {
+		key, value := registers[i], registers[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return object.TRUE
+	}
+	return object.FALSE
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,252 @@
+package regvm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"llc/lang/ast"
+	"llc/lang/compiler"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+	"llc/lang/vm"
+)
+
+// TestMatchesStackVM runs programs on both VMs, with and without the
+// peephole pass, and expects the same results and errors.
+func TestMatchesStackVM(t *testing.T) {
+	tests := []string{
+		`1 + 2 * 3 - 4 / 2`,
+		`-5 + 10`,
+		`!true == false`,
+		`1 < 2 != (2 > 3)`,
+		`"foo" + "bar"`,
+		`if (1 > 2) { 10 }`,
+		`if (1 < 2) { 10 } else { 20 }`,
+		`let a = 1; let b = a + 1; a * b`,
+		`[1, 2 * 2, 3][1]`,
+		`{"a": 1, 2: true}[2]`,
+		`[][0]`,
+		`len("four") + len([1, 2])`,
+		`let add = fn(a, b) { a + b }; add(1, add(2, 3))`,
+		`let f = fn(a) { let b = a + 1; let c = b * 2; c - a }; f(3)`,
+		`let f = fn(x) { let y = x; let x = 2; [x, y] }; f(1)`,
+		`let f = fn(x) { [x, if (true) { let x = 9; x }] }; f(1)`,
+		`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`,
+		`let make = fn(x) { fn(y) { fn(z) { x + y + z } } }; make(1)(2)(3)`,
+		`let count = fn(n) { if (n == 0) { return 0; } count(n - 1) }; count(100)`,
+		`let f = fn() { }; f()`,
+		`let f = fn() { return 1; 2 }; f()`,
+		`return 5; 6`,
+		`try { throw "boom" } catch (e) { e["message"] }`,
+		`try { 1 + "a" } catch (e) { e["kind"] + ": " + e["message"] }`,
+		`let f = fn(n) { if (n == 0) { throw {"at": 0} } else { f(n - 1) } };` +
+			`try { f(3) } catch (e) { [e["data"]["at"], len(e["stack"])] }`,
+		`let log = []; let r = try { 1 } finally { let log = push(log, 2); }; [r, log]`,
+		`fn() { try { 1 } finally { return 2 } }()`,
+		`let f = fn(x) { if (x) { if (x) { let y = 1; } } }; [f(true), f(false)]`,
+		`fn(x) { try { x } finally { return x + 1 } }(1)`,
+		`fn() { try { throw 1 } catch (e) { 2 } finally { return 3 } }()`,
+		`1 + try { throw 1 } catch (e) { 41 }`,
+		`let e = 1; try { throw "x" } catch (e) { 0 }; e`,
+		`let f = fn() { let e = 1; try { throw "x" } catch (e) { 0 }; e }; f()`,
+		`let f = fn(x) { x + try { throw 1 } catch (e) { x } }; f(2)`,
+		`let f = fn() { let v = error("no")?; 1 }; f()`,
+		`let f = fn() { let v = 5?; v + 1 }; f()`,
+		`is_error(error("x", [1]))`,
+		`1 + true`,
+		`-"a"`,
+		`"a" - "b"`,
+		`true > false`,
+		`let z = 0; 1 / z`,
+		`try { 1 / 0 } catch (e) { e["message"] }`,
+		`1(2)`,
+		`fn(a) { a }()`,
+		`{[1]: 2}`,
+		`let f = fn() { 1 + "x" }; let g = fn() { f() }; g()`,
+	}
+
+	// Operands only an OpWide prefix can hold.
+	tests = append(tests,
+		join("%d", 70000, " + "),
+		"let f = fn(c) { if (c) { "+join("%d;", 20000, " ")+" 5 } else { 7 } }; [f(true), f(false)]",
+		"let f = fn("+join("p%d", 300, ", ")+") { p0 + p299 }; f("+join("%d", 300, ", ")+")",
+		"let f = fn() { "+join("let v%[1]d = %[1]d;", 300, " ")+" fn() { "+join("v%d", 300, " + ")+" } }; f()()",
+	)
+
+	for i, input := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			for _, peephole := range []bool{false, true} {
+				bytecode := compile(t, input, peephole)
+				want := runStack(bytecode)
+
+				if got := runRegister(t, bytecode); got != want {
+					t.Errorf("peephole=%t: results differ. got=%q, want=%q", peephole, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	program := lower(t, compile(t, `let f = fn(n) { f(n + 1) }; f(0)`, false))
+
+	host := &object.Host{Limits: object.Limits{MaxSteps: 100}}
+	err := NewWithHost(program, host).Run()
+	if !errors.Is(err, object.ErrLimitExceeded) {
+		t.Errorf("expected the step limit to stop the program. got=%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = New(program).RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation to stop the program. got=%v", err)
+	}
+
+	program = lower(t, compile(t, `try { let f = fn(n) { f(n + 1) }; f(0) } catch (e) { 1 }`, false))
+	err = NewWithHost(program, host).Run()
+	if !errors.Is(err, object.ErrLimitExceeded) {
+		t.Errorf("limits must not be catchable. got=%v", err)
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	input := "let f = fn() { 1 + \"x\" };\nlet g = fn() { f() };\ng()"
+	want := runStackError(t, compile(t, input, true))
+
+	var runtimeErr *vm.RuntimeError
+	err := New(lower(t, compile(t, input, true))).Run()
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a runtime error. got=%v", err)
+	}
+
+	if runtimeErr.StackTrace() != want.StackTrace() {
+		t.Errorf("wrong stack trace. got=%q, want=%q", runtimeErr.StackTrace(), want.StackTrace())
+	}
+
+	if runtimeErr.Position != want.Position || want.Position.String() != "1:18" {
+		t.Errorf("wrong position. got=%s, want=%s", runtimeErr.Position, want.Position)
+	}
+}
+
+func BenchmarkVMs(b *testing.B) {
+	programs := []struct {
+		name  string
+		input string
+	}{
+		{"fib(25)", "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(25)"},
+		{"locals", "let f = fn(n, acc) { if (n == 0) { acc } else { let a = acc + n; let b = a * 2 - a;" +
+			" f(n - 1, b) } }; f(300, 0)"},
+		{"array sum", "let sum = fn(arr, i, acc) { if (i == len(arr)) { acc } else { sum(arr, i + 1, acc + arr[i]) } };" +
+			" sum([1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20], 0, 0)"},
+	}
+
+	for _, program := range programs {
+		comp := compiler.New()
+		comp.SetPeephole(true)
+		if err := comp.Compile(parse(program.input)); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		b.Run(program.name+"/stack", func(b *testing.B) {
+			for b.Loop() {
+				if err := vm.New(bytecode).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+
+		b.Run(program.name+"/register", func(b *testing.B) {
+			lowered := lower(b, bytecode)
+
+			for b.Loop() {
+				if err := New(lowered).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// join formats format with each of 0..n-1 and joins the results with sep.
+func join(format string, n int, sep string) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = fmt.Sprintf(format, i)
+	}
+	return strings.Join(parts, sep)
+}
+
+func runStack(bytecode *compiler.Bytecode) string {
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		return "error: " + err.Error()
+	}
+	return inspect(machine.LastPoppedStackElem())
+}
+
+func runStackError(t *testing.T, bytecode *compiler.Bytecode) *vm.RuntimeError {
+	t.Helper()
+
+	var runtimeErr *vm.RuntimeError
+	if err := vm.New(bytecode).Run(); !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a runtime error. got=%v", err)
+	}
+	return runtimeErr
+}
+
+func runRegister(t *testing.T, bytecode *compiler.Bytecode) string {
+	t.Helper()
+
+	machine := New(lower(t, bytecode))
+	if err := machine.Run(); err != nil {
+		return "error: " + err.Error()
+	}
+	return inspect(machine.Result())
+}
+
+// inspect hides the addresses of function values.
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	if obj.Type() == object.ClosureObj {
+		return "closure"
+	}
+	return obj.Inspect()
+}
+
+func compile(t *testing.T, input string, peephole bool) *compiler.Bytecode {
+	t.Helper()
+
+	comp := compiler.New()
+	comp.SetPeephole(peephole)
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return comp.Bytecode()
+}
+
+func lower(tb testing.TB, bytecode *compiler.Bytecode) *Program {
+	tb.Helper()
+
+	program, err := Lower(bytecode)
+	if err != nil {
+		tb.Fatalf("lowering error: %s", err)
+	}
+
+	return program
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -1,12 +1,15 @@
 package repl
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"io"
 
+	"llc/lang/ast"
 	"llc/lang/compiler"
 	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/optimizer"
 	"llc/lang/parser"
 	"llc/lang/vm"
 )
@@ -14,16 +17,25 @@ import (
 const PROMPT = ">>>"
 
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	StartWithHost(&object.Host{Stdin: in, Stdout: out, Stderr: out}, optimizer.Default)
+}
+
+// StartWithHost runs the REPL over the host's streams. Lines are read through
+// the host so that `input()` calls share the same buffered input.
+func StartWithHost(host *object.Host, level optimizer.Level) {
+	out := host.Output()
+
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.New().SymbolTable()
 
 	for {
-		fmt.Printf("%s ", PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		_, _ = fmt.Fprintf(out, "%s ", PROMPT)
+		line, err := host.ReadLine()
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
 		l := lexer.New(line)
 		p := parser.New(l)
 
@@ -33,25 +45,58 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		comp := compiler.New()
-		err := comp.Compile(program)
+		comp := compiler.NewWithState(symbolTable, constants)
+		comp.SetPeephole(level >= optimizer.O1)
+		err = comp.Compile(optimizer.Optimize(program, level))
 		if err != nil {
 			_, _ = fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 			continue
 		}
 
-		machine := vm.New(comp.Bytecode())
+		code := comp.Bytecode()
+		constants = code.Constants
+
+		machine := vm.NewWithGlobalsStore(code, host, globals)
 		err = machine.Run()
 		if err != nil {
-			_, _ = fmt.Fprintf(out, "Woops! Execution bytecode failed:\n %s\n", err)
+			var runtimeErr *vm.RuntimeError
+			if errors.As(err, &runtimeErr) && runtimeErr.Position.Line != 0 {
+				_, _ = fmt.Fprintf(out, "Woops! Execution bytecode failed:\n %s: %s\n", runtimeErr.Position, err)
+			} else {
+				_, _ = fmt.Fprintf(out, "Woops! Execution bytecode failed:\n %s\n", err)
+			}
+
+			if runtimeErr != nil {
+				_, _ = io.WriteString(out, runtimeErr.StackTrace())
+			}
+			continue
+		}
+
+		if !endsWithExpression(program) {
+			continue
 		}
 
 		stackTop := machine.LastPoppedStackElem()
+		if stackTop == nil {
+			continue
+		}
+
 		_, _ = io.WriteString(out, stackTop.Inspect())
 		_, _ = io.WriteString(out, "\n")
 	}
 }
 
+// endsWithExpression reports whether the line produced a value worth echoing;
+// after a let statement the last popped element is just the bound value.
+func endsWithExpression(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+
+	_, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	for _, msg := range errors {
 		_, _ = io.WriteString(out, "\t"+msg+"\n")
@@ -0,0 +1,276 @@
+// Package scope resolves the names of a program with the scoping rules of
+// the evaluator: let bindings belong to the program or the function they are
+// in, and parameters to their function, macro or catch clause. Blocks of if
+// and try expressions do not open scopes.
+package scope
+
+import (
+	"sort"
+
+	"llc/lang/ast"
+	"llc/lang/token"
+)
+
+type Kind int
+
+const (
+	Variable Kind = iota
+	Function
+	Parameter
+)
+
+// Binding is a name introduced by a let statement, a function or macro
+// parameter, or a catch clause.
+type Binding struct {
+	Ident *ast.Identifier
+	Kind  Kind
+	// Let is the statement introducing a variable or function, nil for
+	// parameters.
+	Let   *ast.LetStatement
+	Scope *Scope
+	// Uses are the identifiers referring to the binding, in source order.
+	Uses []*ast.Identifier
+	// Shadows is the binding of an enclosing scope hidden by this one, if
+	// any.
+	Shadows *Binding
+}
+
+func (b *Binding) Name() string { return b.Ident.Value }
+
+// Scope is where the bindings of a program, a function or a catch clause are
+// visible. End is the zero Position for a scope that runs to the end of the
+// source.
+type Scope struct {
+	Parent     *Scope
+	Start, End token.Position
+	Bindings   map[string][]*Binding
+}
+
+func (s *Scope) Contains(pos token.Position) bool {
+	return !pos.Before(s.Start) && (s.End.Line == 0 || !s.End.Before(pos))
+}
+
+// Lookup returns the binding of name in s that code at pos refers to: the
+// last one declared before pos or, for code in a function called after the
+// binding is made, the first one. It returns nil if s has none.
+func (s *Scope) Lookup(name string, pos token.Position) *Binding {
+	candidates := s.Bindings[name]
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	found := candidates[0]
+	for _, b := range candidates {
+		if b.Ident.Token.Position().Before(pos) {
+			found = b
+		}
+	}
+	return found
+}
+
+// Occurrence is an identifier and the binding it refers to, nil for builtins
+// and undefined names.
+type Occurrence struct {
+	Ident   *ast.Identifier
+	Binding *Binding
+}
+
+// Info is the resolution of a program.
+type Info struct {
+	// Bindings are in source order.
+	Bindings []*Binding
+	// Occurrences are in source order.
+	Occurrences []Occurrence
+	// Scopes are in the order they open, so each comes after its parent; the
+	// first is the program's.
+	Scopes []*Scope
+
+	bindings map[*ast.Identifier]*Binding
+}
+
+// Resolve finds the binding of every identifier in program.
+func Resolve(program *ast.Program) *Info {
+	r := &resolver{info: &Info{bindings: make(map[*ast.Identifier]*Binding)}}
+	r.open(token.Position{Line: 1, Column: 1}, token.Position{})
+	r.walk(program)
+	r.resolve()
+
+	sort.SliceStable(r.info.Occurrences, func(i, j int) bool {
+		return r.info.Occurrences[i].Ident.Token.Position().Before(r.info.Occurrences[j].Ident.Token.Position())
+	})
+
+	return r.info
+}
+
+// OccurrenceAt returns the occurrence of an identifier covering pos.
+func (info *Info) OccurrenceAt(pos token.Position) (Occurrence, bool) {
+	for _, o := range info.Occurrences {
+		start := o.Ident.Token.Position()
+		if start.Line == pos.Line && start.Column <= pos.Column && pos.Column <= start.Column+len(o.Ident.Value) {
+			return o, true
+		}
+	}
+	return Occurrence{}, false
+}
+
+// BindingOf returns the binding ident declares or refers to, nil for
+// builtins and undefined names.
+func (info *Info) BindingOf(ident *ast.Identifier) *Binding {
+	return info.bindings[ident]
+}
+
+// Visible lists the bindings in scope at pos, innermost first and without
+// the ones they shadow.
+func (info *Info) Visible(pos token.Position) []*Binding {
+	innermost := info.Scopes[0]
+	for _, s := range info.Scopes {
+		if s.Contains(pos) {
+			innermost = s
+		}
+	}
+
+	var bindings []*Binding
+	seen := make(map[string]bool)
+	for s := innermost; s != nil; s = s.Parent {
+		names := make([]string, 0, len(s.Bindings))
+		for name := range s.Bindings {
+			if !seen[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			seen[name] = true
+			bindings = append(bindings, s.Lookup(name, pos))
+		}
+	}
+
+	return bindings
+}
+
+// use is an identifier waiting to be resolved once every binding of the
+// scopes around it is known.
+type use struct {
+	ident *ast.Identifier
+	scope *Scope
+}
+
+type resolver struct {
+	info  *Info
+	scope *Scope
+	uses  []use
+}
+
+func (r *resolver) walk(node ast.Node) {
+	ast.Walk(node, r.visit)
+}
+
+func (r *resolver) visit(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		r.let(node)
+		return false
+	case *ast.FunctionLiteral:
+		r.function(node.Token, node.Parameters, node.Body)
+		return false
+	case *ast.MacroLiteral:
+		r.function(node.Token, node.Parameters, node.Body)
+		return false
+	case *ast.TryExpression:
+		r.try(node)
+		return false
+	case *ast.Identifier:
+		r.uses = append(r.uses, use{ident: node, scope: r.scope})
+	}
+
+	return true
+}
+
+func (r *resolver) let(node *ast.LetStatement) {
+	if node.Name == nil {
+		r.walk(node.Value)
+		return
+	}
+
+	kind := Variable
+	if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+		kind = Function
+	}
+
+	b := r.declare(node.Name, kind)
+	b.Let = node
+	r.walk(node.Value)
+}
+
+func (r *resolver) function(tok token.Token, parameters []*ast.Identifier, body *ast.BlockStatement) {
+	r.open(tok.Position(), blockEnd(body))
+	for _, parameter := range parameters {
+		r.declare(parameter, Parameter)
+	}
+	r.walk(body)
+	r.close()
+}
+
+func (r *resolver) try(node *ast.TryExpression) {
+	r.walk(node.Block)
+
+	if node.Catch != nil {
+		r.open(node.Catch.Token.Position(), blockEnd(node.Catch))
+		if node.CatchParameter != nil {
+			r.declare(node.CatchParameter, Parameter)
+		}
+		r.walk(node.Catch)
+		r.close()
+	}
+
+	r.walk(node.Finally)
+}
+
+func (r *resolver) open(start, end token.Position) {
+	r.scope = &Scope{Parent: r.scope, Start: start, End: end, Bindings: make(map[string][]*Binding)}
+	r.info.Scopes = append(r.info.Scopes, r.scope)
+}
+
+func (r *resolver) close() {
+	r.scope = r.scope.Parent
+}
+
+func (r *resolver) declare(ident *ast.Identifier, kind Kind) *Binding {
+	b := &Binding{Ident: ident, Kind: kind, Scope: r.scope}
+	for s := r.scope.Parent; s != nil && b.Shadows == nil; s = s.Parent {
+		if candidates := s.Bindings[ident.Value]; len(candidates) != 0 {
+			b.Shadows = candidates[len(candidates)-1]
+		}
+	}
+
+	r.scope.Bindings[ident.Value] = append(r.scope.Bindings[ident.Value], b)
+	r.info.Bindings = append(r.info.Bindings, b)
+	r.info.Occurrences = append(r.info.Occurrences, Occurrence{Ident: ident, Binding: b})
+	r.info.bindings[ident] = b
+	return b
+}
+
+func (r *resolver) resolve() {
+	for _, u := range r.uses {
+		var b *Binding
+		for s := u.scope; s != nil && b == nil; s = s.Parent {
+			b = s.Lookup(u.ident.Value, u.ident.Token.Position())
+		}
+
+		if b != nil {
+			b.Uses = append(b.Uses, u.ident)
+			r.info.bindings[u.ident] = b
+		}
+		r.info.Occurrences = append(r.info.Occurrences, Occurrence{Ident: u.ident, Binding: b})
+	}
+}
+
+// blockEnd is the position of block's closing brace, or the zero Position
+// if it is missing.
+func blockEnd(block *ast.BlockStatement) token.Position {
+	if block == nil {
+		return token.Position{}
+	}
+	return block.RBrace.Position()
+}
@@ -0,0 +1,98 @@
+package scope
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"llc/lang/lexer"
+	"llc/lang/parser"
+	"llc/lang/token"
+)
+
+const source = `let x = 1;
+let f = fn(a) {
+  let y = a + x;
+  try { g(y) } catch (x) { x }
+};
+let g = fn(b) { len(b) };`
+
+func resolve(t *testing.T, source string) *Info {
+	t.Helper()
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return Resolve(program)
+}
+
+func TestResolve(t *testing.T) {
+	info := resolve(t, source)
+
+	var got []string
+	for _, o := range info.Occurrences {
+		entry := o.Ident.Value + "@" + o.Ident.Token.Position().String()
+		switch {
+		case o.Binding == nil:
+			entry += "->?"
+		case o.Binding.Ident == o.Ident:
+			entry += "="
+		default:
+			entry += "->" + o.Binding.Ident.Token.Position().String()
+		}
+		if info.BindingOf(o.Ident) != o.Binding {
+			t.Errorf("BindingOf(%s) disagrees with its occurrence", entry)
+		}
+		got = append(got, entry)
+	}
+
+	expected := "x@1:5= f@2:5= a@2:12= y@3:7= a@3:11->2:12 x@3:15->1:5 g@4:9->6:5 y@4:11->3:7 x@4:23= " +
+		"x@4:28->4:23 g@6:5= b@6:12= len@6:17->? b@6:21->6:12"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("wrong occurrences.\ngot= %s\nwant=%s", strings.Join(got, " "), expected)
+	}
+}
+
+func TestShadows(t *testing.T) {
+	info := resolve(t, source)
+
+	var got []string
+	for _, b := range info.Bindings {
+		if b.Shadows != nil {
+			got = append(got, fmt.Sprintf("%s@%s shadows %s", b.Name(), b.Ident.Token.Position(),
+				b.Shadows.Ident.Token.Position()))
+		}
+	}
+
+	if strings.Join(got, ", ") != "x@4:23 shadows 1:5" {
+		t.Errorf("wrong shadows: %v", got)
+	}
+}
+
+func TestVisible(t *testing.T) {
+	tests := []struct {
+		line, column int
+		expected     string
+	}{
+		{3, 3, "a y f g x"},
+		{4, 28, "x a y f g"},
+		{6, 17, "b f g x"},
+	}
+
+	info := resolve(t, source)
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			var names []string
+			for _, b := range info.Visible(token.Position{Line: tt.line, Column: tt.column}) {
+				names = append(names, b.Name())
+			}
+			if got := strings.Join(names, " "); got != tt.expected {
+				t.Errorf("wrong bindings. got=%q, want=%q", got, tt.expected)
+			}
+		})
+	}
+}
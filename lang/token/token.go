@@ -1,10 +1,33 @@
 package token
 
+import "fmt"
+
 type TypeTocken = string
 
 type Token struct {
 	Type    TypeTocken
 	Literal string
+	// Line and Column locate the token's first character, both starting at 1.
+	Line   int
+	Column int
+}
+
+func (t Token) Position() Position {
+	return Position{Line: t.Line, Column: t.Column}
+}
+
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Before reports whether p comes before q in the source.
+func (p Position) Before(q Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -16,6 +39,9 @@ const (
 	Int    = "INT"    // 1343456
 	String = "STRING" // "<unicode symbols>"
 
+	// Comments are kept by the lexer rather than passed to the parser.
+	Comment = "COMMENT" // from // to the end of the line
+
 	// Operators.
 	Assign   = "="
 	Plus     = "+"
@@ -25,9 +51,12 @@ const (
 	Slash    = "/"
 	LT       = "<"
 	GT       = ">"
+	Question = "?"
+	Arrow    = "->"
 
 	// Delimiters.
 	Comma     = ","
+	Dot       = "."
 	Semicolon = ";"
 	Colon     = ":"
 	LParen    = "("
@@ -46,20 +75,28 @@ const (
 	Else     = "ELSE"
 	Return   = "RETURN"
 	Macro    = "MACRO"
+	Try      = "TRY"
+	Catch    = "CATCH"
+	Finally  = "FINALLY"
+	Throw    = "THROW"
 
 	Eq    = "=="
 	NotEq = "!="
 )
 
 var keywords = map[string]TypeTocken{
-	"fn":     Function,
-	"let":    Let,
-	"true":   True,
-	"false":  False,
-	"if":     If,
-	"else":   Else,
-	"return": Return,
-	"macro":  Macro,
+	"fn":      Function,
+	"let":     Let,
+	"true":    True,
+	"false":   False,
+	"if":      If,
+	"else":    Else,
+	"return":  Return,
+	"try":     Try,
+	"catch":   Catch,
+	"finally": Finally,
+	"throw":   Throw,
+	"macro":   Macro,
 }
 
 func LookupIndent(indent string) TypeTocken {
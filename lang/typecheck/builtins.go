@@ -0,0 +1,53 @@
+package typecheck
+
+// builtin is the type of a builtin. Its parameters are the types of the
+// arguments it takes, as many as builtins.Docs says it accepts at most; the
+// arguments of variadic builtins are not checked. result gives the type of a
+// call from the types of its arguments.
+type builtin struct {
+	parameters []Type
+	result     func(args []Type) Type
+}
+
+func returns(t Type) func([]Type) Type {
+	return func([]Type) Type { return t }
+}
+
+// element is the element type of an array type, any for other types.
+func element(t Type) Type {
+	if a, ok := t.(Array); ok {
+		return a.Element
+	}
+	return Any
+}
+
+var builtinTypes = map[string]builtin{
+	"len":   {[]Type{sized}, returns(Int)},
+	"first": {[]Type{Array{Any}}, func(args []Type) Type { return element(args[0]) }},
+	"last":  {[]Type{Array{Any}}, func(args []Type) Type { return element(args[0]) }},
+	"rest": {[]Type{Array{Any}}, func(args []Type) Type {
+		if _, ok := args[0].(Array); ok {
+			return args[0]
+		}
+		return Array{Any}
+	}},
+	"push": {[]Type{Array{Any}, Any}, func(args []Type) Type {
+		if _, ok := args[0].(Array); ok {
+			return Array{join(element(args[0]), args[1])}
+		}
+		return Array{Any}
+	}},
+	"print":          {nil, returns(Null)},
+	"eprint":         {nil, returns(Null)},
+	"input":          {[]Type{String}, returns(Any)},
+	"json_parse":     {[]Type{String}, returns(Any)},
+	"json_stringify": {[]Type{Any, Any}, returns(String)},
+	"read_file":      {[]Type{String}, returns(String)},
+	"write_file":     {[]Type{String, String}, returns(Any)},
+	"list_dir":       {[]Type{String}, returns(Array{String})},
+	"getenv":         {[]Type{String}, returns(Any)},
+	"args":           {nil, returns(Array{String})},
+	"exit":           {[]Type{Int}, returns(Null)},
+	"error":          {[]Type{String, Any}, returns(Any)},
+	"is_error":       {[]Type{Any}, returns(Bool)},
+}
@@ -0,0 +1,437 @@
+// Package typecheck checks the optional type annotations of llc programs.
+// It is gradual: what is not annotated is inferred from literals, builtins
+// and the annotations that are there, or else has type any, which is never
+// an error. Anything it reports would fail at runtime if the code ran.
+package typecheck
+
+import (
+	"fmt"
+	"sort"
+
+	"llc/lang/ast"
+	"llc/lang/builtins"
+	"llc/lang/lexer"
+	"llc/lang/parser"
+	"llc/lang/scope"
+	"llc/lang/token"
+)
+
+// Error is a type error.
+type Error struct {
+	Position token.Position
+	Message  string
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%s: %s", e.Position, e.Message)
+}
+
+// Check returns the type errors of source in source order. Source with
+// syntax errors cannot be checked and yields the first of them.
+func Check(source string) ([]Error, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) != 0 {
+		return nil, fmt.Errorf("%s: %s", errs[0].Position, errs[0].Message)
+	}
+
+	c := &checker{
+		info:        scope.Resolve(program),
+		types:       make(map[*scope.Binding]Type),
+		annotations: make(map[*ast.Type]Type),
+	}
+	c.block(program.Statements)
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].Position.Before(c.errors[j].Position)
+	})
+	return c.errors, nil
+}
+
+type checker struct {
+	info        *scope.Info
+	types       map[*scope.Binding]Type
+	annotations map[*ast.Type]Type
+	errors      []Error
+	// fn is the function whose body is being checked, nil at the top level.
+	fn *function
+}
+
+type function struct {
+	// result is the annotated result type, nil if it is to be inferred from
+	// returns.
+	result  Type
+	returns []Type
+}
+
+func (c *checker) errorf(pos token.Position, format string, a ...interface{}) {
+	c.errors = append(c.errors, Error{Position: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+// block returns the type of the value of statements, nil if they never
+// complete because they end in a return or a throw.
+func (c *checker) block(statements []ast.Statement) Type {
+	var t Type = Null
+	for _, s := range statements {
+		t = c.statement(s)
+	}
+	return t
+}
+
+func (c *checker) statement(s ast.Statement) Type {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		c.let(s)
+	case *ast.ReturnStatement:
+		t := c.value(s.ReturnValue)
+		if c.fn == nil {
+			return nil
+		}
+		if c.fn.result == nil {
+			c.fn.returns = append(c.fn.returns, t)
+		} else if !assignable(t, c.fn.result) {
+			c.errorf(ast.Pos(s.ReturnValue), "cannot return %s from a function returning %s", t, c.fn.result)
+		}
+		return nil
+	case *ast.ThrowStatement:
+		c.value(s.Value)
+		return nil
+	case *ast.ExpressionStatement:
+		return c.expression(s.Expression)
+	}
+	return Any
+}
+
+func (c *checker) let(s *ast.LetStatement) {
+	b := c.info.BindingOf(s.Name)
+
+	// A function gets its signature before its body is checked, for the
+	// body to call it.
+	if fn, ok := s.Value.(*ast.FunctionLiteral); ok && b != nil {
+		c.types[b] = c.signature(fn)
+	}
+
+	t := c.value(s.Value)
+	if s.Type != nil {
+		declared := c.annotation(s.Type)
+		if !assignable(t, declared) {
+			c.errorf(ast.Pos(s.Value), "cannot use %s as %s in let %s", t, declared, s.Name.Value)
+		}
+		t = declared
+	}
+
+	if b != nil {
+		c.types[b] = t
+	}
+}
+
+// value returns the type of e, any if it never completes.
+func (c *checker) value(e ast.Expression) Type {
+	if t := c.expression(e); t != nil {
+		return t
+	}
+	return Any
+}
+
+//nolint:cyclop
+func (c *checker) expression(e ast.Expression) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	case *ast.Identifier:
+		if t, ok := c.types[c.info.BindingOf(e)]; ok {
+			return t
+		}
+	case *ast.PrefixExpression:
+		return c.prefix(e)
+	case *ast.InfixExpression:
+		return c.infix(e)
+	case *ast.IfExpression:
+		c.value(e.Condition)
+		alternative := Type(Null)
+		if e.Alternative != nil {
+			alternative = c.block(e.Alternative.Statements)
+		}
+		return join(c.block(e.Consequence.Statements), alternative)
+	case *ast.TryExpression:
+		return c.try(e)
+	case *ast.FunctionLiteral:
+		return c.function(e)
+	case *ast.CallExpression:
+		return c.call(e)
+	case *ast.ArrayLiteral:
+		if len(e.Elements) == 0 {
+			return Array{Any}
+		}
+		elements := make([]Type, len(e.Elements))
+		for i, element := range e.Elements {
+			elements[i] = c.value(element)
+		}
+		return Array{join(elements...)}
+	case *ast.HashLiteral:
+		return c.hash(e)
+	case *ast.IndexExpression:
+		return c.index(e)
+	case *ast.PropagateExpression:
+		return c.value(e.Value)
+	}
+	return Any
+}
+
+func (c *checker) prefix(e *ast.PrefixExpression) Type {
+	t := c.value(e.Right)
+	if e.Operator == "!" {
+		return Bool
+	}
+	if !assignable(t, Int) {
+		c.errorf(ast.Pos(e), "unknown operator: %s%s", e.Operator, t)
+	}
+	return Int
+}
+
+// infix follows the evaluator: integers take every operator, strings only +,
+// and values of different types only == and !=.
+func (c *checker) infix(e *ast.InfixExpression) Type {
+	left, right := c.value(e.Left), c.value(e.Right)
+
+	var result Type
+	switch e.Operator {
+	case "+":
+		result = join(left, right)
+		if result != Int && result != String {
+			result = Any
+		}
+	case "-", "*", "/":
+		result = Int
+	case "<", ">", "==", "!=":
+		result = Bool
+	}
+
+	if left == Any || right == Any {
+		return result
+	}
+
+	switch {
+	case left == Int && right == Int, left == String && right == String && e.Operator == "+":
+	case kind(left) != kind(right):
+		if e.Operator != "==" && e.Operator != "!=" {
+			c.errorf(ast.Pos(e), "type mismatch: %s %s %s", left, e.Operator, right)
+		}
+	case left == String || e.Operator != "==" && e.Operator != "!=":
+		c.errorf(ast.Pos(e), "unknown operator: %s %s %s", left, e.Operator, right)
+	}
+	return result
+}
+
+func (c *checker) try(e *ast.TryExpression) Type {
+	t := c.block(e.Block.Statements)
+	if e.Catch != nil {
+		if b := c.info.BindingOf(e.CatchParameter); b != nil {
+			c.types[b] = Hash{String, Any}
+		}
+		t = join(t, c.block(e.Catch.Statements))
+	}
+	if e.Finally != nil {
+		c.block(e.Finally.Statements)
+	}
+	return t
+}
+
+func (c *checker) function(e *ast.FunctionLiteral) Type {
+	signature := c.signature(e)
+	for i, param := range e.Parameters {
+		if b := c.info.BindingOf(param); b != nil {
+			c.types[b] = signature.Parameters[i]
+		}
+	}
+
+	outer := c.fn
+	c.fn = &function{}
+	if e.ReturnType != nil {
+		c.fn.result = signature.Result
+	}
+
+	body := c.block(e.Body.Statements)
+	switch {
+	case c.fn.result != nil:
+		if body != nil && !assignable(body, c.fn.result) {
+			pos := ast.Pos(e.Body)
+			if n := len(e.Body.Statements); n != 0 {
+				pos = ast.Pos(e.Body.Statements[n-1])
+			}
+			c.errorf(pos, "cannot return %s from a function returning %s", body, c.fn.result)
+		}
+	case body != nil || len(c.fn.returns) != 0:
+		signature.Result = join(append(c.fn.returns, body)...)
+	}
+
+	c.fn = outer
+	return signature
+}
+
+// signature returns the annotated type of a function literal, with any for
+// what is not annotated.
+func (c *checker) signature(e *ast.FunctionLiteral) Function {
+	signature := Function{Parameters: make([]Type, len(e.Parameters)), Result: Any}
+	for i := range e.Parameters {
+		signature.Parameters[i] = Any
+		if e.ParameterTypes != nil && e.ParameterTypes[i] != nil {
+			signature.Parameters[i] = c.annotation(e.ParameterTypes[i])
+		}
+	}
+	if e.ReturnType != nil {
+		signature.Result = c.annotation(e.ReturnType)
+	}
+	return signature
+}
+
+func (c *checker) call(e *ast.CallExpression) Type {
+	args := make([]Type, len(e.Arguments))
+	for i, arg := range e.Arguments {
+		args[i] = c.value(arg)
+	}
+
+	if ident, ok := e.Function.(*ast.Identifier); ok && c.info.BindingOf(ident) == nil {
+		return c.builtin(ident, e.Arguments, args)
+	}
+
+	switch f := c.value(e.Function).(type) {
+	case Function:
+		if len(args) != len(f.Parameters) {
+			c.errorf(ast.Pos(e.Function), "wrong number of arguments to %s: want=%d, got=%d",
+				e.Function, len(f.Parameters), len(args))
+			return f.Result
+		}
+		c.arguments(e.Function.String(), e.Arguments, args, f.Parameters)
+		return f.Result
+	case basic:
+		if f != Any {
+			c.errorf(ast.Pos(e.Function), "not a function: %s", f)
+		}
+	default:
+		c.errorf(ast.Pos(e), "not a function: %s", f)
+	}
+	return Any
+}
+
+// builtin checks a call to a builtin, or to an undefined name, which is left
+// to the runtime.
+func (c *checker) builtin(ident *ast.Identifier, exprs []ast.Expression, args []Type) Type {
+	b, ok := builtinTypes[ident.Value]
+	if !ok {
+		return Any
+	}
+
+	minArgs, maxArgs := builtins.Docs[ident.Value].Arity()
+	if len(args) < minArgs || maxArgs >= 0 && len(args) > maxArgs {
+		want := fmt.Sprint(minArgs)
+		switch {
+		case maxArgs < 0:
+			want = "at least " + want
+		case minArgs+1 == maxArgs:
+			want += fmt.Sprintf(" or %d", maxArgs)
+		case minArgs != maxArgs:
+			want += fmt.Sprintf(" to %d", maxArgs)
+		}
+		c.errorf(ident.Token.Position(), "wrong number of arguments to %s: want=%s, got=%d", ident.Value, want, len(args))
+		return Any
+	}
+
+	if maxArgs >= 0 {
+		c.arguments(ident.Value, exprs[:len(args)], args, b.parameters[:len(args)])
+	}
+	return b.result(args)
+}
+
+func (c *checker) arguments(name string, exprs []ast.Expression, args, parameters []Type) {
+	for i, arg := range args {
+		if !assignable(arg, parameters[i]) {
+			c.errorf(ast.Pos(exprs[i]), "cannot use %s as %s in argument %d to %s", arg, parameters[i], i+1, name)
+		}
+	}
+}
+
+func (c *checker) hash(e *ast.HashLiteral) Type {
+	if len(e.Pairs) == 0 {
+		return Hash{Any, Any}
+	}
+
+	var keys, values []Type
+	for key, value := range e.Pairs {
+		t := c.value(key)
+		if !hashable(t) {
+			c.errorf(ast.Pos(key), "unusable as hash key: %s", t)
+		}
+		keys = append(keys, t)
+		values = append(values, c.value(value))
+	}
+	return Hash{join(keys...), join(values...)}
+}
+
+func (c *checker) index(e *ast.IndexExpression) Type {
+	left, index := c.value(e.Left), c.value(e.Index)
+
+	switch left := left.(type) {
+	case Array:
+		if !assignable(index, Int) {
+			c.errorf(ast.Pos(e.Index), "cannot index %s with %s", left, index)
+		}
+		return left.Element
+	case Hash:
+		if !hashable(index) {
+			c.errorf(ast.Pos(e.Index), "unusable as hash key: %s", index)
+		}
+		return left.Value
+	case basic:
+		if left == Any {
+			return Any
+		}
+	}
+
+	c.errorf(ast.Pos(e), "index operator not supported: %s", left)
+	return Any
+}
+
+// annotation returns the type an annotation denotes, reporting unknown
+// names once however often it is asked for.
+func (c *checker) annotation(a *ast.Type) Type {
+	if t, ok := c.annotations[a]; ok {
+		return t
+	}
+
+	var t Type
+	switch a.Token.Type {
+	case token.LBracket:
+		t = Array{c.annotation(a.Element)}
+	case token.LBrace:
+		key := c.annotation(a.Key)
+		if !hashable(key) {
+			c.errorf(a.Key.Token.Position(), "unusable as hash key: %s", key)
+		}
+		t = Hash{key, c.annotation(a.Value)}
+	case token.Function:
+		f := Function{Parameters: make([]Type, len(a.Parameters)), Result: Any}
+		for i, p := range a.Parameters {
+			f.Parameters[i] = c.annotation(p)
+		}
+		if a.Result != nil {
+			f.Result = c.annotation(a.Result)
+		}
+		t = f
+	default:
+		switch basic(a.Token.Literal) {
+		case Int, String, Bool, Null, Any:
+			t = basic(a.Token.Literal)
+		default:
+			c.errorf(a.Token.Position(), "unknown type %s", a.Token.Literal)
+			t = Any
+		}
+	}
+
+	c.annotations[a] = t
+	return t
+}
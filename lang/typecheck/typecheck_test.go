@@ -0,0 +1,155 @@
+package typecheck
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let x: int = 1; let y: string = "a"; let z: bool = x < 2; let n: null = print(x);`, nil},
+		{`let x: string = 1; let y: [int] = [1, "a"]; let z: {string: int} = {"a": 1, "b": 2};`, []string{
+			"1:17: cannot use int as string in let x",
+		}},
+		{`let xs: [int] = ["a"]; let h: {int: string} = {"a": "b"};`, []string{
+			"1:17: cannot use [string] as [int] in let xs",
+			"1:47: cannot use {string: string} as {int: string} in let h",
+		}},
+		{`let x = 1; let y: string = x; let f = fn(a) { a }; let z: string = f(1);`, []string{
+			"1:28: cannot use int as string in let y",
+		}},
+		{`let x: foo = 1; let f = fn(a: [bar]) -> {[int]: int} { a };`, []string{
+			"1:8: unknown type foo",
+			"1:32: unknown type bar",
+			"1:42: unusable as hash key: [int]",
+			"1:56: cannot return [any] from a function returning {[int]: int}",
+		}},
+		{`let add = fn(a: int, b: int) -> int { a + b }; add(1, "2"); add(1); let s: string = add(1, 2);`, []string{
+			"1:55: cannot use string as int in argument 2 to add",
+			"1:61: wrong number of arguments to add: want=2, got=1",
+			"1:88: cannot use int as string in let s",
+		}},
+		{`let f = fn(a: int) -> string { if (a > 0) { return "+"; } a };`, []string{
+			"1:59: cannot return int from a function returning string",
+		}},
+		{`let f = fn(a: int) -> int { if (a > 0) { return "+"; } throw "no" };`, []string{
+			"1:49: cannot return string from a function returning int",
+		}},
+		{`let f = fn(a: int) { if (a > 0) { return a; } 0 }; let s: string = f(1);`, []string{
+			"1:69: cannot use int as string in let s",
+		}},
+		{`let f = fn(a) { if (a) { return 1; } "a" }; let s: string = f(1);`, nil},
+		{`let fact = fn(n: int) -> int { if (n < 2) { return 1; } n * fact(n - 1) }; fact(true);`, []string{
+			"1:81: cannot use bool as int in argument 1 to fact",
+		}},
+		{
+			`let apply = fn(f: fn(int) -> int, x: int) { f(x) }; apply(fn(x: string) { 1 }, 1); apply(fn(x) { x }, 1);`,
+			[]string{"1:59: cannot use fn(string) -> int as fn(int) -> int in argument 1 to apply"},
+		},
+		{`1 + "a"; "a" - "b"; "a" == "b"; 1 == "a"; true + false; -true; !1; [1] + [2]; 1 < 2 == true;`, []string{
+			"1:3: type mismatch: int + string",
+			"1:14: unknown operator: string - string",
+			"1:25: unknown operator: string == string",
+			"1:48: unknown operator: bool + bool",
+			"1:57: unknown operator: -bool",
+			"1:72: unknown operator: [int] + [int]",
+		}},
+		{`let f = fn(a) { a + 1; a - "b"; a < true }; let s: string = 1 + 2;`, []string{
+			"1:63: cannot use int as string in let s",
+		}},
+		{`let xs = [1, 2]; xs["a"]; let h = {"a": 1}; h[[1]]; 1[0]; "abc"[0]; let s: string = xs[0] + h["a"];`, []string{
+			"1:21: cannot index [int] with string",
+			"1:47: unusable as hash key: [int]",
+			"1:54: index operator not supported: int",
+			"1:64: index operator not supported: string",
+			"1:91: cannot use int as string in let s",
+		}},
+		{`{[1]: 2, fn() { 1 }: 3}; 1(); let f = 1; f(2); let g = fn() { 1 }; g()();`, []string{
+			"1:2: unusable as hash key: [int]",
+			"1:10: unusable as hash key: fn() -> int",
+			"1:26: not a function: int",
+			"1:42: not a function: int",
+			"1:69: not a function: int",
+		}},
+		{`len(1); len("a", "b"); len([1]); push([1], "a"); let x: [int] = push([1], 2); first("a");`, []string{
+			"1:5: cannot use int as string or array in argument 1 to len",
+			"1:9: wrong number of arguments to len: want=1, got=2",
+			"1:85: cannot use string as [any] in argument 1 to first",
+		}},
+		{
+			`let n: int = first([1]); let s: string = last(["a"]); let xs: [string] = rest([1]); error(1); print(1);`,
+			[]string{"1:78: cannot use [int] as [string] in let xs", "1:91: cannot use int as string in argument 1 to error"},
+		},
+		{`let x: [string] = list_dir("."); let y: int = json_parse("1"); exit("1"); input(); error(); args(1);`, []string{
+			"1:69: cannot use string as int in argument 1 to exit",
+			"1:84: wrong number of arguments to error: want=1 or 2, got=0",
+			"1:93: wrong number of arguments to args: want=0, got=1",
+		}},
+		{`let r = try { 1 } catch (e) { e["message"] }; let s: string = r; let t: int = try { 1 } finally { "a" };`, nil},
+		{`let f = fn(len: int) { len("a") }; let len = 1; len + 1;`, []string{
+			"1:24: not a function: int",
+		}},
+		{`let m = macro(a) { quote(unquote(a) + "a") }; m(1); undefined(1) + 1;`, nil},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			errs, err := Check(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("wrong errors.\ngot=\n%s\nwant=\n%s", strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+			}
+		})
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	_, err := Check("let x: = 1;")
+	if err == nil || err.Error() != "1:8: expected a type, got =" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+// TestSources checks that the examples and the standard library, which have
+// no annotations, are free of type errors.
+func TestSources(t *testing.T) {
+	paths, err := filepath.Glob("../../examples/*.llc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	std, err := filepath.Glob("../../std/*.llc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range append(paths, std...) {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errs, err := Check(string(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(errs) != 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package typecheck
+
+import "strings"
+
+// Type is the static type of a value.
+type Type interface {
+	String() string
+}
+
+type basic string
+
+func (b basic) String() string { return string(b) }
+
+const (
+	Int    basic = "int"
+	String basic = "string"
+	Bool   basic = "bool"
+	Null   basic = "null"
+	// Any is the type of values nothing is known about. It is compatible
+	// with every type both ways, which is what makes annotations optional.
+	Any basic = "any"
+
+	// sized accepts strings and arrays, for len.
+	sized basic = "string or array"
+)
+
+type Array struct {
+	Element Type
+}
+
+func (a Array) String() string { return "[" + a.Element.String() + "]" }
+
+type Hash struct {
+	Key, Value Type
+}
+
+func (h Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+type Function struct {
+	Parameters []Type
+	Result     Type
+}
+
+func (f Function) String() string {
+	params := make([]string, len(f.Parameters))
+	for i, p := range f.Parameters {
+		params[i] = p.String()
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Result.String()
+}
+
+// assignable reports whether a value of type from may be used where one of
+// type to is expected. Arrays and hashes are covariant, and functions
+// contravariant in their parameters.
+func assignable(from, to Type) bool {
+	if from == Any || to == Any {
+		return true
+	}
+
+	switch to := to.(type) {
+	case basic:
+		if to == sized {
+			_, isArray := from.(Array)
+			return from == String || isArray
+		}
+		return from == to
+	case Array:
+		from, ok := from.(Array)
+		return ok && assignable(from.Element, to.Element)
+	case Hash:
+		from, ok := from.(Hash)
+		return ok && assignable(from.Key, to.Key) && assignable(from.Value, to.Value)
+	case Function:
+		from, ok := from.(Function)
+		if !ok || len(from.Parameters) != len(to.Parameters) {
+			return false
+		}
+		for i := range to.Parameters {
+			if !assignable(to.Parameters[i], from.Parameters[i]) {
+				return false
+			}
+		}
+		return assignable(from.Result, to.Result)
+	}
+
+	return false
+}
+
+// join is the type of a value that is either of the given types, any if
+// they differ. A nil Type, for code that never completes, joins as the other
+// type.
+func join(types ...Type) Type {
+	var joined Type
+	for _, t := range types {
+		switch {
+		case t == nil:
+		case joined == nil:
+			joined = t
+		case joined.String() != t.String():
+			return Any
+		}
+	}
+	return joined
+}
+
+// kind is what the evaluator sees of a type: arrays, hashes and functions
+// of different element, key, value or parameter types are alike to it.
+func kind(t Type) string {
+	switch t.(type) {
+	case Array:
+		return "array"
+	case Hash:
+		return "hash"
+	case Function:
+		return "fn"
+	}
+	return t.String()
+}
+
+// hashable reports whether values of type t may be hash keys.
+func hashable(t Type) bool {
+	switch t {
+	case Int, String, Bool, Any:
+		return true
+	}
+	return false
+}
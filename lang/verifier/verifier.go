@@ -0,0 +1,291 @@
+// Package verifier checks compiled bytecode before it runs. The VMs trust
+// their input for speed, so malformed bytecode, whether hand-written,
+// corrupted or produced by a buggy pass, must be rejected up front instead
+// of panicking the host halfway through a program.
+package verifier
+
+import (
+	"errors"
+	"fmt"
+
+	"llc/lang/builtins"
+	"llc/lang/code"
+	"llc/lang/compiler"
+	"llc/lang/object"
+)
+
+var ErrInvalid = errors.New("invalid bytecode")
+
+// GlobalsSize is how many globals the VMs hold. Verified bytecode only
+// refers to globals below it.
+const GlobalsSize = 65536
+
+// Verify checks that bytecode only holds known opcodes with complete
+// operands that stay within the constant pool, builtins, globals, locals,
+// free variables and instruction stream they refer to, and that every function
+// keeps its operand stack balanced: no instruction pops more values than
+// there are, all paths reaching an instruction agree on the stack depth and
+// no function runs past its last instruction. Main may not use OpReturn.
+// Bytecode without a builtins list is checked against the core builtins, as
+// the VM runs it. Errors wrap ErrInvalid.
+func Verify(bc *compiler.Bytecode) error {
+	v := &verifier{bytecode: bc, builtins: len(bc.Builtins)}
+	if bc.Builtins == nil {
+		v.builtins = len(builtins.Definitions)
+	}
+
+	err := v.function("main", &object.CompiledFunction{
+		Instructions: bc.Instructions,
+		Handlers:     bc.Handlers,
+	}, true)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	for i, constant := range bc.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			if err := v.function(fmt.Sprintf("constant %d", i), fn, false); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalid, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+type verifier struct {
+	bytecode *compiler.Bytecode
+	builtins int
+}
+
+type instruction struct {
+	offset   int
+	width    int
+	name     string
+	op       code.Opcode
+	operands []int
+}
+
+func (v *verifier) function(name string, fn *object.CompiledFunction, main bool) error {
+	if fn.NumParameters > fn.NumLocals {
+		return fmt.Errorf("%s: %d parameters but only %d locals", name, fn.NumParameters, fn.NumLocals)
+	}
+
+	list, starts, err := decode(name, fn)
+	if err != nil {
+		return err
+	}
+
+	for _, in := range list {
+		if err := v.operands(fn, in.op, in.operands); err != nil {
+			return fmt.Errorf("%s: offset %d: %s: %w", name, in.offset, in.name, err)
+		}
+		// Main has no caller to return null to; it ends with OpReturnValue.
+		if main && in.op == code.OpReturn {
+			return fmt.Errorf("%s: offset %d: OpReturn outside a function", name, in.offset)
+		}
+	}
+
+	_, err = depths(name, fn, list, starts, main)
+	return err
+}
+
+// Depths returns the operand stack depth before each instruction of fn that
+// can run, by offset. For main, the end of the instructions is included
+// when it can be reached. fn is expected to have passed Verify.
+func Depths(fn *object.CompiledFunction, main bool) (map[int]int, error) {
+	list, starts, err := decode("function", fn)
+	if err != nil {
+		return nil, err
+	}
+	return depths("function", fn, list, starts, main)
+}
+
+// decode splits fn into instructions and checks that jumps and handlers
+// land on instruction boundaries. starts maps each boundary to its index in
+// the list.
+func decode(name string, fn *object.CompiledFunction) ([]instruction, map[int]int, error) {
+	ins := fn.Instructions
+	starts := make(map[int]int)
+	var list []instruction
+
+	for i := 0; i < len(ins); {
+		def, operands, width, err := ins.Decode(i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: offset %d: %w", name, i, err)
+		}
+
+		starts[i] = len(list)
+		list = append(list, instruction{offset: i, width: width, name: def.Name, op: ins.Opcode(i), operands: operands})
+		i += width
+	}
+	starts[len(ins)] = len(list)
+
+	for _, in := range list {
+		if isJump(in.op) {
+			if _, ok := starts[in.operands[0]]; !ok {
+				return nil, nil, fmt.Errorf("%s: jump to %d is not an instruction boundary", name, in.operands[0])
+			}
+		}
+	}
+
+	for _, h := range fn.Handlers {
+		_, start := starts[h.Start]
+		_, end := starts[h.End]
+		_, target := starts[h.Target]
+		if h.Start > h.End || !start || !end || !target || h.Target == len(ins) {
+			return nil, nil, fmt.Errorf("%s: handler %d-%d -> %d out of range", name, h.Start, h.End, h.Target)
+		}
+	}
+
+	return list, starts, nil
+}
+
+// depths follows every path through the function from its entry and from
+// the handlers guarding reachable instructions, tracking the operand stack
+// depth, and returns the depth at each offset it reaches. Unreachable code
+// is not checked; the compiler leaves some behind returns.
+func depths(
+	name string, fn *object.CompiledFunction, list []instruction, starts map[int]int, main bool,
+) (map[int]int, error) {
+	depth := make([]int, len(list)+1)
+	seen := make([]bool, len(list)+1)
+	var work []int
+
+	reach := func(from, offset, d int) error {
+		i := starts[offset]
+		if i == len(list) && !main {
+			return fmt.Errorf("%s: offset %d: runs past the end of the function", name, from)
+		}
+		if seen[i] {
+			if depth[i] != d {
+				return fmt.Errorf("%s: offset %d: stack depth %d, want %d", name, offset, d, depth[i])
+			}
+			return nil
+		}
+		seen[i], depth[i] = true, d
+		work = append(work, i)
+		return nil
+	}
+
+	if err := reach(0, 0, 0); err != nil {
+		return nil, err
+	}
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i == len(list) {
+			continue
+		}
+
+		in, d := list[i], depth[i]
+
+		if pops := inputs(in.op, in.operands); d < pops {
+			return nil, fmt.Errorf("%s: offset %d: %s: stack has %d values, needs %d", name, in.offset, in.name, d, pops)
+		}
+
+		for _, h := range fn.Handlers {
+			if in.offset < h.Start || in.offset >= h.End {
+				continue
+			}
+			if d < h.Depth {
+				return nil, fmt.Errorf("%s: offset %d: stack depth %d below handler depth %d", name, in.offset, d, h.Depth)
+			}
+			if err := reach(in.offset, h.Target, h.Depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		after := d + code.StackEffect(in.op, in.operands...)
+
+		if isJump(in.op) {
+			if err := reach(in.offset, in.operands[0], after); err != nil {
+				return nil, err
+			}
+		}
+
+		switch in.op {
+		case code.OpJump, code.OpReturnValue, code.OpReturn, code.OpThrow:
+		default:
+			if err := reach(in.offset, in.offset+in.width, after); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	offsets := make(map[int]int)
+	for offset, i := range starts {
+		if seen[i] {
+			offsets[offset] = depth[i]
+		}
+	}
+
+	return offsets, nil
+}
+
+func isJump(op code.Opcode) bool {
+	return op == code.OpJump || op == code.OpJumpNotTruthy || op == code.OpJumpNotError
+}
+
+// inputs is how many values op reads from the top of the operand stack.
+func inputs(op code.Opcode, operands []int) int {
+	switch op {
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual, code.OpGreaterThan,
+		code.OpIndex:
+		return 2
+	case code.OpPop, code.OpJumpNotTruthy, code.OpJumpNotError, code.OpSetGlobal, code.OpSetLocal,
+		code.OpReturnValue, code.OpThrow, code.OpMinus, code.OpBang, code.OpAddConst, code.OpSubConst,
+		code.OpGetLocalAdd:
+		return 1
+	case code.OpCall:
+		return operands[0] + 1
+	case code.OpArray, code.OpHash:
+		return operands[0]
+	case code.OpClosure:
+		return operands[1]
+	default:
+		return 0
+	}
+}
+
+func (v *verifier) operands(fn *object.CompiledFunction, op code.Opcode, operands []int) error {
+	bc := v.bytecode
+
+	switch op {
+	case code.OpConstant, code.OpAddConst, code.OpSubConst:
+		return checkIndex("constant", operands[0], len(bc.Constants))
+	case code.OpClosure:
+		if err := checkIndex("constant", operands[0], len(bc.Constants)); err != nil {
+			return err
+		}
+		closed, ok := bc.Constants[operands[0]].(*object.CompiledFunction)
+		if !ok {
+			return fmt.Errorf("constant %d is not a function", operands[0])
+		}
+		if operands[1] != len(closed.FreeNames) {
+			return fmt.Errorf("function captures %d free variables, got %d", len(closed.FreeNames), operands[1])
+		}
+	case code.OpHash:
+		if operands[0]%2 != 0 {
+			return fmt.Errorf("odd number of keys and values %d", operands[0])
+		}
+	case code.OpGetBuiltin:
+		return checkIndex("builtin", operands[0], v.builtins)
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return checkIndex("global", operands[0], GlobalsSize)
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalAdd:
+		return checkIndex("local", operands[0], fn.NumLocals)
+	case code.OpGetFree:
+		return checkIndex("free variable", operands[0], len(fn.FreeNames))
+	}
+
+	return nil
+}
+
+func checkIndex(kind string, index, size int) error {
+	if index >= size {
+		return fmt.Errorf("%s %d out of range (have %d)", kind, index, size)
+	}
+	return nil
+}
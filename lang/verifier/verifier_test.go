@@ -0,0 +1,179 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"llc/lang/builtins"
+	"llc/lang/code"
+	"llc/lang/compiler"
+	"llc/lang/lexer"
+	"llc/lang/object"
+	"llc/lang/parser"
+)
+
+func TestVerifyCompiledPrograms(t *testing.T) {
+	tests := []string{
+		`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)`,
+		`let add = fn(a) { fn(b) { a + b } }; [add(1)(2), {"a": 1}["a"], len("abc")]`,
+		`let f = fn() { try { return 1; } finally { 2 }; 3 }; f()`,
+		`let x = 1 + try { throw 1 } catch (e) { 5 }; x * 2`,
+		`let f = fn(a) { [a, try { throw a } catch (e) { e["data"] + 1 }] }; f(1)`,
+		`let g = fn(x) { let v = x?; v + 1 }; g(error("e"))`,
+		`fn() {}`,
+	}
+
+	for i, input := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			for _, peephole := range []bool{false, true} {
+				comp := compiler.New()
+				comp.SetPeephole(peephole)
+				if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+					t.Fatalf("compiler error: %s", err)
+				}
+
+				if err := Verify(comp.Bytecode()); err != nil {
+					t.Errorf("unexpected error (peephole %t): %s", peephole, err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fn := &object.CompiledFunction{
+		Instructions: concat(code.Make(code.OpGetLocal, 1), code.Make(code.OpReturnValue)),
+		NumLocals:    1,
+	}
+
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{
+			&compiler.Bytecode{Instructions: code.Instructions{250}},
+			"invalid bytecode: main: offset 0: opcode 250 undefined",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Instructions{byte(code.OpConstant), 0}},
+			"invalid bytecode: main: offset 0: OpConstant truncated: want 3 bytes, got 2",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 3)},
+			"invalid bytecode: main: offset 0: OpConstant: constant 3 out of range (have 0)",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Instructions{byte(code.OpWide), byte(code.OpPop)}},
+			"invalid bytecode: main: offset 0: OpWide: OpPop has no operands",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 70000)},
+			"invalid bytecode: main: offset 0: OpConstant: constant 70000 out of range (have 0)",
+		},
+		{
+			&compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpSetGlobal, 0x7fffffff))},
+			"invalid bytecode: main: offset 1: OpSetGlobal: global 2147483647 out of range (have 65536)",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpGetGlobal, GlobalsSize)},
+			"invalid bytecode: main: offset 0: OpGetGlobal: global 65536 out of range (have 65536)",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpGetBuiltin, 0), Builtins: []builtins.Definition{}},
+			"invalid bytecode: main: offset 0: OpGetBuiltin: builtin 0 out of range (have 0)",
+		},
+		{
+			&compiler.Bytecode{Instructions: concat(code.Make(code.OpJump, 1), code.Make(code.OpNull))},
+			"invalid bytecode: main: jump to 1 is not an instruction boundary",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{&object.Integer{Value: 1}},
+			},
+			"invalid bytecode: main: offset 0: OpClosure: constant 0 is not a function",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpClosure, 0, 0), Constants: []object.Object{fn}},
+			"invalid bytecode: constant 0: offset 0: OpGetLocal: local 1 out of range (have 1)",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: code.Make(code.OpNull),
+				Handlers:     []code.Handler{{Start: 0, End: 1, Target: 1}},
+			},
+			"invalid bytecode: main: handler 0-1 -> 1 out of range",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpHash, 3)},
+			"invalid bytecode: main: offset 0: OpHash: odd number of keys and values 3",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpPop)},
+			"invalid bytecode: main: offset 0: OpPop: stack has 0 values, needs 1",
+		},
+		{
+			&compiler.Bytecode{Instructions: concat(code.Make(code.OpNull), code.Make(code.OpCall, 1))},
+			"invalid bytecode: main: offset 1: OpCall: stack has 1 values, needs 2",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpReturn)},
+			"invalid bytecode: main: offset 0: OpReturn outside a function",
+		},
+		{
+			&compiler.Bytecode{Instructions: concat(
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 5),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			)},
+			"invalid bytecode: main: offset 5: stack depth 1, want 0",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)),
+				Constants:    []object.Object{&object.CompiledFunction{Instructions: code.Make(code.OpNull)}},
+			},
+			"invalid bytecode: constant 0: offset 0: runs past the end of the function",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpNull), code.Make(code.OpPop), code.Make(code.OpPop)),
+				Handlers:     []code.Handler{{Start: 0, End: 2, Target: 2, Depth: 1}},
+			},
+			"invalid bytecode: main: offset 0: stack depth 0 below handler depth 1",
+		},
+		{
+			// The handler resumes with the error pushed at depth 1, but the
+			// code it jumps to is also reached with an empty stack.
+			&compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpNull), code.Make(code.OpPop), code.Make(code.OpNull)),
+				Handlers:     []code.Handler{{Start: 0, End: 1, Target: 2}},
+			},
+			"invalid bytecode: main: offset 2: stack depth 0, want 1",
+		},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			err := Verify(tt.bytecode)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("wrong error. got=%v, want=%q", err, tt.expected)
+			}
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("error does not wrap ErrInvalid: %v", err)
+			}
+		})
+	}
+}
+
+func concat(instructions ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package vet
+
+import (
+	"fmt"
+
+	"llc/lang/ast"
+	"llc/lang/builtins"
+	"llc/lang/scope"
+)
+
+// unused reports let bindings of functions that nothing but their own value
+// refers to. Bindings of the program are left alone, as other modules may
+// use them, and so are parameters.
+type unused struct{}
+
+func (unused) Name() string { return "unused" }
+func (unused) Doc() string  { return "let bindings in functions that are never used" }
+
+func (unused) Check(pass *Pass) {
+	for _, b := range pass.Info.Bindings {
+		if b.Kind == scope.Parameter || b.Scope.Parent == nil {
+			continue
+		}
+
+		own := make(map[*ast.Identifier]bool)
+		ast.Walk(b.Let.Value, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Identifier); ok {
+				own[ident] = true
+			}
+			return true
+		})
+
+		used := false
+		for _, use := range b.Uses {
+			used = used || !own[use]
+		}
+		if !used {
+			pass.Report(b.Ident.Token.Position(), "%s is declared but never used", b.Name())
+		}
+	}
+}
+
+// shadow reports bindings hiding a binding of an enclosing function or
+// program, or a builtin.
+type shadow struct{}
+
+func (shadow) Name() string { return "shadow" }
+func (shadow) Doc() string  { return "bindings hiding an outer binding or a builtin of the same name" }
+
+func (shadow) Check(pass *Pass) {
+	for _, b := range pass.Info.Bindings {
+		if b.Shadows != nil {
+			pass.Report(b.Ident.Token.Position(), "%s shadows the %s declared at %s",
+				b.Name(), b.Name(), b.Shadows.Ident.Token.Position())
+		} else if _, ok := builtins.Docs[b.Name()]; ok {
+			pass.Report(b.Ident.Token.Position(), "%s shadows the builtin %s", b.Name(), b.Name())
+		}
+	}
+}
+
+// arity reports calls to builtins with a number of arguments they do not
+// accept.
+type arity struct{}
+
+func (arity) Name() string { return "arity" }
+func (arity) Doc() string  { return "builtins called with the wrong number of arguments" }
+
+func (arity) Check(pass *Pass) {
+	ast.Walk(pass.Program, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok || pass.Info.BindingOf(ident) != nil {
+			return true
+		}
+		doc, ok := builtins.Docs[ident.Value]
+		if !ok {
+			return true
+		}
+
+		minArgs, maxArgs := doc.Arity()
+		if n := len(call.Arguments); n < minArgs || maxArgs >= 0 && n > maxArgs {
+			pass.Report(ident.Token.Position(), "%s takes %s, got %d", ident.Value, describeArity(minArgs, maxArgs), n)
+		}
+		return true
+	})
+}
+
+func describeArity(minArgs, maxArgs int) string {
+	switch {
+	case maxArgs < 0:
+		return "at least " + arguments(minArgs)
+	case minArgs == maxArgs:
+		return arguments(minArgs)
+	case minArgs+1 == maxArgs:
+		return fmt.Sprintf("%d or %s", minArgs, arguments(maxArgs))
+	}
+	return fmt.Sprintf("%d to %s", minArgs, arguments(maxArgs))
+}
+
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// unreachable reports statements following a return or a throw in the same
+// block, which never run.
+type unreachable struct{}
+
+func (unreachable) Name() string { return "unreachable" }
+func (unreachable) Doc() string  { return "statements after a return or a throw" }
+
+func (unreachable) Check(pass *Pass) {
+	ast.Walk(pass.Program, func(node ast.Node) bool {
+		var statements []ast.Statement
+		switch node := node.(type) {
+		case *ast.Program:
+			statements = node.Statements
+		case *ast.BlockStatement:
+			statements = node.Statements
+		default:
+			return true
+		}
+
+		for i := 0; i < len(statements)-1; i++ {
+			switch statements[i].(type) {
+			case *ast.ReturnStatement, *ast.ThrowStatement:
+				pass.Report(ast.Pos(statements[i+1]), "unreachable code after %s", statements[i].TokenLiteral())
+				return true
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,109 @@
+// Package vet reports likely mistakes in llc programs that otherwise only
+// show up at runtime, if at all. Each kind of mistake is found by a Rule;
+// llc vet runs Rules unless told to enable or disable some of them.
+package vet
+
+import (
+	"fmt"
+	"sort"
+
+	"llc/lang/ast"
+	"llc/lang/lexer"
+	"llc/lang/parser"
+	"llc/lang/scope"
+	"llc/lang/token"
+)
+
+// Diagnostic is a mistake found by a rule.
+type Diagnostic struct {
+	Rule     string
+	Position token.Position
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Position, d.Message, d.Rule)
+}
+
+// Rule checks a program for one kind of mistake.
+type Rule interface {
+	// Name identifies the rule when enabling or disabling it.
+	Name() string
+	// Doc describes what the rule reports in a line.
+	Doc() string
+	Check(pass *Pass)
+}
+
+// Pass is a program being checked, with its names resolved.
+type Pass struct {
+	Program *ast.Program
+	Info    *scope.Info
+
+	rule        string
+	diagnostics []Diagnostic
+}
+
+func (p *Pass) Report(pos token.Position, format string, a ...interface{}) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{Rule: p.rule, Position: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+// Rules are all the rules, enabled by default.
+var Rules = []Rule{unused{}, shadow{}, arity{}, unreachable{}}
+
+// Select returns the rules named in enable, or all Rules if it is empty,
+// without those named in disable.
+func Select(enable, disable []string) ([]Rule, error) {
+	byName := make(map[string]Rule, len(Rules))
+	for _, rule := range Rules {
+		byName[rule.Name()] = rule
+	}
+
+	selected := Rules
+	if len(enable) != 0 {
+		selected = nil
+		for _, name := range enable {
+			rule, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown rule %q", name)
+			}
+			selected = append(selected, rule)
+		}
+	}
+
+	disabled := make(map[string]bool, len(disable))
+	for _, name := range disable {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		disabled[name] = true
+	}
+
+	var rules []Rule
+	for _, rule := range selected {
+		if !disabled[rule.Name()] {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// Vet runs rules over source and returns what they report in source order.
+// Source with syntax errors cannot be checked and yields the first of them.
+func Vet(source string, rules []Rule) ([]Diagnostic, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) != 0 {
+		return nil, fmt.Errorf("%s: %s", errs[0].Position, errs[0].Message)
+	}
+
+	pass := &Pass{Program: program, Info: scope.Resolve(program)}
+	for _, rule := range rules {
+		pass.rule = rule.Name()
+		rule.Check(pass)
+	}
+
+	sort.SliceStable(pass.diagnostics, func(i, j int) bool {
+		return pass.diagnostics[i].Position.Before(pass.diagnostics[j].Position)
+	})
+	return pass.diagnostics, nil
+}
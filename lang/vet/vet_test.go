@@ -0,0 +1,131 @@
+package vet
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		input    string
+		expected []string
+	}{
+		{"unused", "let f = fn(x) { let y = 1; x };", []string{"1:21: y is declared but never used (unused)"}},
+		{
+			"unused", "let f = fn() { let loop = fn() { loop() }; 1 };",
+			[]string{"1:20: loop is declared but never used (unused)"},
+		},
+		{"unused", "let unusedGlobal = 1; let f = fn(unusedParameter) { 1 };", nil},
+		{
+			"shadow", "let x = 1; let f = fn(x) { try { x } catch (f) { f } };",
+			[]string{"1:23: x shadows the x declared at 1:5 (shadow)", "1:45: f shadows the f declared at 1:16 (shadow)"},
+		},
+		{"shadow", "let len = fn(a) { 0 };", []string{"1:5: len shadows the builtin len (shadow)"}},
+		{
+			"arity", `len(); len("a", "b"); push([]); error(); error("a", 1, 2); print(); args(1); json_stringify(1, 2, 3)`,
+			[]string{
+				"1:1: len takes 1 argument, got 0 (arity)",
+				"1:8: len takes 1 argument, got 2 (arity)",
+				"1:23: push takes 2 arguments, got 1 (arity)",
+				"1:33: error takes 1 or 2 arguments, got 0 (arity)",
+				"1:42: error takes 1 or 2 arguments, got 3 (arity)",
+				"1:69: args takes 0 arguments, got 1 (arity)",
+				"1:78: json_stringify takes 1 or 2 arguments, got 3 (arity)",
+			},
+		},
+		{"arity", "let f = fn(len) { len() }; f(1)", nil},
+		{
+			"unreachable", "let f = fn(x) { if (x) { return 1; print(x) } throw x; x };",
+			[]string{"1:36: unreachable code after return (unreachable)", "1:56: unreachable code after throw (unreachable)"},
+		},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			rules, err := Select([]string{tt.rule}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diagnostics, err := Vet(tt.input, rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, d := range diagnostics {
+				got = append(got, d.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("wrong diagnostics.\ngot=\n%s\nwant=\n%s", strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		enable, disable []string
+		expected        string
+	}{
+		{nil, nil, "unused shadow arity unreachable"},
+		{[]string{"arity", "unused"}, nil, "arity unused"},
+		{nil, []string{"shadow", "unused"}, "arity unreachable"},
+		{[]string{"arity", "unused"}, []string{"unused"}, "arity"},
+		{[]string{"typo"}, nil, `unknown rule "typo"`},
+		{nil, []string{"typo"}, `unknown rule "typo"`},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			rules, err := Select(tt.enable, tt.disable)
+
+			var names []string
+			for _, rule := range rules {
+				names = append(names, rule.Name())
+			}
+			got := strings.Join(names, " ")
+			if err != nil {
+				got = err.Error()
+			}
+
+			if got != tt.expected {
+				t.Errorf("wrong rules. got=%q, want=%q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	_, err := Vet("let = 1;", Rules)
+	if err == nil || err.Error() != "1:5: expected next token to be IDENT, but got = instead" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+// TestStandardLibrary checks that the standard library has nothing to report
+// but the parameters its helpers reuse.
+func TestStandardLibrary(t *testing.T) {
+	source, err := os.ReadFile("../../std/array.llc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := Select(nil, []string{"shadow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics, err := Vet(string(source), rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+}
@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"llc/lang/compiler"
+	"llc/lang/evaluator"
+	"llc/lang/object"
+)
+
+// benchmarkPrograms run on both engines. Arrays are walked by recursion, kept
+// shallow enough for the VM's stack since it has no tail calls.
+var benchmarkPrograms = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{
+		"fib(25)",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(25)",
+		"75025",
+	},
+	{
+		"array sum",
+		"let sum = fn(arr, i, acc) { if (i == len(arr)) { acc } else { sum(arr, i + 1, acc + arr[i]) } };" +
+			"sum(" + integers(300) + ", 0, 0)",
+		"44850",
+	},
+	{
+		"array map",
+		"let double = fn(arr, i, out) { if (i == len(arr)) { out } else { double(arr, i + 1, push(out, arr[i] * 2)) } };" +
+			"len(double(" + integers(300) + ", 0, []))",
+		"300",
+	},
+}
+
+func integers(n int) string {
+	elements := make([]string, n)
+	for i := range elements {
+		elements[i] = fmt.Sprint(i)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func TestBenchmarkPrograms(t *testing.T) {
+	for _, program := range benchmarkPrograms {
+		t.Run(program.name, func(t *testing.T) {
+			comp := compiler.New()
+			if err := comp.Compile(parse(program.input)); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			machine := New(comp.Bytecode())
+			if err := machine.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+
+			if got := machine.LastPoppedStackElem().Inspect(); got != program.expected {
+				t.Errorf("wrong vm result. got=%q, want=%q", got, program.expected)
+			}
+
+			got := evaluator.Eval(parse(program.input), object.NewEnvironment()).Inspect()
+			if got != program.expected {
+				t.Errorf("wrong evaluator result. got=%q, want=%q", got, program.expected)
+			}
+		})
+	}
+}
+
+func BenchmarkEngines(b *testing.B) {
+	for _, program := range benchmarkPrograms {
+		b.Run(program.name+"/vm", func(b *testing.B) {
+			comp := compiler.New()
+			if err := comp.Compile(parse(program.input)); err != nil {
+				b.Fatalf("compiler error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+
+			for b.Loop() {
+				if err := New(bytecode).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+
+		b.Run(program.name+"/eval", func(b *testing.B) {
+			parsed := parse(program.input)
+
+			for b.Loop() {
+				if result := evaluator.Eval(parsed, object.NewEnvironment()); result.Type() == object.ErrorObj {
+					b.Fatalf("evaluator error: %s", result.Inspect())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package vm
+
+import (
+	"llc/lang/object"
+	"llc/lang/token"
+)
+
+// SetGlobalNames names the global slots, as returned by the compiler's
+// symbol table, so that the host's Debugger can show them.
+func (vm *VM) SetGlobalNames(names []string) {
+	vm.globalNames = names
+}
+
+// debugLine hands the instruction at frame's ip to the host's Debugger when
+// it comes from a line the frame was not already on.
+func (vm *VM) debugLine(frame *Frame) error {
+	pos, ok := frame.cl.Fn.Lines.Lookup(frame.ip)
+	if !ok || pos.Line == frame.line {
+		return nil
+	}
+
+	frame.line = pos.Line
+	return vm.debugger.Line(&debugState{vm: vm, frame: frame, position: pos})
+}
+
+// debugState is what the VM shows a Debugger before an instruction.
+type debugState struct {
+	vm       *VM
+	frame    *Frame
+	position token.Position
+}
+
+func (s *debugState) Position() token.Position { return s.position }
+func (s *debugState) Depth() int               { return s.vm.framesIndex - 1 }
+func (s *debugState) Host() *object.Host       { return s.vm.host }
+
+func (s *debugState) Function() string {
+	if s.frame == &s.vm.frames[0] {
+		return ""
+	}
+	if s.frame.cl.Fn.Name == "" {
+		return "<anonymous>"
+	}
+	return s.frame.cl.Fn.Name
+}
+
+// Variables leaves out locals not set yet.
+func (s *debugState) Variables() []object.Variable {
+	var variables []object.Variable
+	fn := s.frame.cl.Fn
+
+	for i, name := range fn.LocalNames {
+		if value := s.vm.stack[s.frame.basePointer+i]; value != nil {
+			variables = append(variables, object.Variable{Name: name, Value: value})
+		}
+	}
+
+	for i, name := range fn.FreeNames {
+		variables = append(variables, object.Variable{Name: name, Value: s.frame.cl.Free[i]})
+	}
+
+	for i, name := range s.vm.globalNames {
+		if i < len(s.vm.globals) && s.vm.globals[i] != nil {
+			variables = append(variables, object.Variable{Name: name, Value: s.vm.globals[i]})
+		}
+	}
+
+	return variables
+}
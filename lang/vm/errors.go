@@ -0,0 +1,28 @@
+package vm
+
+import (
+	"llc/lang/object"
+	"llc/lang/token"
+)
+
+// RuntimeError is an error raised while running bytecode, together with the
+// llc call stack at the point it happened.
+type RuntimeError struct {
+	Err   error
+	Stack []object.StackFrame
+	// Position is where in the source the failing instruction came from. It
+	// is the zero Position when the bytecode has no line table entry for it.
+	Position token.Position
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RuntimeError) StackTrace() string {
+	return object.FormatStack(e.Stack)
+}
@@ -0,0 +1,20 @@
+package vm
+
+import (
+	"llc/lang/code"
+	"llc/lang/object"
+)
+
+// Frame is a slot of the VM's preallocated call stack. ip starts at -1 and
+// is advanced before each instruction is read.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+	// line is the last source line reported to the host's Debugger.
+	line int
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"fmt"
+	"testing"
+
+	"llc/lang/compiler"
+)
+
+func TestPeepholeKeepsBehaviour(t *testing.T) {
+	tests := []string{
+		"-5 + 2",
+		"!true == !!false",
+		`let f = fn(s) { s + "!" }; f("hi")`,
+		"let add = fn(a, b) { a + b - 1 }; add(2, 3)",
+		"let f = fn(a, c) { a + if (c) { 1 } else { a } }; [f(1, true), f(5, false)]",
+		"if (false) { 1 } else { 2 }",
+		"if (true) { 1 }",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)",
+		`try { !true; len(1) } catch (e) { e["message"] }`,
+		`let f = fn() { try { return 1 + 1; } finally { -1 } }; f()`,
+		`let f = fn(x) { error("no")?; x + 1 }; is_error(f(1))`,
+		`let f = fn(a) { a + true }; try { f(1) } catch (e) { e["stack"] }`,
+	}
+
+	for i, input := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			want := runWithPeephole(t, input, false)
+			if got := runWithPeephole(t, input, true); got != want {
+				t.Errorf("peephole changed the result. got=%q, want=%q", got, want)
+			}
+		})
+	}
+}
+
+func runWithPeephole(t *testing.T, input string, enabled bool) string {
+	t.Helper()
+
+	comp := compiler.New()
+	comp.SetPeephole(enabled)
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return "error: " + err.Error()
+	}
+
+	return machine.LastPoppedStackElem().Inspect()
+}
+
+func BenchmarkPeephole(b *testing.B) {
+	programs := []struct {
+		name  string
+		input string
+	}{
+		{"fibonacci", "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)"},
+		{"sum", "let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(500, 0)"},
+	}
+
+	for _, program := range programs {
+		for _, enabled := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/peephole=%t", program.name, enabled), func(b *testing.B) {
+				comp := compiler.New()
+				comp.SetPeephole(enabled)
+				if err := comp.Compile(parse(program.input)); err != nil {
+					b.Fatalf("compiler error: %s", err)
+				}
+				bytecode := comp.Bytecode()
+
+				for b.Loop() {
+					if err := New(bytecode).Run(); err != nil {
+						b.Fatalf("vm error: %s", err)
+					}
+				}
+			})
+		}
+	}
+}
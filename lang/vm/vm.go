@@ -1,38 +1,128 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 
+	"llc/lang/builtins"
 	"llc/lang/code"
 	"llc/lang/compiler"
 	"llc/lang/object"
+	"llc/lang/token"
+	"llc/lang/verifier"
 )
 
-const StackSize = 2048
+const (
+	StackSize   = 2048
+	GlobalsSize = verifier.GlobalsSize
+	MaxFrames   = 1024
+)
 
 var (
-	True  = &object.Boolean{Value: true}
-	False = &object.Boolean{Value: false}
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
 )
 
 type VM struct {
-	constants    []object.Object
-	instructions code.Instructions
+	host      *object.Host
+	meter     *object.Meter
+	constants []object.Object
+	builtins  []builtins.Definition
 
 	stack []object.Object
 	sp    int
+
+	globals []object.Object
+
+	// frames is allocated once; calls reuse its slots instead of
+	// allocating a Frame each.
+	frames      []Frame
+	framesIndex int
+
+	// invalid is why the bytecode failed verification, reported by Run.
+	invalid error
+
+	debugger    object.Debugger
+	globalNames []string
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithHost(bytecode, nil)
+}
+
+// NewWithHost starts with an empty globals store that grows as globals are
+// set, so short programs do not pay for all GlobalsSize slots.
+func NewWithHost(bytecode *compiler.Bytecode, host *object.Host) *VM {
+	return NewWithGlobalsStore(bytecode, host, nil)
+}
+
+// NewWithGlobalsStore runs bytecode against an existing globals store, so
+// that consecutive programs, such as REPL lines, share their globals. Only a
+// store of GlobalsSize slots is guaranteed to stay shared.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, host *object.Host, globals []object.Object) *VM {
+	definitions := bytecode.Builtins
+	if definitions == nil {
+		definitions = builtins.Definitions
+	}
+
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Lines:        bytecode.Lines,
+		Handlers:     bytecode.Handlers,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	frames := make([]Frame, MaxFrames)
+	frames[0] = Frame{cl: mainClosure, ip: -1}
+
+	var debugger object.Debugger
+	if host != nil {
+		debugger = host.Debugger
+	}
+
 	return &VM{
-		instructions: bytecode.Instructions,
-		constants:    bytecode.Constants,
+		host:      host,
+		constants: bytecode.Constants,
+		builtins:  definitions,
 
 		stack: make([]object.Object, StackSize),
 		sp:    0,
+
+		globals: globals,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		invalid: verifier.Verify(bytecode),
+
+		debugger: debugger,
 	}
 }
 
+func (vm *VM) pushFrame(cl *object.Closure, basePointer int) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("%w: more than %d frames", object.ErrStackOverflow, MaxFrames)
+	}
+
+	if err := vm.meter.Enter(); err != nil {
+		return err
+	}
+
+	vm.frames[vm.framesIndex] = Frame{cl: cl, ip: -1, basePointer: basePointer}
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	vm.meter.Leave()
+	return &vm.frames[vm.framesIndex]
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -41,13 +131,145 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
-func (vm *VM) Run() error { //nolint:gocognit,cyclop
-	for ip := 0; ip < len(vm.instructions); ip++ {
-		op := code.Opcode(vm.instructions[ip])
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it finishes, ctx is done or the host's
+// limits are exceeded. In the last two cases the error wraps ctx.Err() or
+// object.ErrLimitExceeded. Bytecode that fails verification is rejected
+// before anything runs with an error wrapping verifier.ErrInvalid; all other
+// errors are returned as a *RuntimeError.
+func (vm *VM) RunContext(ctx context.Context) error {
+	if vm.invalid != nil {
+		return vm.invalid
+	}
+
+	var limits object.Limits
+	if vm.host != nil {
+		limits = vm.host.Limits
+	}
+
+	vm.meter = object.NewMeter(ctx, limits)
+	defer func() { vm.meter = nil }()
+
+	for {
+		err := vm.run()
+		if err == nil {
+			return nil
+		}
+
+		stack := vm.callStack()
+		position := vm.position()
+		if !vm.handleError(err, stack) {
+			return &RuntimeError{Err: err, Stack: stack, Position: position}
+		}
+	}
+}
+
+// handleError unwinds to the innermost frame with a handler covering its
+// current instruction and resumes there with the error pushed. Errors used by
+// the host to stop the script are never handled.
+func (vm *VM) handleError(err error, stack []object.StackFrame) bool {
+	if errors.Is(err, object.ErrLimitExceeded) || errors.Is(err, object.ErrStopped) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := &vm.frames[i]
+
+		for _, handler := range frame.cl.Fn.Handlers {
+			if frame.ip < handler.Start || frame.ip >= handler.End {
+				continue
+			}
+
+			for vm.framesIndex > i+1 {
+				vm.popFrame()
+			}
+
+			errorValue := &object.ErrorValue{Kind: object.RuntimeErrorKind, Message: err.Error()}
+			var thrown *object.ErrorValue
+			if errors.As(err, &thrown) {
+				errorValue.Kind, errorValue.Data = thrown.Kind, thrown.Data
+			}
+			// Only the frames unwound belong to the error's stack.
+			errorValue.Stack = stack[:len(stack)-i]
+
+			vm.sp = frame.basePointer + frame.cl.Fn.NumLocals + handler.Depth
+			vm.stack[vm.sp] = errorValue
+			vm.sp++
+			frame.ip = handler.Target - 1
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// callStack describes the active frames, innermost first.
+func (vm *VM) callStack() []object.StackFrame {
+	stack := make([]object.StackFrame, 0, vm.framesIndex-1)
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		caller := &vm.frames[i-1]
+		pos := callSite(caller)
+
+		stack = append(stack, object.StackFrame{
+			Function: vm.frames[i].cl.Fn.Name,
+			Line:     pos.Line,
+			Column:   pos.Column,
+		})
+	}
+
+	return stack
+}
+
+// callSite is the position of the call a frame is waiting on. Its ip rests
+// on the last operand byte of the OpCall, which the line table covers along
+// with the rest of the instruction.
+func callSite(frame *Frame) token.Position {
+	pos, _ := frame.cl.Fn.Lines.Lookup(frame.ip)
+	return pos
+}
+
+// position is where the instruction the current frame stopped at came from.
+func (vm *VM) position() token.Position {
+	frame := &vm.frames[vm.framesIndex-1]
+	pos, _ := frame.cl.Fn.Lines.Lookup(frame.ip)
+	return pos
+}
+
+func (vm *VM) run() error { //nolint:gocognit,cyclop,funlen,gocyclo,maintidx
+	for {
+		// frame stays valid until the next call or return, after which the
+		// loop picks up the new current frame.
+		frame := &vm.frames[vm.framesIndex-1]
+		ins := frame.cl.Fn.Instructions
+		if frame.ip >= len(ins)-1 {
+			return nil
+		}
+
+		if err := vm.meter.Step(); err != nil {
+			return err
+		}
+
+		frame.ip++
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		if vm.debugger != nil {
+			if err := vm.debugLine(frame); err != nil {
+				return err
+			}
+		}
+
 		switch op {
 		case code.OpConstant:
-			constIndex := code.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
 				return err
@@ -57,6 +279,28 @@ func (vm *VM) Run() error { //nolint:gocognit,cyclop
 			if err != nil {
 				return err
 			}
+		case code.OpAddConst, code.OpSubConst:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			binaryOp := code.OpAdd
+			if op == code.OpSubConst {
+				binaryOp = code.OpSub
+			}
+
+			err := vm.executeBinaryOperands(binaryOp, vm.pop(), vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpGetLocalAdd:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			right := vm.stack[frame.basePointer+int(localIndex)]
+			err := vm.executeBinaryOperands(code.OpAdd, vm.pop(), right)
+			if err != nil {
+				return err
+			}
 		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
 			err := vm.executeComparison(op)
 			if err != nil {
@@ -72,6 +316,11 @@ func (vm *VM) Run() error { //nolint:gocognit,cyclop
 			if err != nil {
 				return err
 			}
+		case code.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
 		case code.OpBang:
 			err := vm.executeBangOperator()
 			if err != nil {
@@ -84,19 +333,416 @@ func (vm *VM) Run() error { //nolint:gocognit,cyclop
 			}
 		case code.OpPop:
 			vm.pop()
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				frame.ip = pos - 1
+			}
+		case code.OpJumpNotError:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if _, ok := vm.stack[vm.sp-1].(*object.ErrorValue); !ok {
+				frame.ip = pos - 1
+			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			if err := vm.setGlobal(int(globalIndex), vm.pop()); err != nil {
+				return err
+			}
+		case code.OpGetGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if globalIndex >= len(vm.globals) {
+				return fmt.Errorf("global %d read before it was set", globalIndex)
+			}
+
+			err := vm.push(vm.globals[globalIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			err := vm.push(vm.builtins[builtinIndex].Builtin)
+			if err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			currentClosure := frame.cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpThrow:
+			return object.NewThrownValue(vm.pop())
+		case code.OpCurrentClosure:
+			err := vm.push(frame.cl)
+			if err != nil {
+				return err
+			}
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if err := vm.meter.Allocate(int64(numElements) + 1); err != nil {
+				return err
+			}
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp -= numElements
+
+			err := vm.push(array)
+			if err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if err := vm.meter.Allocate(int64(numElements/2) + 1); err != nil {
+				return err
+			}
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp -= numElements
+
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				// Returning from the main program ends it, leaving the value
+				// where LastPoppedStackElem finds it.
+				frame.ip = len(ins) - 1
+				continue
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+		case code.OpWide:
+			err := vm.executeWide(frame, ins, ip)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("opcode %d undefined", op)
+		}
+	}
+}
+
+// executeWide runs the instruction after an OpWide prefix at ip. Wide
+// operands are rare, so they take this slower path instead of slowing down
+// the main loop.
+func (vm *VM) executeWide(frame *Frame, ins code.Instructions, ip int) error { //nolint:cyclop,funlen
+	def, operands, width, err := ins.Decode(ip)
+	if err != nil {
+		return err
+	}
+	frame.ip += width - 1
+
+	op := ins.Opcode(ip)
+	switch op {
+	case code.OpConstant:
+		return vm.push(vm.constants[operands[0]])
+	case code.OpAddConst:
+		return vm.executeBinaryOperands(code.OpAdd, vm.pop(), vm.constants[operands[0]])
+	case code.OpSubConst:
+		return vm.executeBinaryOperands(code.OpSub, vm.pop(), vm.constants[operands[0]])
+	case code.OpGetLocalAdd:
+		return vm.executeBinaryOperands(code.OpAdd, vm.pop(), vm.stack[frame.basePointer+operands[0]])
+	case code.OpJump:
+		frame.ip = operands[0] - 1
+	case code.OpJumpNotTruthy:
+		if !isTruthy(vm.pop()) {
+			frame.ip = operands[0] - 1
+		}
+	case code.OpJumpNotError:
+		if _, ok := vm.stack[vm.sp-1].(*object.ErrorValue); !ok {
+			frame.ip = operands[0] - 1
+		}
+	case code.OpSetGlobal:
+		return vm.setGlobal(operands[0], vm.pop())
+	case code.OpGetGlobal:
+		if operands[0] >= len(vm.globals) {
+			return fmt.Errorf("global %d read before it was set", operands[0])
 		}
+		return vm.push(vm.globals[operands[0]])
+	case code.OpSetLocal:
+		vm.stack[frame.basePointer+operands[0]] = vm.pop()
+	case code.OpGetLocal:
+		return vm.push(vm.stack[frame.basePointer+operands[0]])
+	case code.OpGetBuiltin:
+		return vm.push(vm.builtins[operands[0]].Builtin)
+	case code.OpGetFree:
+		return vm.push(frame.cl.Free[operands[0]])
+	case code.OpArray:
+		if err := vm.meter.Allocate(int64(operands[0]) + 1); err != nil {
+			return err
+		}
+
+		array := vm.buildArray(vm.sp-operands[0], vm.sp)
+		vm.sp -= operands[0]
+		return vm.push(array)
+	case code.OpHash:
+		if err := vm.meter.Allocate(int64(operands[0]/2) + 1); err != nil {
+			return err
+		}
+
+		hash, err := vm.buildHash(vm.sp-operands[0], vm.sp)
+		if err != nil {
+			return err
+		}
+		vm.sp -= operands[0]
+		return vm.push(hash)
+	case code.OpCall:
+		return vm.executeCall(operands[0])
+	case code.OpClosure:
+		return vm.pushClosure(operands[0], operands[1])
+	default:
+		return fmt.Errorf("OpWide: %s cannot be wide", def.Name)
+	}
+
+	return nil
+}
+
+// setGlobal grows the globals store as far as GlobalsSize.
+func (vm *VM) setGlobal(index int, value object.Object) error {
+	if index >= GlobalsSize {
+		return fmt.Errorf("global %d out of range", index)
+	}
+	if index >= len(vm.globals) {
+		vm.globals = slices.Grow(vm.globals, index+1-len(vm.globals))[:index+1]
+	}
+
+	vm.globals[index] = value
+	return nil
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	basePointer := vm.sp - numArgs
+	if err := vm.pushFrame(cl, basePointer); err != nil {
+		return err
+	}
+
+	if basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("%w: more than %d stack slots", object.ErrStackOverflow, StackSize)
 	}
+	// Locals past the parameters may still hold values of an earlier call,
+	// which the Debugger would show before they are set.
+	clear(vm.stack[basePointer+numArgs : basePointer+cl.Fn.NumLocals])
+	vm.sp = basePointer + cl.Fn.NumLocals
 
 	return nil
 }
 
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	result := builtin.Function(vm.host, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if errObj, ok := result.(*object.Error); ok {
+		return errors.New(errObj.Message)
+	}
+
+	if result == nil {
+		return vm.push(Null)
+	}
+
+	if array, ok := result.(*object.Array); ok {
+		if err := vm.meter.Allocate(int64(len(array.Elements)) + 1); err != nil {
+			return err
+		}
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+	copy(elements, vm.stack[startIndex:endIndex])
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ArrayObj && index.Type() == object.IntegerObj:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HashObj:
+		return vm.executeHashIndex(left, index)
+	case left.Type() == object.ErrorValueObj && index.Type() == object.StringObj:
+		return vm.executeErrorValueIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject, _ := array.(*object.Array)
+	i, _ := index.(*object.Integer)
+	maxIndex := int64(len(arrayObject.Elements) - 1)
+
+	if i.Value < 0 || i.Value > maxIndex {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i.Value])
+}
+
+func (vm *VM) executeErrorValueIndex(errorValue, index object.Object) error {
+	errorValueObject, _ := errorValue.(*object.ErrorValue)
+	name, _ := index.(*object.String)
+
+	field, ok := errorValueObject.Field(name.Value)
+	if !ok {
+		return fmt.Errorf("unknown error field: %s", name.Value)
+	}
+
+	return vm.push(field)
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject, _ := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
 func (vm *VM) LastPoppedStackElem() object.Object {
 	return vm.stack[vm.sp]
 }
 
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+		return fmt.Errorf("%w: more than %d stack slots", object.ErrStackOverflow, StackSize)
 	}
 
 	vm.stack[vm.sp] = o
@@ -115,11 +761,18 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
+	return vm.executeBinaryOperands(op, left, right)
+}
+
+func (vm *VM) executeBinaryOperands(op code.Opcode, left, right object.Object) error {
 	leftType := left.Type()
 	rightType := right.Type()
 
-	if leftType == object.IntegerObj && rightType == object.IntegerObj {
+	switch {
+	case leftType == object.IntegerObj && rightType == object.IntegerObj:
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case leftType == object.StringObj && rightType == object.StringObj:
+		return vm.executeBinaryStringOperation(op, left, right)
 	}
 
 	return fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
@@ -141,12 +794,15 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return errors.New("division by zero")
+		}
 		result = leftValue / rightValue
 	default:
 		return fmt.Errorf("unknown integer operation: %d", op)
 	}
 
-	err := vm.push(&object.Integer{Value: result})
+	err := vm.push(object.NewInteger(result))
 	if err != nil {
 		return err
 	}
@@ -154,6 +810,21 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	return nil
 }
 
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return fmt.Errorf("unknown string operator: %d", op)
+	}
+
+	leftValue, _ := left.(*object.String)
+	rightValue, _ := right.(*object.String)
+
+	if err := vm.meter.Allocate(1); err != nil {
+		return err
+	}
+
+	return vm.push(&object.String{Value: leftValue.Value + rightValue.Value})
+}
+
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -196,6 +867,8 @@ func (vm *VM) executeBangOperator() error {
 		return vm.push(False)
 	case False:
 		return vm.push(True)
+	case Null:
+		return vm.push(True)
 	default:
 		return vm.push(False)
 	}
@@ -209,7 +882,7 @@ func (vm *VM) executeMinusOperator() error {
 	}
 
 	value, _ := operand.(*object.Integer)
-	return vm.push(&object.Integer{Value: -value.Value})
+	return vm.push(object.NewInteger(-value.Value))
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -218,3 +891,14 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	}
 	return False
 }
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
@@ -1,14 +1,21 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 
 	"llc/lang/ast"
+	"llc/lang/builtins"
+	"llc/lang/code"
 	"llc/lang/compiler"
+	"llc/lang/evaluator"
 	"llc/lang/lexer"
 	"llc/lang/object"
 	"llc/lang/parser"
+	"llc/lang/verifier"
 )
 
 func TestIntegerArithmetic(t *testing.T) {
@@ -65,6 +72,481 @@ func TestBooleanExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{input: `"llc"`, expected: "llc"},
+		{input: `"l" + "lc"`, expected: "llc"},
+		{input: `"l" + "l" + "c"`, expected: "llc"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{input: `len("")`, expected: 0},
+		{input: `len("four")`, expected: 4},
+		{input: `len("hello" + " world")`, expected: 11},
+		{input: `print("hello")`, expected: Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`1(2)`, "calling non-function: INTEGER"},
+		{`let z = 0; 1 / z`, "division by zero"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			comp := compiler.New()
+			err := comp.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			err = New(comp.Bytecode()).Run()
+			if err == nil {
+				t.Fatalf("expected VM error but resulted in none.")
+			}
+
+			if err.Error() != tt.expected {
+				t.Errorf("wrong VM error. got=%q, want=%q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOutputGoesToHost(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	host := &object.Host{Stdout: &stdout, Stderr: &stderr}
+
+	comp := compiler.New()
+	err := comp.Compile(parse(`print("out"); eprint("err"); print(1 + 2)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = NewWithHost(comp.Bytecode(), host).Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if stdout.String() != "out\n3\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+
+	if stderr.String() != "err\n" {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+}
+
+func TestRegisteredBuiltins(t *testing.T) {
+	registry := builtins.NewRegistry()
+	err := registry.Namespace("str").Register("twice", func(_ *object.Host, args ...object.Object) object.Object {
+		return &object.String{Value: args[0].Inspect() + args[0].Inspect()}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comp := compiler.NewWithBuiltins(registry)
+	err = comp.Compile(parse(`len(str.twice("ab"))`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 4, machine.LastPoppedStackElem())
+
+	err = compiler.New().Compile(parse(`str.twice("ab")`))
+	if err == nil {
+		t.Errorf("builtins of one registry must not be visible to other compilers")
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "if (true) { 10 }", expected: 10},
+		{input: "if (true) { 10 } else { 20 }", expected: 10},
+		{input: "if (false) { 10 } else { 20 } ", expected: 20},
+		{input: "if (1 < 2) { 10 }", expected: 10},
+		{input: "if (1 > 2) { 10 }", expected: Null},
+		{input: "if ((if (false) { 10 })) { 10 } else { 20 }", expected: 20},
+		{input: "!(if (false) { 5; })", expected: true},
+		{input: "if (true) { let y = 1; }", expected: Null},
+		{input: "if (false) { 1 } else { }", expected: Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "let one = 1; one", expected: 1},
+		{input: "let one = 1; let two = one + one; one + two", expected: 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCollections(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "[1, 2, 3][1]", expected: 2},
+		{input: "[[1, 1, 1]][0][0]", expected: 1},
+		{input: "[1, 2, 3][99]", expected: Null},
+		{input: "{1: 1, 2: 2}[2]", expected: 2},
+		{input: `{"a": 5}["b"]`, expected: Null},
+		{input: "len(push([1], 2))", expected: 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "let f = fn() { 5 + 10; }; f();", expected: 15},
+		{input: "let f = fn() { return 99; 100; }; f();", expected: 99},
+		{input: "let f = fn() { }; f();", expected: Null},
+		{input: "let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", expected: 10},
+		{input: "let g = 50; let f = fn() { let n = 1; g - n }; f() + f();", expected: 98},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "let adder = fn(a) { fn(b) { a + b } }; adder(1)(2)", expected: 3},
+		{input: `
+		let fibonacci = fn(x) {
+			if (x < 2) { return x; }
+			fibonacci(x - 1) + fibonacci(x - 2);
+		};
+		fibonacci(15);`, expected: 610},
+		{input: `
+		let wrapper = fn() {
+			let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			countDown(5);
+		};
+		wrapper();`, expected: 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestWrongNumberOfArguments(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("fn(a) { a; }(1, 2);"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "wrong number of arguments: want=1, got=2" {
+		t.Errorf("wrong VM error. got=%v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits object.Limits
+	}{
+		{"let f = fn() { f() }; f()", object.Limits{MaxSteps: 1000}},
+		{"let f = fn(x) { f(x + 1) }; f(0)", object.Limits{MaxCallDepth: 50}},
+		{"let f = fn(a) { f(push(a, 1)) }; f([])", object.Limits{MaxAllocations: 100}},
+		{`let f = fn(s) { f(s + "x") }; f("")`, object.Limits{MaxAllocations: 100}},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			comp := compiler.New()
+			err := comp.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			host := &object.Host{Limits: tt.limits}
+			err = NewWithHost(comp.Bytecode(), host).Run()
+			if !errors.Is(err, object.ErrLimitExceeded) {
+				t.Errorf("expected limit error. got=%v", err)
+			}
+		})
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []string{
+		"let f = fn() { f() }; f()",
+		"let f = fn(n) { let a = n; let b = n; let c = n; f(n + 1) }; f(0)",
+		"let f = fn(n) { 1 + (2 + (3 + (4 + f(n + 1)))) }; f(0)",
+	}
+
+	for i, input := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			comp := compiler.New()
+			if err := comp.Compile(parse(input)); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			err := New(comp.Bytecode()).Run()
+			if !errors.Is(err, object.ErrStackOverflow) {
+				t.Errorf("expected object.ErrStackOverflow. got=%v", err)
+			}
+		})
+	}
+}
+
+func TestRunContextCancellation(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let loop = fn() { loop() }; loop()"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Without a call depth limit, only the cancelled context stops the loop
+	// before the VM runs out of frames.
+	err = New(comp.Bytecode()).RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled. got=%v", err)
+	}
+}
+
+func TestInvalidBytecodeIsRejected(t *testing.T) {
+	tests := []code.Instructions{
+		code.Make(code.OpConstant, 5),
+		code.Instructions{byte(code.OpJump), 0},
+		code.Make(code.OpAdd),
+	}
+
+	for i, ins := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			err := New(&compiler.Bytecode{Instructions: ins}).Run()
+			if !errors.Is(err, verifier.ErrInvalid) {
+				t.Errorf("expected verifier.ErrInvalid. got=%v", err)
+			}
+		})
+	}
+}
+
+func TestRuntimeErrorStack(t *testing.T) {
+	input := `
+let inner = fn(x) { x + true };
+let outer = fn() { let y = inner(1); y };
+outer();`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected RuntimeError. got=%T (%v)", err, err)
+	}
+
+	if runtimeErr.Error() != "unsupported types for binary operation: INTEGER BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Error())
+	}
+
+	if runtimeErr.Position.String() != "2:23" {
+		t.Errorf("wrong position. got=%s", runtimeErr.Position)
+	}
+
+	expected := "  at inner (called at 3:33)\n  at outer (called at 4:6)\n"
+	if runtimeErr.StackTrace() != expected {
+		t.Errorf("wrong stack trace. got=%q, want=%q", runtimeErr.StackTrace(), expected)
+	}
+}
+
+func TestTryCatchFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw "boom"; 1 } catch (e) { e["message"] }`, "boom"},
+		{`try { throw "boom" } catch (e) { e }`, "Error: boom"},
+		{`try { throw [1, 2] } catch (e) { e["data"][1] }`, "2"},
+		{`try { 1 + true } catch (e) { e["kind"] + ": " + e["message"] }`,
+			"RuntimeError: unsupported types for binary operation: INTEGER BOOLEAN"},
+		{`let f = fn() { throw "deep" }; let g = fn() { let r = f(); r }; try { g() } catch (e) { e["stack"] }`,
+			"[f (called at 1:56), g (called at 1:72)]"},
+		{`try { try { throw "inner" } catch (e) { throw e["message"] + "!" } } catch (e) { e["message"] }`, "inner!"},
+		{`let x = 1 + try { throw 1 } catch (e) { 5 }; x * 2`, "12"},
+		{`let f = fn(a) { [a, try { throw a } catch (e) { e["data"] + 1 }] }; f(1)`, "[1, 2]"},
+		{`try { throw "a" } catch (e) { }`, "null"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+		{`let r = try { 1 } finally { 5 }; r`, "1"},
+		{`try { throw "a" } catch (e) { 2 } finally { 3 }`, "2"},
+		{`let f = fn() { try { return 1; } finally { 2 }; 3 }; f()`, "1"},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, "2"},
+		{`try { try { throw "a" } finally { 1 } } catch (e) { e["message"] }`, "a"},
+		{`try { try { 1 } finally { throw "b" } } catch (e) { e["message"] }`, "b"},
+		{`let f = fn() { try { try { return 1 } finally { throw "x" } } catch (e) { e["message"] } }; f()`, "x"},
+		{`let f = fn() { try { return 1 } catch (e) { 2 } finally { 3 } }; f() + f()`, "2"},
+		{`let f = fn(n) { if (n == 0) { throw "bottom" } else { f(n - 1) } };
+		  try { f(50) } catch (e) { len(e["stack"]) }`, "51"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			comp := compiler.New()
+			err := comp.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			machine := New(comp.Bytecode())
+			err = machine.Run()
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+
+			if result := machine.LastPoppedStackElem().Inspect(); result != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCatchScopeMatchesEvaluator checks that the catch clause has a scope of
+// its own on the VM as it does in the evaluator.
+func TestCatchScopeMatchesEvaluator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let e = 1; try { throw "x" } catch (e) { 0 }; e`, "1"},
+		{`let f = fn() { let e = 1; try { throw "x" } catch (e) { 0 }; e }; f()`, "1"},
+		{`let y = 1; try { throw "x" } catch (e) { let y = 2; y } + y`, "3"},
+		{`let f = fn(e) { [try { throw "x" } catch (e) { e["message"] }, e] }; f(2)`, "[x, 2]"},
+		{`let f = fn() { try { throw "x" } catch (e) { fn() { e["message"] } } }; f()()`, "x"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			comp := compiler.New()
+			if err := comp.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			machine := New(comp.Bytecode())
+			if err := machine.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			if got := machine.LastPoppedStackElem().Inspect(); got != tt.expected {
+				t.Errorf("wrong vm result. got=%q, want=%q", got, tt.expected)
+			}
+
+			if got := evaluator.Eval(parse(tt.input), object.NewEnvironment()).Inspect(); got != tt.expected {
+				t.Errorf("wrong evaluator result. got=%q, want=%q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestErrorValuesAndPropagation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`error("boom")`, "Error: boom"},
+		{`error("boom", 42)["data"]`, "42"},
+		{`is_error(error("a"))`, "true"},
+		{`is_error(1)`, "false"},
+		{`let f = fn() { 5? }; f()`, "5"},
+		{`let f = fn() { error("no")?; 5 }; f()`, "Error: no"},
+		{`let parse = fn(x) { if (x > 0) { x } else { error("negative") } };
+		  let double = fn(x) { parse(x)? * 2 };
+		  [double(2), double(-1)]`, "[4, Error: negative]"},
+		{`let f = fn() { let x = error("a")?; x + 1 }; is_error(f())`, "true"},
+		{`let f = fn() { [1, error("in array")?, 3] }; f()["message"]`, "in array"},
+		{`let f = fn() { try { error("t")? } finally { 1 } }; f()`, "Error: t"},
+		{`let f = fn() { let r = fn() { error("inner")? }(); 2 }; f()`, "2"},
+		{`error("top")?; 1`, "Error: top"},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			comp := compiler.New()
+			err := comp.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			machine := New(comp.Bytecode())
+			err = machine.Run()
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+
+			if result := machine.LastPoppedStackElem().Inspect(); result != tt.expected {
+				t.Errorf("wrong result. got=%q, want=%q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let f = fn() { throw "boom" }; f(); 1`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+
+	var thrown *object.ErrorValue
+	if !errors.As(err, &thrown) {
+		t.Fatalf("expected thrown error value. got=%T (%v)", err, err)
+	}
+
+	if thrown.Message != "boom" {
+		t.Errorf("wrong message. got=%q", thrown.Message)
+	}
+}
+
+func TestLimitsAreNotCatchable(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let f = fn() { f() }; try { f() } catch (e) { "caught" }`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	host := &object.Host{Limits: object.Limits{MaxSteps: 500}}
+	err = NewWithHost(comp.Bytecode(), host).Run()
+	if !errors.Is(err, object.ErrLimitExceeded) {
+		t.Errorf("expected limit error. got=%v", err)
+	}
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -128,6 +610,15 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err != nil {
 			t.Errorf("testBooleanObject failed: %s", err)
 		}
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
 	}
 }
 
@@ -143,3 +634,16 @@ func testBooleanObject(expected bool, actual object.Object) error {
 
 	return nil
 }
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// join formats format with each of 0..n-1 and joins the results with sep.
+func join(format string, n int, sep string) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = fmt.Sprintf(format, i)
+	}
+	return strings.Join(parts, sep)
+}
+
+// widePrograms need operands that only fit behind an OpWide prefix.
+func widePrograms() []struct{ input, expected string } {
+	return []struct{ input, expected string }{
+		// More than 65536 constants.
+		{join("%d", 70000, " + "), "2449965000"},
+		// Jumps over more than 65535 bytes of code.
+		{
+			"let f = fn(c) { if (c) { " + join("%d;", 20000, " ") + " 5 } else { 7 } }; [f(true), f(false)]",
+			"[5, 7]",
+		},
+		// More than 256 locals, parameters, arguments and free variables.
+		{"let f = fn() { " + join("let v%[1]d = %[1]d;", 300, " ") + " v0 + v150 + v299 }; f()", "449"},
+		{"let f = fn(" + join("p%d", 300, ", ") + ") { p0 + p299 }; f(" + join("%d", 300, ", ") + ")", "299"},
+		{
+			"let f = fn() { " + join("let v%[1]d = %[1]d;", 300, " ") + " fn() { " + join("v%d", 300, " + ") +
+				" } }; f()()",
+			"44850",
+		},
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	for i, tt := range widePrograms() {
+		name := fmt.Sprintf("[%d]", i)
+		t.Run(name, func(t *testing.T) {
+			for _, peephole := range []bool{false, true} {
+				if got := runWithPeephole(t, tt.input, peephole); got != tt.expected {
+					t.Errorf("peephole=%t: wrong result. got=%q, want=%q", peephole, got, tt.expected)
+				}
+			}
+		})
+	}
+}